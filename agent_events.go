@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/callbacks"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/tools"
+)
+
+// 智能体事件类型
+const (
+	agentEventThought   = "thought"    // 智能体决定调用工具前的思考
+	agentEventToolStart = "tool_start" // 开始调用工具，含工具名称和输入
+	agentEventToolEnd   = "tool_end"   // 工具调用结束，含结果或错误
+	agentEventToken     = "token"      // 最终答复的片段，随模型输出逐段产生
+	agentEventAnswer    = "answer"     // 完整的最终答复
+	agentEventError     = "error"      // 处理失败
+)
+
+// conversationalAnswerMarker 对话型智能体输出中最终答复的起始标记
+const conversationalAnswerMarker = "AI:"
+
+// AgentEvent 智能体处理过程中的事件，用于流式输出
+type AgentEvent struct {
+	Type   string `json:"type"`             // 事件类型
+	Text   string `json:"text,omitempty"`   // 思考内容、答复片段或完整答复
+	Tool   string `json:"tool,omitempty"`   // 工具名称
+	Input  string `json:"input,omitempty"`  // 工具输入
+	Output string `json:"output,omitempty"` // 工具结果
+	Error  string `json:"error,omitempty"`  // 错误信息
+}
+
+// agentEventStream 一次提问的事件接收方，随 context 传递给回调和工具
+type agentEventStream struct {
+	mu        sync.Mutex
+	emit      func(AgentEvent)
+	output    strings.Builder // 当前这次模型调用已输出的内容
+	answering bool            // 当前模型输出已进入最终答复
+}
+
+type agentEventsKey struct{}
+
+// withAgentEvents 返回携带事件接收方的 context，智能体处理过程中的事件依次传给 emit
+func withAgentEvents(ctx context.Context, emit func(AgentEvent)) context.Context {
+	return context.WithValue(ctx, agentEventsKey{}, &agentEventStream{emit: emit})
+}
+
+// agentEvents 返回 context 中的事件接收方，没有时返回 nil
+func agentEvents(ctx context.Context) *agentEventStream {
+	stream, _ := ctx.Value(agentEventsKey{}).(*agentEventStream)
+	return stream
+}
+
+// send 发送事件
+func (s *agentEventStream) send(e AgentEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emit(e)
+}
+
+// token 处理模型输出的片段，只转发 "AI:" 之后的最终答复
+func (s *agentEventStream) token(chunk string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.answering {
+		s.emit(AgentEvent{Type: agentEventToken, Text: chunk})
+		return
+	}
+	s.output.WriteString(chunk)
+	text := s.output.String()
+	i := strings.Index(text, conversationalAnswerMarker)
+	if i < 0 {
+		return
+	}
+	s.answering = true
+	if rest := strings.TrimLeft(text[i+len(conversationalAnswerMarker):], " "); rest != "" {
+		s.emit(AgentEvent{Type: agentEventToken, Text: rest})
+	}
+}
+
+// nextStep 智能体开始下一步，重置模型输出
+func (s *agentEventStream) nextStep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.output.Reset()
+	s.answering = false
+}
+
+// agentEventHandler 将智能体的回调转换为事件，context 中没有事件接收方时不做任何处理
+type agentEventHandler struct {
+	callbacks.SimpleHandler
+}
+
+// HandleStreamingFunc 转发模型输出的片段
+func (agentEventHandler) HandleStreamingFunc(ctx context.Context, chunk []byte) {
+	if stream := agentEvents(ctx); stream != nil {
+		stream.token(string(chunk))
+	}
+}
+
+// HandleAgentAction 智能体决定调用工具时发送思考内容
+func (agentEventHandler) HandleAgentAction(ctx context.Context, action schema.AgentAction) {
+	stream := agentEvents(ctx)
+	if stream == nil {
+		return
+	}
+	stream.nextStep()
+	thought := action.Log
+	if i := strings.Index(thought, "Action:"); i >= 0 {
+		thought = thought[:i]
+	}
+	thought = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(thought), "Thought:"))
+	if thought != "" {
+		stream.send(AgentEvent{Type: agentEventThought, Text: thought})
+	}
+}
+
+// eventTool 调用工具前后发送事件
+type eventTool struct {
+	tools.Tool
+}
+
+// Call 执行工具并发送开始和结束事件
+func (t eventTool) Call(ctx context.Context, input string) (string, error) {
+	stream := agentEvents(ctx)
+	if stream == nil {
+		return t.Tool.Call(ctx, input)
+	}
+	stream.send(AgentEvent{Type: agentEventToolStart, Tool: t.Name(), Input: input})
+	output, err := t.Tool.Call(ctx, input)
+	stream.send(AgentEvent{Type: agentEventToolEnd, Tool: t.Name(), Output: output, Error: errorString(err)})
+	return output, err
+}
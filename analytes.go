@@ -0,0 +1,289 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// 检测项目标识
+const (
+	analyteUricAcid        = "uric_acid"
+	analyteUrineUricAcid   = "urine_uric_acid"
+	analyteUrineUricAcid24 = "urine_uric_acid_24h"
+	analyteUrinePH         = "urine_ph"
+	analyteCreatinine      = "creatinine"
+	analyteUrineCreatinine = "urine_creatinine"
+	analyteUrineCreat24    = "urine_creatinine_24h"
+	analyteBUN             = "bun"
+	analyteUrea            = "urea"
+	analyteEGFR            = "egfr"
+	analyteCRP             = "crp"
+	analyteHsCRP           = "hs_crp"
+	analyteESR             = "esr"
+	analyteWBC             = "wbc"
+	analyteNeutrophilPct   = "neut_pct"
+)
+
+// 标本类型
+const (
+	specimenSerum = "serum"     // 血清/血浆
+	specimenBlood = "blood"     // 全血
+	specimenUrine = "urine"     // 随机尿
+	specimen24h   = "urine_24h" // 24小时尿
+)
+
+// 检测项目分类，决定结果归入分析报告的哪一部分
+const (
+	categoryUrate        = "urate"
+	categoryInflammation = "inflammation"
+	categoryKidney       = "kidney"
+	categoryUrine        = "urine"
+)
+
+// Analyte 检测项目目录条目
+type Analyte struct {
+	ID            string   `json:"id"`                 // 规范标识，如 uric_acid
+	NameZH        string   `json:"name_zh"`            // 中文名称
+	NameEN        string   `json:"name_en"`            // 英文名称
+	Synonyms      []string `json:"synonyms"`           // 中英文同义名称
+	Abbreviations []string `json:"abbreviations"`      // 常用缩写
+	Specimen      string   `json:"specimen"`           // 标本类型
+	LOINC         string   `json:"loinc"`              // LOINC 编码（对应标准单位）
+	Category      string   `json:"category"`           // 分类
+	Unitless      bool     `json:"unitless,omitempty"` // 无单位项目，如尿 pH
+}
+
+// analyteCatalog 检测项目目录
+var analyteCatalog = []Analyte{
+	{
+		ID: analyteUricAcid, NameZH: "血尿酸", NameEN: "Uric acid",
+		Synonyms:      []string{"尿酸", "血尿酸", "血清尿酸", "uric acid", "serum uric acid", "urate", "serum urate"},
+		Abbreviations: []string{"UA", "SUA"},
+		Specimen:      specimenSerum, LOINC: "14933-6", Category: categoryUrate,
+	},
+	{
+		ID: analyteUrineUricAcid, NameZH: "尿尿酸", NameEN: "Urine uric acid",
+		Synonyms:      []string{"尿尿酸", "尿液尿酸", "尿酸(尿)", "urine uric acid", "urinary uric acid", "urine urate"},
+		Abbreviations: []string{"UUA"},
+		Specimen:      specimenUrine, LOINC: "3087-4", Category: categoryUrine,
+	},
+	{
+		ID: analyteUrineUricAcid24, NameZH: "24小时尿尿酸", NameEN: "24-hour urine uric acid",
+		Synonyms:      []string{"24小时尿尿酸", "24h尿尿酸", "尿酸排泄量", "24-hour urine uric acid", "24h urine uric acid"},
+		Abbreviations: []string{"UUE"},
+		Specimen:      specimen24h, LOINC: "3086-6", Category: categoryUrine,
+	},
+	{
+		ID: analyteUrinePH, NameZH: "尿酸碱度", NameEN: "Urine pH",
+		Synonyms: []string{"尿酸碱度", "尿液酸碱度", "尿ph", "urine ph"},
+		Specimen: specimenUrine, LOINC: "2756-5", Category: categoryUrine, Unitless: true,
+	},
+	{
+		ID: analyteCreatinine, NameZH: "血肌酐", NameEN: "Creatinine",
+		Synonyms:      []string{"肌酐", "血肌酐", "血清肌酐", "creatinine", "serum creatinine"},
+		Abbreviations: []string{"Cr", "Scr", "CREA"},
+		Specimen:      specimenSerum, LOINC: "14682-9", Category: categoryKidney,
+	},
+	{
+		ID: analyteUrineCreatinine, NameZH: "尿肌酐", NameEN: "Urine creatinine",
+		Synonyms:      []string{"尿肌酐", "尿液肌酐", "肌酐(尿)", "urine creatinine", "urinary creatinine"},
+		Abbreviations: []string{"UCr"},
+		Specimen:      specimenUrine, LOINC: "14683-7", Category: categoryUrine,
+	},
+	{
+		ID: analyteUrineCreat24, NameZH: "24小时尿肌酐", NameEN: "24-hour urine creatinine",
+		Synonyms: []string{"24小时尿肌酐", "24h尿肌酐", "24-hour urine creatinine", "24h urine creatinine"},
+		Specimen: specimen24h, LOINC: "2162-6", Category: categoryUrine,
+	},
+	{
+		ID: analyteBUN, NameZH: "尿素氮", NameEN: "Blood urea nitrogen",
+		Synonyms:      []string{"尿素氮", "血尿素氮", "blood urea nitrogen", "urea nitrogen"},
+		Abbreviations: []string{"BUN"},
+		Specimen:      specimenSerum, LOINC: "3094-0", Category: categoryKidney,
+	},
+	{
+		ID: analyteUrea, NameZH: "尿素", NameEN: "Urea",
+		Synonyms:      []string{"尿素", "血尿素", "血清尿素", "urea", "serum urea"},
+		Abbreviations: []string{"UREA"},
+		Specimen:      specimenSerum, LOINC: "3091-6", Category: categoryKidney,
+	},
+	{
+		ID: analyteEGFR, NameZH: "估算肾小球滤过率", NameEN: "Estimated glomerular filtration rate",
+		Synonyms:      []string{"估算肾小球滤过率", "肾小球滤过率", "estimated glomerular filtration rate", "glomerular filtration rate"},
+		Abbreviations: []string{"eGFR", "GFR"},
+		Specimen:      specimenSerum, LOINC: "98979-8", Category: categoryKidney,
+	},
+	{
+		ID: analyteCRP, NameZH: "C反应蛋白", NameEN: "C-reactive protein",
+		Synonyms:      []string{"C反应蛋白", "c-reactive protein"},
+		Abbreviations: []string{"CRP"},
+		Specimen:      specimenSerum, LOINC: "1988-5", Category: categoryInflammation,
+	},
+	{
+		ID: analyteHsCRP, NameZH: "超敏C反应蛋白", NameEN: "High-sensitivity C-reactive protein",
+		Synonyms:      []string{"超敏C反应蛋白", "高敏C反应蛋白", "high-sensitivity c-reactive protein"},
+		Abbreviations: []string{"hs-CRP", "hsCRP"},
+		Specimen:      specimenSerum, LOINC: "30522-7", Category: categoryInflammation,
+	},
+	{
+		ID: analyteESR, NameZH: "血沉", NameEN: "Erythrocyte sedimentation rate",
+		Synonyms:      []string{"血沉", "红细胞沉降率", "erythrocyte sedimentation rate"},
+		Abbreviations: []string{"ESR"},
+		Specimen:      specimenBlood, LOINC: "4537-7", Category: categoryInflammation,
+	},
+	{
+		ID: analyteWBC, NameZH: "白细胞计数", NameEN: "White blood cell count",
+		Synonyms:      []string{"白细胞", "白细胞计数", "white blood cell", "white blood cell count"},
+		Abbreviations: []string{"WBC"},
+		Specimen:      specimenBlood, LOINC: "6690-2", Category: categoryInflammation,
+	},
+	{
+		ID: analyteNeutrophilPct, NameZH: "中性粒细胞百分比", NameEN: "Neutrophils percent",
+		Synonyms:      []string{"中性粒细胞百分比", "中性粒细胞比例", "中性粒细胞%", "neutrophils percent"},
+		Abbreviations: []string{"NEUT%", "NE%", "GRAN%"},
+		Specimen:      specimenBlood, LOINC: "770-8", Category: categoryInflammation,
+	},
+}
+
+// asciiWordChar 判断 ASCII 名称边界时视为单词组成部分的字符
+var asciiWordChar = regexp.MustCompile(`[a-z0-9]`)
+
+// normalizeAnalyteName 统一项目名称写法：小写、全角括号转半角、合并空白
+func normalizeAnalyteName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer("（", "(", "）", ")", "　", " ").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// isASCII 判断名称是否只包含 ASCII 字符
+func isASCII(s string) bool {
+	for _, r := range s {
+		if r > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+// containsTerm 判断项目名称中是否包含某个名称
+// 含中文的名称按子串匹配；纯 ASCII 名称（缩写、英文名）须以完整单词出现，避免 "cr" 命中 "crp"
+func containsTerm(name, term string) bool {
+	if !isASCII(term) {
+		return strings.Contains(name, term)
+	}
+	for offset := 0; offset < len(name); {
+		i := strings.Index(name[offset:], term)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(term)
+		before := start == 0 || !asciiWordChar.MatchString(name[start-1:start])
+		after := end == len(name) || !asciiWordChar.MatchString(name[end:end+1])
+		if before && after {
+			return true
+		}
+		offset = start + 1
+	}
+	return false
+}
+
+// specimenVariants 同一检测项目在不同标本中的对应项目
+var specimenVariants = map[string]map[string]string{
+	analyteUricAcid:        {specimenUrine: analyteUrineUricAcid, specimen24h: analyteUrineUricAcid24},
+	analyteUrineUricAcid:   {specimen24h: analyteUrineUricAcid24},
+	analyteCreatinine:      {specimenUrine: analyteUrineCreatinine, specimen24h: analyteUrineCreat24},
+	analyteUrineCreatinine: {specimen24h: analyteUrineCreat24},
+}
+
+var (
+	// 24小时尿标记，如 "24h"、"24小时"、"24-hour"
+	specimen24hRe = regexp.MustCompile(`24\s*(?:h|hr|小时|-hour|hour)`)
+	// 尿液标本标记，如 "尿"、"(尿)"、"urine"
+	specimenUrineRe = regexp.MustCompile(`尿|urine|urinary`)
+	// 血液标本标记
+	specimenSerumRe = regexp.MustCompile(`血|serum|plasma`)
+)
+
+// detectSpecimen 根据项目名称中检测项目名称以外的部分判断标本类型
+// 如 "24h尿尿酸" 去掉 "尿尿酸" 后剩 "24h"；"尿酸(尿)" 去掉 "尿酸" 后剩 "(尿)"
+func detectSpecimen(rest, fallback string) string {
+	switch {
+	case specimen24hRe.MatchString(rest):
+		return specimen24h
+	case specimenUrineRe.MatchString(rest):
+		if fallback == specimen24h {
+			return specimen24h
+		}
+		return specimenUrine
+	case specimenSerumRe.MatchString(rest):
+		return specimenSerum
+	}
+	return fallback
+}
+
+// matchAnalyte 返回匹配到的最长名称对应的检测项目及该名称
+func matchAnalyte(name string) (Analyte, string, bool) {
+	var best Analyte
+	var bestTerm string
+	bestLen := 0
+	for _, analyte := range analyteCatalog {
+		terms := append(append([]string{}, analyte.Synonyms...), analyte.Abbreviations...)
+		for _, term := range terms {
+			term = normalizeAnalyteName(term)
+			if n := utf8.RuneCountInString(term); n > bestLen && containsTerm(name, term) {
+				best, bestTerm, bestLen = analyte, term, n
+			}
+		}
+	}
+	return best, bestTerm, bestLen > 0
+}
+
+// resolveAnalyte 将化验单上的项目名称解析为目录中的检测项目
+// 取匹配到的最长名称对应的项目，使 "尿尿酸"、"尿酸碱度" 不会被识别为血尿酸，"尿素氮" 不会被识别为尿素；
+// 再根据名称中的标本标记（血/尿/24h尿）换成对应标本的项目
+func resolveAnalyte(parameter string) (Analyte, bool) {
+	name := normalizeAnalyteName(parameter)
+	if name == "" {
+		return Analyte{}, false
+	}
+
+	analyte, term, ok := matchAnalyte(name)
+	if !ok {
+		return Analyte{}, false
+	}
+
+	rest := strings.Replace(name, term, " ", 1)
+	specimen := detectSpecimen(rest, analyte.Specimen)
+	if specimen == analyte.Specimen {
+		return analyte, true
+	}
+	if variant, ok := specimenVariants[analyte.ID][specimen]; ok {
+		return lookupAnalyte(variant)
+	}
+	// 尿液中的血液项目（如 "尿白细胞"）不在目录中，不按血液项目识别
+	if (specimen == specimenUrine || specimen == specimen24h) &&
+		analyte.Specimen != specimenUrine && analyte.Specimen != specimen24h {
+		return Analyte{}, false
+	}
+	return analyte, true
+}
+
+// lookupAnalyte 按规范标识查找检测项目
+func lookupAnalyte(id string) (Analyte, bool) {
+	for _, analyte := range analyteCatalog {
+		if analyte.ID == id {
+			return analyte, true
+		}
+	}
+	return Analyte{}, false
+}
+
+// classifyAnalyte 返回项目名称对应的规范标识，无法识别时返回空串
+func classifyAnalyte(parameter string) string {
+	analyte, ok := resolveAnalyte(parameter)
+	if !ok {
+		return ""
+	}
+	return analyte.ID
+}
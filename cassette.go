@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/tools"
+)
+
+// cassetteVersion 录音文件格式版本
+const cassetteVersion = 1
+
+// 录音中的事件类型
+const (
+	callEventLLM  = "llm"  // 模型调用: 输入为完整提示
+	callEventTool = "tool" // 工具调用
+)
+
+// errCassetteDrift 回放时提示词、工具输入输出或答复与录制时不一致
+var errCassetteDrift = errors.New("回放与录制不一致")
+
+// Cassette 录制的智能体会话，可在相同的智能体配置下回放
+type Cassette struct {
+	Version      int                   `json:"version"`
+	Model        string                `json:"model"`             // 录制时使用的模型
+	Patient      string                `json:"patient,omitempty"` // 录制开始时的当前患者
+	RecordedAt   time.Time             `json:"recorded_at"`       // 录制时间
+	Interactions []CassetteInteraction `json:"interactions"`      // 按顺序记录的提问和命令
+}
+
+// CassetteInteraction 一次提问或改变会话状态的斜杠命令
+type CassetteInteraction struct {
+	Input    string          `json:"input"`            // 用户输入，以 / 开头的为命令
+	Output   string          `json:"output,omitempty"` // 智能体最终答复
+	Error    string          `json:"error,omitempty"`  // 智能体返回的错误
+	Events   []CassetteEvent `json:"events,omitempty"` // 模型和工具调用
+	Duration Duration        `json:"duration"`         // 总耗时
+}
+
+// CassetteEvent 一次模型或工具调用
+type CassetteEvent struct {
+	Type     string   `json:"type"`            // llm/tool
+	Tool     string   `json:"tool,omitempty"`  // 工具名称
+	Input    string   `json:"input"`           // 模型提示或工具输入
+	Output   string   `json:"output"`          // 模型输出或工具结果
+	Error    string   `json:"error,omitempty"` // 调用返回的错误
+	Duration Duration `json:"duration"`        // 耗时
+}
+
+// LoadCassette 读取录音文件
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取录音文件失败: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("解析录音文件 %s 失败: %w", path, err)
+	}
+	if c.Version != cassetteVersion {
+		return nil, fmt.Errorf("录音文件 %s 版本为 %d，当前支持版本 %d", path, c.Version, cassetteVersion)
+	}
+	return &c, nil
+}
+
+// Save 写入录音文件
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// cassetteRecorder 录制或回放会话中的模型和工具调用
+// 录制时透传给真实模型和工具并记录；回放时模型输出取自录音，工具照常执行，
+// 提示词、工具输入输出或最终答复与录音不一致时返回 errCassetteDrift。
+type cassetteRecorder struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	replay   bool
+	path     string // 录制时每次提问后保存到该文件
+
+	current *CassetteInteraction // 正在进行的提问
+	next    int                  // 回放: 下一条提问的下标
+	pending []CassetteEvent      // 回放: 当前提问中尚未回放的事件
+	drift   error                // 回放: 第一处不一致
+	started time.Time
+}
+
+// newCassetteRecording 录制会话到 path
+func newCassetteRecording(path, model string) *cassetteRecorder {
+	return &cassetteRecorder{
+		cassette: &Cassette{Version: cassetteVersion, Model: model, RecordedAt: time.Now(), Interactions: []CassetteInteraction{}},
+		path:     path,
+	}
+}
+
+// newCassetteReplay 按录音回放会话
+func newCassetteReplay(c *Cassette) *cassetteRecorder {
+	return &cassetteRecorder{cassette: c, replay: true}
+}
+
+// begin 开始一次提问
+func (r *cassetteRecorder) begin(input string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = time.Now()
+	if !r.replay {
+		r.current = &CassetteInteraction{Input: input}
+		return nil
+	}
+
+	if r.next >= len(r.cassette.Interactions) {
+		return r.driftf("录音中没有第 %d 次提问", r.next+1)
+	}
+	r.current = &r.cassette.Interactions[r.next]
+	r.next++
+	r.pending = r.current.Events
+	if r.current.Input != input {
+		return r.driftf("第 %d 次提问不一致\n%s", r.next, firstDifference(r.current.Input, input))
+	}
+	return nil
+}
+
+// end 结束一次提问，录制时保存录音，回放时检查答复是否一致
+func (r *cassetteRecorder) end(output string, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current := r.current
+	r.current = nil
+	if current == nil {
+		return nil
+	}
+	if !r.replay {
+		current.Output = output
+		if err != nil {
+			current.Error = err.Error()
+		}
+		current.Duration = Duration(time.Since(r.started))
+		r.cassette.Interactions = append(r.cassette.Interactions, *current)
+		return r.cassette.Save(r.path)
+	}
+
+	if r.drift != nil {
+		return r.drift
+	}
+	if len(r.pending) > 0 {
+		return r.driftf("第 %d 次提问少了 %d 次调用，下一次应为 %s", r.next, len(r.pending), describeEvent(r.pending[0]))
+	}
+	if current.Output != output {
+		return r.driftf("第 %d 次提问的答复不一致\n%s", r.next, firstDifference(current.Output, output))
+	}
+	if got := errorString(err); current.Error != got {
+		return r.driftf("第 %d 次提问的错误不一致\n%s", r.next, firstDifference(current.Error, got))
+	}
+	return nil
+}
+
+// discard 放弃正在进行的提问，如用户取消了分析
+func (r *cassetteRecorder) discard() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = nil
+}
+
+// command 录制改变会话状态的斜杠命令，回放时按原顺序执行
+func (r *cassetteRecorder) command(input string) error {
+	if err := r.begin(input); err != nil {
+		return err
+	}
+	return r.end("", nil)
+}
+
+// event 录制一次调用，或在回放时取出下一条录制的调用并检查是否一致
+func (r *cassetteRecorder) event(got CassetteEvent, compareOutput bool) (CassetteEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current == nil {
+		// 不属于任何提问的调用不录制
+		return got, nil
+	}
+	if !r.replay {
+		r.current.Events = append(r.current.Events, got)
+		return got, nil
+	}
+
+	step := len(r.current.Events) - len(r.pending) + 1
+	if len(r.pending) == 0 {
+		return got, r.driftf("第 %d 次提问多出了第 %d 次调用: %s", r.next, step, describeEvent(got))
+	}
+	want := r.pending[0]
+	r.pending = r.pending[1:]
+	switch {
+	case want.Type != got.Type || want.Tool != got.Tool:
+		return want, r.driftf("第 %d 次提问的第 %d 次调用应为 %s，实际为 %s", r.next, step, describeEvent(want), describeEvent(got))
+	case want.Input != got.Input:
+		return want, r.driftf("第 %d 次提问的第 %d 次调用 (%s) 输入不一致\n%s", r.next, step, describeEvent(want), firstDifference(want.Input, got.Input))
+	case compareOutput && (want.Output != got.Output || want.Error != got.Error):
+		return want, r.driftf("第 %d 次提问的第 %d 次调用 (%s) 结果不一致\n%s", r.next, step, describeEvent(want),
+			firstDifference(want.Output+want.Error, got.Output+got.Error))
+	}
+	return want, nil
+}
+
+// driftf 记录第一处不一致并返回错误，调用方需持有锁
+func (r *cassetteRecorder) driftf(format string, args ...any) error {
+	err := fmt.Errorf("%w: %s", errCassetteDrift, fmt.Sprintf(format, args...))
+	if r.drift == nil {
+		r.drift = err
+	}
+	return err
+}
+
+// model 包装模型: 录制时记录提示和输出，回放时返回录制的输出
+func (r *cassetteRecorder) model(llm llms.Model) llms.Model {
+	return &cassetteModel{llm: llm, recorder: r}
+}
+
+// tool 包装工具，记录工具输入、结果和耗时
+func (r *cassetteRecorder) tool(t tools.Tool) tools.Tool {
+	return &cassetteTool{Tool: t, recorder: r}
+}
+
+// cassetteModel 经录音机调用的模型
+type cassetteModel struct {
+	llm      llms.Model
+	recorder *cassetteRecorder
+}
+
+// GenerateContent 录制或回放一次模型调用
+func (m *cassetteModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	prompt := promptText(messages)
+
+	if m.recorder.replay {
+		event, err := m.recorder.event(CassetteEvent{Type: callEventLLM, Input: prompt}, false)
+		if err != nil {
+			return nil, err
+		}
+		if event.Error != "" {
+			return nil, errors.New(event.Error)
+		}
+		opts := llms.CallOptions{}
+		for _, opt := range options {
+			opt(&opts)
+		}
+		if opts.StreamingFunc != nil {
+			if err := opts.StreamingFunc(ctx, []byte(event.Output)); err != nil {
+				return nil, err
+			}
+		}
+		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: event.Output}}}, nil
+	}
+
+	start := time.Now()
+	resp, err := m.llm.GenerateContent(ctx, messages, options...)
+	event := CassetteEvent{Type: callEventLLM, Input: prompt, Error: errorString(err), Duration: Duration(time.Since(start))}
+	if err == nil && len(resp.Choices) > 0 {
+		event.Output = resp.Choices[0].Content
+	}
+	m.recorder.event(event, false)
+	return resp, err
+}
+
+// Call 以单条提示调用模型
+func (m *cassetteModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// cassetteTool 经录音机调用的工具，回放时照常执行并检查结果是否一致
+type cassetteTool struct {
+	tools.Tool
+	recorder *cassetteRecorder
+}
+
+// Call 执行工具并录制或检查结果
+func (t *cassetteTool) Call(ctx context.Context, input string) (string, error) {
+	start := time.Now()
+	output, err := t.Tool.Call(ctx, input)
+	event := CassetteEvent{Type: callEventTool, Tool: t.Name(), Input: input, Output: output, Error: errorString(err), Duration: Duration(time.Since(start))}
+	if _, driftErr := t.recorder.event(event, true); driftErr != nil {
+		return "", driftErr
+	}
+	return output, err
+}
+
+// promptText 拼接消息中的文本，作为录音中的模型提示
+func promptText(messages []llms.MessageContent) string {
+	var b strings.Builder
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				b.WriteString(text.Text)
+			}
+		}
+	}
+	return b.String()
+}
+
+// describeEvent 返回便于阅读的调用描述
+func describeEvent(e CassetteEvent) string {
+	if e.Type == callEventTool {
+		return "工具 " + e.Tool
+	}
+	return "模型"
+}
+
+// firstDifference 指出两段文本第一处不同的行
+func firstDifference(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g || i >= len(wantLines) || i >= len(gotLines) {
+			return fmt.Sprintf("  第 %d 行\n  录制: %q\n  当前: %q", i+1, w, g)
+		}
+	}
+	return "  内容相同"
+}
+
+// errorString 返回错误信息，err 为 nil 时返回空串
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// runReplayCommand 处理 replay 子命令
+// 回放使用与交互模式相同的规则文件和知识库，录音中的模型输出代替真实模型；
+// 患者数据复制到内存患者库，回放中保存的化验记录和切换的当前患者不写入患者库文件
+func runReplayCommand(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("用法: replay <录音文件>")
+	}
+	cassette, err := LoadCassette(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	rules, err := loadRuleEngine()
+	if err != nil {
+		return err
+	}
+	// 知识库内容变化时工具结果不同，回放会报告差异
+	knowledge, err := loadKnowledgeBase()
+	if err != nil {
+		return err
+	}
+	patients, err := replayPatientStore(os.Getenv(patientDBEnv), cassette)
+	if err != nil {
+		return err
+	}
+	defer patients.Close()
+
+	guidelines, err := loadGuidelines(io.Discard)
+	if err != nil {
+		return err
+	}
+
+	s, err := newSession(nil, rules, knowledge, patients, io.Discard)
+	if err != nil {
+		return err
+	}
+	if guidelines != nil {
+		s.setGuidelines(guidelines)
+	}
+	fmt.Printf("▶️  回放 %s: 录制于 %s，模型 %s，共 %d 次提问\n", flags.Arg(0),
+		cassette.RecordedAt.Format("2006-01-02 15:04:05"), cassette.Model, len(cassette.Interactions))
+	if err := replayCassette(context.Background(), s, cassette, os.Stdout); err != nil {
+		return err
+	}
+	fmt.Println("✅ 回放完成，提示词、工具调用和答复均与录制时一致")
+	return nil
+}
+
+// replayPatientStore 创建回放使用的内存患者库，从患者库文件只读复制录音涉及的患者
+// 涉及的患者包括录制开始时的当前患者、/patient 命令切换到的患者和化验单中患者编号行指定的患者；
+// 只复制录制当天及之前的发作和化验，录制后新增的记录不影响回放结果
+func replayPatientStore(path string, c *Cassette) (*PatientStore, error) {
+	store, err := OpenMemoryPatientStore()
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if c.Patient != "" {
+		ids = append(ids, c.Patient)
+	}
+	for _, interaction := range c.Interactions {
+		if fields := strings.Fields(interaction.Input); len(fields) == 2 && fields[0] == "/patient" {
+			ids = append(ids, fields[1])
+		}
+		for _, line := range strings.Split(interaction.Input, "\n") {
+			if m := patientIDLineRe.FindStringSubmatch(line); m != nil {
+				ids = append(ids, m[1])
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return store, nil
+	}
+
+	src, err := openPatientStoreReadOnly(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	defer src.Close()
+	copied := make(map[string]bool)
+	for _, id := range ids {
+		if copied[id] {
+			continue
+		}
+		copied[id] = true
+		if err := store.copyPatient(src, id, c.RecordedAt); err != nil && !errors.Is(err, errPatientNotFound) {
+			store.Close()
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// replayCassette 在会话中按顺序回放录音，返回第一处不一致
+func replayCassette(ctx context.Context, s *session, c *Cassette, out io.Writer) error {
+	// 恢复录制开始时的当前患者，不修改患者库中的当前患者设置
+	if c.Patient != "" {
+		if s.patients == nil {
+			return fmt.Errorf("录音使用了患者 %s，但未配置患者库", c.Patient)
+		}
+		profile, err := s.patients.GetPatient(c.Patient)
+		if err != nil {
+			return err
+		}
+		s.setPatient(profile)
+	} else if s.patient != nil {
+		s.setPatient(nil)
+	}
+	s.setRecorder(newCassetteReplay(c))
+
+	for i, interaction := range c.Interactions {
+		start := time.Now()
+		var err error
+		if strings.HasPrefix(interaction.Input, "/") {
+			err = s.command(ctx, interaction.Input)
+		} else {
+			_, err = s.ask(ctx, interaction.Input)
+		}
+		title := firstLine(interaction.Input)
+		if errors.Is(err, errCassetteDrift) {
+			fmt.Fprintf(out, "❌ %d. %s\n", i+1, title)
+			return err
+		}
+		if err != nil && interaction.Error == "" {
+			fmt.Fprintf(out, "❌ %d. %s\n", i+1, title)
+			return err
+		}
+		fmt.Fprintf(out, "✅ %d. %s (录制 %s，回放 %s)\n", i+1, title,
+			time.Duration(interaction.Duration).Round(time.Millisecond), time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// firstLine 返回文本的第一行，多行时附加省略号
+func firstLine(text string) string {
+	if i := strings.Index(text, "\n"); i >= 0 {
+		return text[:i] + " …"
+	}
+	return text
+}
@@ -4,47 +4,44 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 
 	"github.com/tmc/langchaingo/agents"
 	"github.com/tmc/langchaingo/chains"
-	"github.com/tmc/langchaingo/llms/openai"
+	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/memory"
 	"github.com/tmc/langchaingo/tools"
 )
 
 // 完整的使用示例
-func runDemo() {
-	// 检查是否有阿里百炼 API Key
-	if os.Getenv("DASHSCOPE_API_KEY") == "" {
-		fmt.Println("⚠️  请设置 DASHSCOPE_API_KEY 环境变量")
-		fmt.Println("   export DASHSCOPE_API_KEY=\"your-dashscope-api-key\"")
+func runDemo(args []string) {
+	// 按配置初始化模型
+	llm, cfg, err := setupLLM("demo", args)
+	if err != nil {
+		fmt.Printf("⚠️  %v\n", err)
 		return
 	}
 
 	// 运行演示
-	if err := runGoutAgentDemo(); err != nil {
+	if err := runGoutAgentDemo(llm, cfg); err != nil {
 		log.Fatalf("演示运行失败: %v", err)
 	}
 }
 
-func runGoutAgentDemo() error {
-	fmt.Println("🩺 痛风化验单分析智能体演示 (Powered by 阿里百炼 Qwen-plus)")
+func runGoutAgentDemo(llm llms.Model, cfg LLMConfig) error {
+	fmt.Println("🩺 痛风化验单分析智能体演示")
+	fmt.Printf("🤖 模型: %s\n", cfg)
 	fmt.Println("═══════════════════════════════════════")
 
-	// 1. 初始化阿里百炼 Qwen LLM
-	llm, err := openai.New(
-		openai.WithBaseURL("https://dashscope.aliyuncs.com/compatible-mode/v1"),
-		openai.WithModel("qwen-plus"),
-		openai.WithToken(os.Getenv("DASHSCOPE_API_KEY")),
-	)
+	// 2. 创建专用工具
+	medicalKnowledge, err := loadKnowledgeBase()
 	if err != nil {
-		return fmt.Errorf("初始化阿里百炼 Qwen LLM失败: %w", err)
+		return err
 	}
-
-	// 2. 创建专用工具
-	goutAnalyzer := GoutLabAnalyzer{}
-	medicalKnowledge := NewMedicalKnowledgeBase()
+	rules, err := loadRuleEngine()
+	if err != nil {
+		return err
+	}
+	goutAnalyzer := GoutLabAnalyzer{Rules: rules, Knowledge: medicalKnowledge}
 
 	agentTools := []tools.Tool{
 		goutAnalyzer,
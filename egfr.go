@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// creatinineUmolPerMgDL 肌酐 1 mg/dL = 88.4 μmol/L，估算公式均使用 mg/dL
+const creatinineUmolPerMgDL = 88.4
+
+// ckdThreshold 慢性肾病界值 eGFR<60 mL/min/1.73m²，与知识库肾功能条目一致
+const ckdThreshold = 60.0
+
+// equationCKDEPI2021 计算 eGFR 所用公式
+const equationCKDEPI2021 = "CKD-EPI 2021"
+
+// kdigoStage KDIGO 肾小球滤过率分期
+type kdigoStage struct {
+	Stage       string
+	Min         float64
+	Description string
+}
+
+// kdigoStages 按下限从高到低排列
+var kdigoStages = []kdigoStage{
+	{"G1", 90, "正常或升高"},
+	{"G2", 60, "轻度下降"},
+	{"G3a", 45, "轻到中度下降"},
+	{"G3b", 30, "中到重度下降"},
+	{"G4", 15, "重度下降"},
+	{"G5", 0, "肾衰竭"},
+}
+
+// RenalAssessment 肾功能评估
+type RenalAssessment struct {
+	EGFR             *float64 `json:"egfr,omitempty"`              // 用于分期的 eGFR (mL/min/1.73m²)，缺少性别或年龄等无法估算时为空
+	EGFRSource       string   `json:"egfr_source,omitempty"`       // 化验单报告值或计算公式
+	Stage            string   `json:"stage,omitempty"`             // KDIGO 分期 G1-G5
+	StageDescription string   `json:"stage_description,omitempty"` // 分期说明
+	MDRD             float64  `json:"mdrd,omitempty"`              // MDRD 估算 eGFR (mL/min/1.73m²)
+	CockcroftGault   float64  `json:"cockcroft_gault,omitempty"`   // Cockcroft-Gault 肌酐清除率 (mL/min)
+	Notes            []string `json:"notes,omitempty"`             // 说明
+}
+
+// classifyKDIGO 返回 eGFR 对应的 KDIGO 分期
+func classifyKDIGO(egfr float64) kdigoStage {
+	for _, stage := range kdigoStages {
+		if egfr >= stage.Min {
+			return stage
+		}
+	}
+	return kdigoStages[len(kdigoStages)-1]
+}
+
+// ckdEPI2021 按 CKD-EPI 2021（不含种族系数）估算 eGFR
+func ckdEPI2021(scrMgDL float64, age int, female bool) float64 {
+	kappa, alpha, sexFactor := 0.9, -0.302, 1.0
+	if female {
+		kappa, alpha, sexFactor = 0.7, -0.241, 1.012
+	}
+	ratio := scrMgDL / kappa
+	return 142 * math.Pow(math.Min(ratio, 1), alpha) * math.Pow(math.Max(ratio, 1), -1.200) *
+		math.Pow(0.9938, float64(age)) * sexFactor
+}
+
+// mdrd 按 IDMS 校正的 4 变量 MDRD 公式估算 eGFR（不含种族系数）
+func mdrd(scrMgDL float64, age int, female bool) float64 {
+	egfr := 175 * math.Pow(scrMgDL, -1.154) * math.Pow(float64(age), -0.203)
+	if female {
+		egfr *= 0.742
+	}
+	return egfr
+}
+
+// cockcroftGault 按 Cockcroft-Gault 公式估算肌酐清除率 (mL/min)
+func cockcroftGault(scrMgDL float64, age int, weightKg float64, female bool) float64 {
+	crcl := float64(140-age) * weightKg / (72 * scrMgDL)
+	if female {
+		crcl *= 0.85
+	}
+	return crcl
+}
+
+// assessRenalFunction 根据血肌酐和患者信息估算 eGFR 并进行 KDIGO 分期
+// 化验单已报告 eGFR 时以报告值分期；否则按 CKD-EPI 2021 计算，并作为计算所得的结果追加到 results
+// includeAlternates 为 true 时同时给出 MDRD 和（已知体重时）Cockcroft-Gault 估算值
+func assessRenalFunction(results []LabResult, patient PatientContext, includeAlternates bool) ([]LabResult, *RenalAssessment) {
+	var creatinine, reported *LabResult
+	for i := range results {
+		if results[i].Status == statusUnknownUnit {
+			continue
+		}
+		switch results[i].AnalyteID {
+		case analyteCreatinine:
+			creatinine = &results[i]
+		case analyteEGFR:
+			reported = &results[i]
+		}
+	}
+	if creatinine == nil && reported == nil {
+		return results, nil
+	}
+
+	assessment := &RenalAssessment{}
+	female := patient.Sex == sexFemale || patient.IsPregnant()
+	canEstimate := creatinine != nil && creatinine.Value > 0 && patient.Sex != "" && patient.Age > 0 && !patient.Pediatric
+
+	if creatinine != nil && !canEstimate {
+		switch {
+		case patient.Pediatric:
+			assessment.Notes = append(assessment.Notes, "CKD-EPI 公式不适用于18岁以下患者，未计算 eGFR")
+		case patient.Sex == "" || patient.Age == 0:
+			assessment.Notes = append(assessment.Notes, "计算 eGFR 需提供性别和年龄")
+		}
+	}
+
+	if canEstimate {
+		scr := creatinine.Value / creatinineUmolPerMgDL
+		if includeAlternates {
+			assessment.MDRD = roundValue(mdrd(scr, patient.Age, female))
+			if patient.WeightKg > 0 {
+				assessment.CockcroftGault = roundValue(cockcroftGault(scr, patient.Age, patient.WeightKg, female))
+			} else {
+				assessment.Notes = append(assessment.Notes, "计算 Cockcroft-Gault 肌酐清除率需提供体重")
+			}
+		}
+
+		if reported == nil {
+			egfr := roundValue(ckdEPI2021(scr, patient.Age, female))
+			derived := LabResult{
+				Parameter:     fmt.Sprintf("eGFR (%s)", equationCKDEPI2021),
+				AnalyteID:     analyteEGFR,
+				Specimen:      specimenSerum,
+				Value:         egfr,
+				Unit:          "mL/min/1.73m²",
+				OriginalValue: egfr,
+				OriginalUnit:  "mL/min/1.73m²",
+				ReferenceMin:  90,
+				Computed:      true,
+			}
+			derived.Status = "正常"
+			if egfr < derived.ReferenceMin {
+				derived.Status = "偏低"
+			}
+			results = append(results, derived)
+			assessment.EGFR = &egfr
+			assessment.EGFRSource = equationCKDEPI2021
+		}
+	}
+
+	if reported != nil {
+		egfr := reported.Value
+		assessment.EGFR = &egfr
+		assessment.EGFRSource = "化验单报告值"
+	}
+	if assessment.EGFR == nil {
+		return results, assessment
+	}
+
+	stage := classifyKDIGO(*assessment.EGFR)
+	assessment.Stage = stage.Stage
+	assessment.StageDescription = stage.Description
+	return results, assessment
+}
+
+// renalAdvice 根据 KDIGO 分期给出肾功能相关建议
+func renalAdvice(assessment *RenalAssessment) []string {
+	if assessment == nil || assessment.Stage == "" {
+		return nil
+	}
+
+	switch assessment.Stage {
+	case "G3a", "G3b":
+		return []string{
+			fmt.Sprintf("eGFR %.0f mL/min/1.73m²（KDIGO %s，%s），降尿酸药物需按肾功能调整剂量", *assessment.EGFR, assessment.Stage, assessment.StageDescription),
+		}
+	case "G4", "G5":
+		return []string{
+			fmt.Sprintf("eGFR %.0f mL/min/1.73m²（KDIGO %s，%s），建议肾内科就诊", *assessment.EGFR, assessment.Stage, assessment.StageDescription),
+			"eGFR<30 时避免使用苯溴马隆，别嘌醇等药物需严格按肾功能减量，并避免使用 NSAIDs",
+		}
+	}
+	return nil
+}
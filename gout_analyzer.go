@@ -3,27 +3,91 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tmc/langchaingo/callbacks"
 )
 
 // GoutLabAnalyzer 痛风化验单分析工具
 type GoutLabAnalyzer struct {
-	CallbacksHandler callbacks.Handler
+	CallbacksHandler     callbacks.Handler
+	Patient              PatientContext          // 默认患者信息，输入中的患者信息行会覆盖对应字段
+	ReferenceRanges      *ReferenceRangeRegistry // 参考范围登记表，为空时使用 Knowledge 的默认范围
+	Knowledge            *MedicalKnowledgeBase   // 医学知识库，默认参考范围和降尿酸目标取自该知识库，为空时使用内置知识库
+	Site                 string                  // 默认检验机构，用于选择机构登记的参考范围，输入中的检验机构行会覆盖
+	RequireUricAcid      bool                    // 严格模式：未识别到血尿酸时直接返回错误，不保存化验历史
+	IncludeAlternateEGFR bool                    // 同时给出 MDRD 和 Cockcroft-Gault 估算值，患者信息含体重时自动启用
+	Rules                *RuleEngine             // 风险评估规则，为空时使用内置规则
+	History              LabHistoryStore         // 化验历史存储，已绑定患者或输入中含患者编号时保存各次化验结果
+	PatientID            string                  // 分析器绑定的患者编号，设置后输入中的患者编号须与之一致
+	ReportDate           time.Time               // 不含日期行的化验单保存到化验历史时使用的日期，为零时取分析当天
 }
 
 // LabResult 化验结果结构
 type LabResult struct {
-	Parameter    string  `json:"parameter"`    // 检测项目名称
-	Value        float64 `json:"value"`        // 检测值
-	Unit         string  `json:"unit"`         // 单位
-	ReferenceMin float64 `json:"reference_min"` // 参考值下限
-	ReferenceMax float64 `json:"reference_max"` // 参考值上限
-	Status       string  `json:"status"`       // 正常/偏高/偏低
+	Parameter     string  `json:"parameter"`      // 检测项目名称
+	AnalyteID     string  `json:"analyte_id"`     // 检测项目规范标识，见 analyteCatalog
+	Specimen      string  `json:"specimen"`       // 标本类型: serum/blood/urine/urine_24h
+	Value         float64 `json:"value"`          // 检测值（已换算为标准单位）
+	Unit          string  `json:"unit"`           // 单位（标准单位）
+	OriginalValue float64 `json:"original_value"` // 化验单原始数值
+	OriginalUnit  string  `json:"original_unit"`  // 化验单原始单位
+	ReferenceMin  float64 `json:"reference_min"`  // 参考值下限
+	ReferenceMax  float64 `json:"reference_max"`  // 参考值上限
+	Status        string  `json:"status"`         // 正常/偏高/偏低/单位未知
+
+	DefaultReference bool   `json:"default_reference,omitempty"` // 化验单未给出参考范围，使用了登记表中的默认范围
+	ReferenceSource  string `json:"reference_source,omitempty"`  // 默认参考范围的来源
+	Computed         bool   `json:"computed,omitempty"`          // 由其他结果计算所得（如 eGFR），非化验单原始数据
+}
+
+// statusUnknownUnit 单位无法识别时的状态，此类结果不参与风险评估
+const statusUnknownUnit = "单位未知"
+
+// riskUnassessable 未识别到血尿酸时的风险等级
+const riskUnassessable = "无法评估"
+
+// errNoUricAcid 严格模式下未识别到血尿酸时返回的错误
+var errNoUricAcid = errors.New("未识别到血尿酸结果，无法评估痛风风险")
+
+// 跳过原因
+const (
+	skipNoValue              = "未找到数值"
+	skipUnknownUnit          = "单位无法识别"
+	skipUnknownAnalyte       = "未识别的检测项目"
+	skipConflictingDuplicate = "重复项目数值冲突"
+	skipDuplicate            = "重复项目"
+)
+
+// SkippedLine 未参与评估的输入行
+type SkippedLine struct {
+	LineNumber int    `json:"line_number"`      // 行号（从1开始）
+	Line       string `json:"line"`             // 原始内容
+	Reason     string `json:"reason"`           // 跳过原因
+	Detail     string `json:"detail,omitempty"` // 补充说明
+}
+
+// ParseReport 化验单解析报告
+type ParseReport struct {
+	TotalLines   int           `json:"total_lines"`   // 非空化验数据行数（不含患者信息行）
+	ParsedLines  int           `json:"parsed_lines"`  // 成功解析并参与评估的行数
+	Coverage     float64       `json:"coverage"`      // 解析覆盖率 parsed_lines/total_lines
+	SkippedLines []SkippedLine `json:"skipped_lines"` // 跳过的行及原因
+}
+
+// skip 记录一条跳过的输入行
+func (r *ParseReport) skip(lineNumber int, line, reason, detail string) {
+	r.SkippedLines = append(r.SkippedLines, SkippedLine{
+		LineNumber: lineNumber,
+		Line:       line,
+		Reason:     reason,
+		Detail:     detail,
+	})
 }
 
 // GoutAnalysisResult 痛风分析结果
@@ -31,9 +95,17 @@ type GoutAnalysisResult struct {
 	UricAcidLevel    *LabResult   `json:"uric_acid_level"`    // 尿酸水平
 	InflammatoryMarkers []LabResult `json:"inflammatory_markers"` // 炎症指标
 	KidneyFunction   []LabResult  `json:"kidney_function"`    // 肾功能指标
-	RiskLevel        string       `json:"risk_level"`         // 风险等级: 低风险/中风险/高风险
+	RiskLevel        string       `json:"risk_level"`         // 风险等级: 低风险/中风险/高风险/无法评估
 	Recommendations  []string     `json:"recommendations"`    // 建议
 	FollowUpNeeded   bool         `json:"follow_up_needed"`   // 是否需要随访
+	OtherResults     []LabResult  `json:"other_results,omitempty"`    // 已识别但不参与风险评估的项目，如尿液检查
+	UrateExcretion   *UrateExcretionAnalysis `json:"urate_excretion,omitempty"` // 尿酸排泄分析（提供尿液尿酸时）
+	RenalAssessment  *RenalAssessment `json:"renal_assessment,omitempty"` // eGFR 估算及 KDIGO 分期
+	UnscoredResults  []LabResult  `json:"unscored_results,omitempty"` // 单位无法识别、未参与评估的项目
+	Patient          *PatientContext `json:"patient,omitempty"`        // 评估所用的患者信息
+	ParseReport      ParseReport  `json:"parse_report"`       // 化验单解析报告
+	RuleTrace        []RuleTrace  `json:"rule_trace"`         // 已触发的评估规则，说明风险等级的依据
+	UrateTrend       *UrateTrend  `json:"urate_trend,omitempty"` // 血尿酸变化趋势（提供多次带日期的化验结果时）
 }
 
 // Name 返回工具名称
@@ -47,7 +119,19 @@ func (g GoutLabAnalyzer) Description() string {
 输入格式应包含化验项目名称、数值、单位和参考范围，例如：
 "尿酸 520 umol/L (参考范围: 208-428)"
 "C反应蛋白 15.2 mg/L (参考范围: <3.0)"
-该工具会分析各项指标，评估痛风风险，并提供相应的医学建议。`
+多项结果写在同一行时以分号分隔，例如 "尿酸 520 umol/L；肌酐 95 umol/L"。
+如有尿液检查（尿尿酸、尿肌酐、24小时尿尿酸），会计算尿酸排泄量和尿酸排泄分数(FEUA)并给出排泄分型。
+可附加患者信息行以按性别、年龄评估，例如 "性别: 男"、"年龄: 45岁"、"体重: 70kg"、"妊娠: 是"；
+提供性别和年龄时会根据血肌酐按 CKD-EPI 2021 估算 eGFR 并给出 KDIGO 分期；
+同时提供体重时另给出 MDRD 估算值和 Cockcroft-Gault 肌酐清除率（用于按肾功能调整药物剂量）。
+化验单注明检验机构时可附加 "检验机构: 某某医院"，缺少参考范围的项目优先使用该机构登记的参考范围。
+支持 μmol/L、mg/dL 等常用单位，会自动换算为标准单位后再评估。
+该工具会分析各项指标，评估痛风风险，并提供相应的医学建议。
+结果中的 parse_report 列出未能解析的行及原因；未识别到血尿酸时风险等级为"无法评估"。
+rule_trace 列出触发的评估规则、所用化验结果、比较阈值及其对风险等级的贡献，可用于解释风险等级的依据。
+输入包含多份带日期的化验单（每份以 "日期: 2024-01-10" 开头）时，按最近一次化验评估风险，
+并在 urate_trend 中给出血尿酸变化趋势；附加 "患者编号: P001" 或已设置当前患者时会保存并结合该患者以往的化验记录，
+未注明日期的化验单记为当天的化验。`
 }
 
 // Call 执行化验单分析
@@ -56,15 +140,14 @@ func (g GoutLabAnalyzer) Call(ctx context.Context, input string) (string, error)
 		g.CallbacksHandler.HandleToolStart(ctx, input)
 	}
 
-	// 解析输入的化验单数据
-	labResults, err := g.parseLabInput(input)
+	analysis, err := g.Analyze(input)
+	if errors.Is(err, errNoUricAcid) {
+		return "", err
+	}
 	if err != nil {
-		return fmt.Sprintf("解析化验单数据时出错: %v", err), nil
+		return err.Error(), nil
 	}
 
-	// 分析化验结果
-	analysis := g.analyzeGoutRisk(labResults)
-
 	// 格式化输出结果
 	result, err := json.MarshalIndent(analysis, "", "  ")
 	if err != nil {
@@ -78,67 +161,215 @@ func (g GoutLabAnalyzer) Call(ctx context.Context, input string) (string, error)
 	return string(result), nil
 }
 
-// parseLabInput 解析化验单输入数据
-func (g *GoutLabAnalyzer) parseLabInput(input string) ([]LabResult, error) {
+// Analyze 解析并分析化验单，返回结构化的分析结果，不经过大模型
+func (g GoutLabAnalyzer) Analyze(input string) (*GoutAnalysisResult, error) {
+	// 按日期拆分多次化验，风险评估使用最近一次化验
+	patient, history, err := g.prepareInput(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析输入的化验单数据
+	labResults, report, err := g.parseLabInput(history.latest(), patient)
+	if err != nil {
+		return nil, fmt.Errorf("解析化验单数据时出错: %w", err)
+	}
+
+	// 分析化验结果，严格模式下未识别到血尿酸时在保存化验历史之前返回
+	analysis := g.analyzeGoutRisk(labResults, patient)
+	if analysis.UricAcidLevel == nil && g.RequireUricAcid {
+		return nil, errNoUricAcid
+	}
+	analysis.ParseReport = report
+	if len(history.Sections) > 0 || g.historyPatientID(history) != "" {
+		reports, err := g.labHistory(history, patient)
+		if err != nil {
+			return nil, fmt.Errorf("读取化验历史时出错: %w", err)
+		}
+		analysis.UrateTrend = analyzeUrateTrend(reports, patient, g.targets())
+	}
+	return &analysis, nil
+}
+
+var (
+	// 化验项目行: 项目名称与数值之间以空白或冒号分隔，项目名称可含数字，如 "24h尿尿酸 3.6 mmol/24h"
+	labValueRe = regexp.MustCompile(`^(.+?)[\s:：]+([0-9]+(?:\.[0-9]+)?)(.*)$`)
+	// 紧凑写法: 项目名称后直接跟数值，如 "尿酸520umol/L"
+	labValueCompactRe = regexp.MustCompile(`^([^0-9]+?)\s*([0-9]+(?:\.[0-9]+)?)(.*)$`)
+	// 不含数字、以冒号结尾的标题行，如 "患者化验单数据:"，不计入解析统计
+	sectionHeaderRe = regexp.MustCompile(`^[^0-9]*[：:]$`)
+	// 参考范围，如 "(参考范围: 208-428)"、"(3.5-7.2)"、"(<3.0)"
+	referenceRe = regexp.MustCompile(`(?:(?:参考范围?|参考值)?[：:]?\s*[（(]?\s*([<>＜＞≤≥]?)([0-9]+\.?[0-9]*)\s*[-~～至]\s*([0-9]+\.?[0-9]*))|[（(]?\s*([<>＜＞≤≥])\s*([0-9]+\.?[0-9]*)`)
+)
+
+// parseLabInput 解析化验单输入数据，未能解析的行记录在解析报告中
+func (g *GoutLabAnalyzer) parseLabInput(input string, patient PatientContext) ([]LabResult, ParseReport, error) {
 	var results []LabResult
+	report := ParseReport{SkippedLines: []SkippedLine{}}
+	seen := make(map[string]int) // 检测项目 -> results 下标
 	lines := strings.Split(input, "\n")
 
-	// 正则表达式匹配化验项目格式
-	// 匹配格式如: "尿酸 520 umol/L (参考范围: 208-428)" 或 "C反应蛋白 15.2 mg/L (<3.0)"
-	re := regexp.MustCompile(`([^0-9]+?)\s*([0-9]+\.?[0-9]*)\s*([a-zA-Z/μmol]+).*?(?:参考范围?[：:]?\s*([<>]?)([0-9]+\.?[0-9]*)\s*[-~至]\s*([0-9]+\.?[0-9]*)|[（(<]\s*([<>]?)([0-9]+\.?[0-9]*)\s*[）)>]?)`)
-
-	for _, line := range lines {
+	for i, line := range lines {
 		line = strings.TrimSpace(line)
-		if line == "" {
+		if line == "" || sectionHeaderRe.MatchString(line) {
 			continue
 		}
+		report.TotalLines++
 
-		matches := re.FindStringSubmatch(line)
-		if len(matches) >= 4 {
-			parameter := strings.TrimSpace(matches[1])
-			value, err := strconv.ParseFloat(matches[2], 64)
-			if err != nil {
-				continue
+		result, reason := g.parseLabLine(line, patient)
+		if reason != "" {
+			report.skip(i+1, line, reason, "")
+			// 单位无法识别的结果只列入未评估项目，不参与重复项目检查，同一项目的有效结果仍可参与评估
+			if reason == skipUnknownUnit {
+				results = append(results, result)
 			}
-			unit := strings.TrimSpace(matches[3])
+			continue
+		}
 
-			result := LabResult{
-				Parameter: parameter,
-				Value:     value,
-				Unit:      unit,
+		// 同一项目多次出现：数值一致时忽略，不一致时保留首次结果并报告冲突
+		if first, ok := seen[result.AnalyteID]; ok {
+			prev := results[first]
+			if prev.Value != result.Value || prev.Unit != result.Unit {
+				report.skip(i+1, line, skipConflictingDuplicate,
+					fmt.Sprintf("与已解析的 %s %g %s 不一致", prev.Parameter, prev.Value, prev.Unit))
+			} else {
+				report.skip(i+1, line, skipDuplicate, "")
 			}
+			continue
+		}
+		seen[result.AnalyteID] = len(results)
+		results = append(results, result)
+		report.ParsedLines++
+	}
 
-			// 解析参考范围
-			if len(matches) >= 7 && matches[5] != "" && matches[6] != "" {
-				// 范围格式: 208-428
-				min, err1 := strconv.ParseFloat(matches[5], 64)
-				max, err2 := strconv.ParseFloat(matches[6], 64)
-				if err1 == nil && err2 == nil {
-					result.ReferenceMin = min
-					result.ReferenceMax = max
-				}
-			} else if len(matches) >= 9 && matches[8] != "" {
-				// 单值格式: <3.0 或 >100
-				refValue, err := strconv.ParseFloat(matches[8], 64)
-				if err == nil {
-					operator := matches[7]
-					if operator == "<" {
-						result.ReferenceMax = refValue
-						result.ReferenceMin = 0
-					} else if operator == ">" {
-						result.ReferenceMin = refValue
-						result.ReferenceMax = 999999
-					}
+	if report.TotalLines > 0 {
+		report.Coverage = roundValue(float64(report.ParsedLines) / float64(report.TotalLines))
+	}
+	return results, report, nil
+}
+
+// parseLabLine 解析单行化验结果，无法解析时返回跳过原因
+// 单位无法识别时仍返回结果（状态为单位未知），以便列入未评估项目
+func (g *GoutLabAnalyzer) parseLabLine(line string, patient PatientContext) (LabResult, string) {
+	matches := labValueRe.FindStringSubmatch(line)
+	if matches == nil || strings.TrimSpace(matches[1]) == "" {
+		matches = labValueCompactRe.FindStringSubmatch(line)
+	}
+	if matches == nil {
+		return LabResult{}, skipNoValue
+	}
+
+	parameter := strings.TrimRight(strings.TrimSpace(matches[1]), "：:")
+	value, err := strconv.ParseFloat(matches[2], 64)
+	if err != nil {
+		return LabResult{}, skipNoValue
+	}
+	analyte, ok := resolveAnalyte(parameter)
+	if !ok {
+		return LabResult{}, skipUnknownAnalyte
+	}
+	unit, rest, ok := parseUnit(matches[3])
+	if !ok && analyte.Unitless {
+		unit, rest = "", matches[3]
+	} else if !ok {
+		return LabResult{Parameter: parameter, AnalyteID: analyte.ID, Specimen: analyte.Specimen,
+			OriginalValue: value, Status: statusUnknownUnit}, skipUnknownUnit
+	}
+
+	result := LabResult{
+		Parameter:     parameter,
+		AnalyteID:     analyte.ID,
+		Specimen:      analyte.Specimen,
+		Value:         value,
+		Unit:          unit,
+		OriginalValue: value,
+		OriginalUnit:  unit,
+	}
+
+	// 解析参考范围
+	if refs := referenceRe.FindStringSubmatch(rest); refs != nil {
+		if refs[2] != "" && refs[3] != "" {
+			// 范围格式: 208-428
+			min, err1 := strconv.ParseFloat(refs[2], 64)
+			max, err2 := strconv.ParseFloat(refs[3], 64)
+			if err1 == nil && err2 == nil {
+				result.ReferenceMin = min
+				result.ReferenceMax = max
+			}
+		} else if refs[5] != "" {
+			// 单值格式: <3.0 或 >100
+			refValue, err := strconv.ParseFloat(refs[5], 64)
+			if err == nil {
+				switch refs[4] {
+				case "<", "＜", "≤":
+					result.ReferenceMax = refValue
+					result.ReferenceMin = 0
+				case ">", "＞", "≥":
+					result.ReferenceMin = refValue
+					result.ReferenceMax = 999999
 				}
 			}
-
-			// 判断状态
-			result.Status = g.determineStatus(result)
-			results = append(results, result)
 		}
 	}
 
-	return results, nil
+	// 换算为标准单位，单位未知时不做判断
+	if err := g.normalizeUnits(&result); err != nil {
+		result.Status = statusUnknownUnit
+		return result, skipUnknownUnit
+	}
+
+	// 化验单未给出参考范围时按患者信息选择默认范围
+	if result.ReferenceMin == 0 && result.ReferenceMax == 0 {
+		g.applyDefaultReference(&result, patient)
+	}
+
+	// 判断状态
+	result.Status = g.determineStatus(result)
+	return result, ""
+}
+
+// normalizeUnits 将检测值及参考范围换算为该项目的标准单位
+func (g *GoutLabAnalyzer) normalizeUnits(result *LabResult) error {
+	factor, unit, err := canonicalFactor(result.AnalyteID, result.OriginalUnit)
+	if err != nil {
+		return err
+	}
+
+	result.Value = roundValue(result.OriginalValue * factor)
+	result.Unit = unit
+	result.ReferenceMin = roundValue(result.ReferenceMin * factor)
+	if result.ReferenceMax != 999999 {
+		result.ReferenceMax = roundValue(result.ReferenceMax * factor)
+	}
+	return nil
+}
+
+// referenceRanges 返回参考范围登记表：指定的登记表，其次为知识库的登记表，都未指定时使用内置知识库
+func (g GoutLabAnalyzer) referenceRanges() *ReferenceRangeRegistry {
+	if g.ReferenceRanges != nil {
+		return g.ReferenceRanges
+	}
+	if g.Knowledge != nil {
+		return g.Knowledge.ReferenceRanges()
+	}
+	return defaultReferenceRegistry()
+}
+
+// targets 返回知识库中的降尿酸目标，未指定知识库时使用内置知识库
+func (g GoutLabAnalyzer) targets() urateTargets {
+	return knowledgeUrateTargets(g.Knowledge)
+}
+
+// applyDefaultReference 从参考范围登记表中补全参考范围
+func (g *GoutLabAnalyzer) applyDefaultReference(result *LabResult, patient PatientContext) {
+	ref, ok := g.referenceRanges().Lookup(result.AnalyteID, patient, g.Site)
+	if !ok || normalizeUnitKey(ref.Unit) != normalizeUnitKey(result.Unit) {
+		return
+	}
+	result.ReferenceMin = ref.Min
+	result.ReferenceMax = ref.Max
+	result.DefaultReference = true
+	result.ReferenceSource = ref.Source
 }
 
 // determineStatus 判断检测结果状态
@@ -153,90 +384,72 @@ func (g *GoutLabAnalyzer) determineStatus(result LabResult) string {
 }
 
 // analyzeGoutRisk 分析痛风风险
-func (g *GoutLabAnalyzer) analyzeGoutRisk(results []LabResult) GoutAnalysisResult {
+// 化验结果按项目类别归类后，由规则引擎评估风险等级并给出建议
+func (g *GoutLabAnalyzer) analyzeGoutRisk(results []LabResult, patient PatientContext) GoutAnalysisResult {
 	analysis := GoutAnalysisResult{
 		InflammatoryMarkers: []LabResult{},
 		KidneyFunction:      []LabResult{},
 		Recommendations:     []string{},
 	}
+	if !patient.IsEmpty() {
+		analysis.Patient = &patient
+	}
 
-	var uricAcidHigh bool
-	var inflammationPresent bool
-	var kidneyIssues bool
+	// 估算 eGFR 并分期，计算所得的 eGFR 作为肾功能指标参与评估
+	// 已知体重时另给出 MDRD 和 Cockcroft-Gault 估算值，药物剂量调整常用 Cockcroft-Gault 肌酐清除率
+	results, analysis.RenalAssessment = assessRenalFunction(results, patient, g.IncludeAlternateEGFR || patient.WeightKg > 0)
 
-	// 分析各项指标
+	// 按项目类别归类，单位无法识别的项目不参与评估
+	scored := make([]LabResult, 0, len(results))
 	for _, result := range results {
-		parameterLower := strings.ToLower(result.Parameter)
-		
-		// 尿酸分析
-		if strings.Contains(parameterLower, "尿酸") || strings.Contains(parameterLower, "uric") {
-			analysis.UricAcidLevel = &result
-			if result.Status == "偏高" {
-				uricAcidHigh = true
-				if result.Value > 500 {
-					analysis.Recommendations = append(analysis.Recommendations, "尿酸水平显著升高，建议立即就医，考虑药物治疗")
-				} else if result.Value > 450 {
-					analysis.Recommendations = append(analysis.Recommendations, "尿酸水平偏高，建议调整饮食，限制高嘌呤食物摄入")
-				}
-			}
+		if result.Status == statusUnknownUnit {
+			analysis.UnscoredResults = append(analysis.UnscoredResults, result)
+			continue
 		}
+		scored = append(scored, result)
+		analyte, _ := lookupAnalyte(result.AnalyteID)
 
-		// 炎症指标分析
-		if strings.Contains(parameterLower, "c反应蛋白") || strings.Contains(parameterLower, "crp") ||
-		   strings.Contains(parameterLower, "血沉") || strings.Contains(parameterLower, "esr") ||
-		   strings.Contains(parameterLower, "白细胞") || strings.Contains(parameterLower, "wbc") {
+		switch analyte.Category {
+		case categoryUrate:
+			analysis.UricAcidLevel = &result
+		case categoryInflammation:
 			analysis.InflammatoryMarkers = append(analysis.InflammatoryMarkers, result)
-			if result.Status == "偏高" {
-				inflammationPresent = true
-			}
-		}
-
-		// 肾功能指标分析
-		if strings.Contains(parameterLower, "肌酐") || strings.Contains(parameterLower, "creatinine") ||
-		   strings.Contains(parameterLower, "尿素") || strings.Contains(parameterLower, "urea") ||
-		   strings.Contains(parameterLower, "肾小球") || strings.Contains(parameterLower, "gfr") {
+		case categoryKidney:
 			analysis.KidneyFunction = append(analysis.KidneyFunction, result)
-			if result.Status == "偏高" || (strings.Contains(parameterLower, "gfr") && result.Status == "偏低") {
-				kidneyIssues = true
-			}
+		default:
+			analysis.OtherResults = append(analysis.OtherResults, result)
 		}
 	}
 
-	// 综合评估风险等级
-	if uricAcidHigh && inflammationPresent && kidneyIssues {
-		analysis.RiskLevel = "高风险"
-		analysis.FollowUpNeeded = true
-		analysis.Recommendations = append(analysis.Recommendations, "存在多项异常指标，强烈建议立即就医，需要专业医生制定治疗方案")
-	} else if uricAcidHigh && (inflammationPresent || kidneyIssues) {
-		analysis.RiskLevel = "中风险"
-		analysis.FollowUpNeeded = true
-		analysis.Recommendations = append(analysis.Recommendations, "建议尽快就医，进行进一步检查和评估")
-	} else if uricAcidHigh {
-		analysis.RiskLevel = "低风险"
-		analysis.FollowUpNeeded = true
-		analysis.Recommendations = append(analysis.Recommendations, "建议调整生活方式，定期复查")
-	} else {
-		analysis.RiskLevel = "低风险"
-		analysis.FollowUpNeeded = false
-		analysis.Recommendations = append(analysis.Recommendations, "各项指标基本正常，保持健康的生活方式")
-	}
-
-	// 通用建议
-	if uricAcidHigh || inflammationPresent {
-		analysis.Recommendations = append(analysis.Recommendations,
-			"建议低嘌呤饮食：避免内脏、海鲜、浓汤等高嘌呤食物",
-			"增加饮水量，每日至少2000ml",
-			"限制酒精摄入，特别是啤酒",
-			"适量运动，避免剧烈运动",
-			"控制体重，避免肥胖")
+	// 按规则评估风险等级
+	evaluation := g.ruleSet().Evaluate(scored, patient)
+	analysis.RiskLevel = evaluation.RiskLevel
+	analysis.FollowUpNeeded = evaluation.FollowUpNeeded
+	analysis.Recommendations = append(analysis.Recommendations, evaluation.Recommendations...)
+	analysis.RuleTrace = evaluation.Trace
+
+	// 尿酸排泄分析
+	analysis.UrateExcretion = analyzeUrateExcretion(results)
+	if analysis.UrateExcretion != nil {
+		if advice := urateExcretionAdvice(analysis.UrateExcretion.Type); advice != "" {
+			analysis.Recommendations = append(analysis.Recommendations, advice)
+		}
 	}
 
-	if kidneyIssues {
+	if len(analysis.UnscoredResults) > 0 {
 		analysis.Recommendations = append(analysis.Recommendations,
-			"注意保护肾功能，避免使用肾毒性药物",
-			"控制血压和血糖",
-			"定期监测肾功能指标")
+			"部分检测项目单位无法识别，未参与风险评估，请核对化验单单位")
 	}
 
+	analysis.Recommendations = append(analysis.Recommendations, renalAdvice(analysis.RenalAssessment)...)
+
 	return analysis
+}
+
+// ruleSet 返回当前生效的风险评估规则
+func (g *GoutLabAnalyzer) ruleSet() *RuleSet {
+	if g.Rules != nil {
+		return g.Rules.RuleSet()
+	}
+	return defaultRuleEngine().RuleSet()
 }
\ No newline at end of file
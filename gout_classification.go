@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/callbacks"
+)
+
+// acrEularThreshold ACR/EULAR 2015 痛风分类标准的分类阈值
+const acrEularThreshold = 8
+
+// 受累关节类型
+const (
+	jointFirstMTP     = "first_mtp"     // 累及第一跖趾关节
+	jointAnkleMidfoot = "ankle_midfoot" // 累及踝关节或足中段（未累及第一跖趾关节）
+)
+
+// 滑液检查结果
+const (
+	synovialNotDone     = "not_done"     // 未检查
+	synovialMSUNegative = "msu_negative" // 未见尿酸钠结晶
+)
+
+// GoutClassifier ACR/EULAR 2015 痛风分类标准评分工具
+type GoutClassifier struct {
+	CallbacksHandler callbacks.Handler
+	LabAnalyzer      GoutLabAnalyzer // 用于从化验单文本中提取血尿酸
+}
+
+// ClinicalFindings 临床资料
+type ClinicalFindings struct {
+	EntryCriterion    bool     `json:"entry_criterion"`          // 准入标准: 至少1次外周关节或滑囊肿胀、疼痛或压痛
+	MSUInSymptomatic  bool     `json:"msu_in_symptomatic_joint"` // 充分标准: 有症状关节/滑囊或痛风石中发现尿酸钠结晶
+	JointPattern      string   `json:"joint_pattern"`            // 受累关节: first_mtp / ankle_midfoot / other
+	Erythema          bool     `json:"erythema"`                 // 受累关节皮肤发红
+	CannotBearTouch   bool     `json:"cannot_bear_touch"`        // 受累关节不能耐受触摸或按压
+	DifficultyWalking bool     `json:"difficulty_walking"`       // 行走或关节活动严重困难
+	TypicalEpisodes   int      `json:"typical_episodes"`         // 典型发作次数（疼痛<24h达峰、≤14天缓解、间歇期完全缓解中符合≥2项）
+	Tophus            bool     `json:"tophus"`                   // 存在痛风石
+	SerumUrate        *float64 `json:"serum_urate,omitempty"`    // 未行降尿酸治疗时的最高血尿酸 (μmol/L)
+	SynovialFluid     string   `json:"synovial_fluid,omitempty"` // 滑液检查: not_done / msu_negative
+	ImagingUrate      bool     `json:"imaging_urate_deposition"` // 超声双轨征或双能CT显示尿酸盐沉积
+	ImagingErosion    bool     `json:"imaging_erosion"`          // X线显示痛风相关骨侵蚀
+	LabReport         string   `json:"lab_report,omitempty"`     // 化验单文本，未提供 serum_urate 时从中提取血尿酸
+}
+
+// CriterionScore 单项评分
+type CriterionScore struct {
+	Domain  string `json:"domain"`  // 评分领域
+	Finding string `json:"finding"` // 所见
+	Points  int    `json:"points"`  // 得分
+}
+
+// ClassificationResult 分类评分结果
+type ClassificationResult struct {
+	EntryCriterionMet      bool             `json:"entry_criterion_met"`      // 是否满足准入标准
+	SufficientCriterionMet bool             `json:"sufficient_criterion_met"` // 是否满足充分标准（直接分类为痛风）
+	Items                  []CriterionScore `json:"items"`                    // 各项得分
+	TotalScore             int              `json:"total_score"`              // 总分
+	Threshold              int              `json:"threshold"`                // 分类阈值
+	ClassifiedAsGout       bool             `json:"classified_as_gout"`       // 是否分类为痛风
+	SerumUrate             float64          `json:"serum_urate,omitempty"`    // 评分所用血尿酸 (μmol/L)
+	SerumUrateSource       string           `json:"serum_urate_source,omitempty"`
+	Notes                  []string         `json:"notes"`
+}
+
+// Name 返回工具名称
+func (c GoutClassifier) Name() string {
+	return "gout_classification"
+}
+
+// Description 返回工具描述
+func (c GoutClassifier) Description() string {
+	return `痛风分类评分工具。按 ACR/EULAR 2015 痛风分类标准计算得分，≥8分可分类为痛风。
+输入为 JSON 格式的临床资料，字段包括：
+entry_criterion(是否有外周关节/滑囊肿痛), msu_in_symptomatic_joint(有症状关节发现尿酸钠结晶),
+joint_pattern(first_mtp/ankle_midfoot/other), erythema, cannot_bear_touch, difficulty_walking,
+typical_episodes(典型发作次数), tophus, serum_urate(μmol/L), synovial_fluid(not_done/msu_negative),
+imaging_urate_deposition, imaging_erosion, lab_report(化验单文本，可代替 serum_urate)。
+例如：{"entry_criterion": true, "joint_pattern": "first_mtp", "erythema": true, "typical_episodes": 2, "lab_report": "尿酸 520 umol/L"}
+返回各项得分明细及是否达到分类阈值。`
+}
+
+// Call 执行分类评分
+func (c GoutClassifier) Call(ctx context.Context, input string) (string, error) {
+	if c.CallbacksHandler != nil {
+		c.CallbacksHandler.HandleToolStart(ctx, input)
+	}
+
+	var findings ClinicalFindings
+	if err := json.Unmarshal([]byte(extractJSONObject(input)), &findings); err != nil {
+		return fmt.Sprintf("解析临床资料时出错: %v。请按工具描述提供 JSON 格式的临床资料。", err), nil
+	}
+
+	result := c.classify(ctx, findings)
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("格式化评分结果时出错: %v", err), nil
+	}
+
+	if c.CallbacksHandler != nil {
+		c.CallbacksHandler.HandleToolEnd(ctx, string(output))
+	}
+
+	return string(output), nil
+}
+
+// extractJSONObject 截取输入中的 JSON 对象，兼容 LLM 在 JSON 前后附加说明文字或代码块标记
+func extractJSONObject(input string) string {
+	start := strings.Index(input, "{")
+	end := strings.LastIndex(input, "}")
+	if start < 0 || end < start {
+		return input
+	}
+	return input[start : end+1]
+}
+
+// classify 按 ACR/EULAR 2015 标准评分
+func (c GoutClassifier) classify(ctx context.Context, f ClinicalFindings) ClassificationResult {
+	result := ClassificationResult{
+		EntryCriterionMet: f.EntryCriterion,
+		Items:             []CriterionScore{},
+		Threshold:         acrEularThreshold,
+		Notes:             []string{},
+	}
+
+	if !f.EntryCriterion {
+		result.Notes = append(result.Notes, "不满足准入标准（至少1次外周关节或滑囊肿胀、疼痛或压痛），不适用本分类标准")
+		return result
+	}
+
+	if f.MSUInSymptomatic {
+		result.SufficientCriterionMet = true
+		result.ClassifiedAsGout = true
+		result.Notes = append(result.Notes, "有症状关节或滑囊中发现尿酸钠结晶，满足充分标准，直接分类为痛风")
+		return result
+	}
+
+	add := func(domain, finding string, points int) {
+		result.Items = append(result.Items, CriterionScore{Domain: domain, Finding: finding, Points: points})
+		result.TotalScore += points
+	}
+
+	// 临床: 受累关节
+	switch f.JointPattern {
+	case jointFirstMTP:
+		add("受累关节", "累及第一跖趾关节（单/寡关节发作）", 2)
+	case jointAnkleMidfoot:
+		add("受累关节", "累及踝关节或足中段（未累及第一跖趾关节）", 1)
+	}
+
+	// 临床: 发作特点
+	characteristics := 0
+	for _, present := range []bool{f.Erythema, f.CannotBearTouch, f.DifficultyWalking} {
+		if present {
+			characteristics++
+		}
+	}
+	if characteristics > 0 {
+		add("发作特点", fmt.Sprintf("符合 %d 项（皮肤发红、不能耐受触压、行走困难）", characteristics), characteristics)
+	}
+
+	// 临床: 发作时间特征
+	switch {
+	case f.TypicalEpisodes >= 2:
+		add("发作时间特征", "反复典型发作", 2)
+	case f.TypicalEpisodes == 1:
+		add("发作时间特征", "1次典型发作", 1)
+	}
+
+	// 临床: 痛风石
+	if f.Tophus {
+		add("痛风石", "存在痛风石", 4)
+	}
+
+	// 实验室: 血尿酸
+	urate, source := c.serumUrate(ctx, f)
+	if source == "" {
+		result.Notes = append(result.Notes, "未提供血尿酸，该项按0分计；建议在未行降尿酸治疗、发作4周后复查")
+	} else {
+		result.SerumUrate = urate
+		result.SerumUrateSource = source
+		finding, points := urateBand(urate)
+		add("血尿酸", finding, points)
+	}
+
+	// 实验室: 滑液
+	if f.SynovialFluid == synovialMSUNegative {
+		add("滑液分析", "有症状关节滑液未见尿酸钠结晶", -2)
+	}
+
+	// 影像学
+	if f.ImagingUrate {
+		add("影像学", "超声双轨征或双能CT显示尿酸盐沉积", 4)
+	}
+	if f.ImagingErosion {
+		add("影像学", "X线显示痛风相关骨侵蚀", 4)
+	}
+
+	result.ClassifiedAsGout = result.TotalScore >= acrEularThreshold
+	return result
+}
+
+// serumUrate 返回评分所用血尿酸及来源，优先使用直接提供的数值，其次从化验单中提取
+func (c GoutClassifier) serumUrate(ctx context.Context, f ClinicalFindings) (float64, string) {
+	if f.SerumUrate != nil {
+		return *f.SerumUrate, "临床资料"
+	}
+	if strings.TrimSpace(f.LabReport) == "" {
+		return 0, ""
+	}
+
+	patient, labInput := parsePatientContext(f.LabReport)
+	results, _, err := c.LabAnalyzer.parseLabInput(labInput, c.LabAnalyzer.Patient.merge(patient))
+	if err != nil {
+		return 0, ""
+	}
+	for _, result := range results {
+		if result.AnalyteID == analyteUricAcid && result.Status != statusUnknownUnit {
+			return result.Value, "化验单: " + result.Parameter
+		}
+	}
+	return 0, ""
+}
+
+// urateBand 血尿酸评分区间，按分类标准的 mg/dL 界值 <4、4-<6、6-<8、8-<10、≥10 评分
+// 换算后保留两位小数再比较，化验单直接以 mg/dL 报告的界值不会因换算误差落入相邻区间
+func urateBand(urate float64) (string, int) {
+	mgdl := roundValue(urate / analyteUnitConversions[analyteUricAcid].Factors["mg/dl"])
+	finding := func(band string) string {
+		return fmt.Sprintf("%.0f μmol/L（%.2f mg/dL，%s）", urate, mgdl, band)
+	}
+	switch {
+	case mgdl < 4:
+		return finding("<4 mg/dL"), -4
+	case mgdl < 6:
+		return finding("4-<6 mg/dL"), 0
+	case mgdl < 8:
+		return finding("6-<8 mg/dL"), 2
+	case mgdl < 10:
+		return finding("8-<10 mg/dL"), 3
+	}
+	return finding("≥10 mg/dL"), 4
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/callbacks"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// 指南检索的环境变量
+const (
+	guidelineDirEnv   = "GOUT_GUIDELINE_DIR"   // 指南文档目录
+	guidelineIndexEnv = "GOUT_GUIDELINE_INDEX" // 指南索引文件，默认为文档目录下的 .guideline_index.json
+)
+
+// defaultGuidelineIndexName 指南索引文件的默认文件名
+const defaultGuidelineIndexName = ".guideline_index.json"
+
+// guidelineIndexFormat 索引文件格式版本，切分或向量化方式变化时递增
+const guidelineIndexFormat = 1
+
+// maxChunkRunes 每个段落的最大字数，段落不跨越标题和分页
+const maxChunkRunes = 400
+
+// 检索参数
+const (
+	defaultGuidelineTopK = 4    // 返回的段落数
+	minGuidelineScore    = 0.08 // 余弦相似度低于此值的段落视为不相关
+)
+
+// markdownHeading Markdown 标题行
+var markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// listItem 列表项行，与上一行分行保存
+var listItem = regexp.MustCompile(`^\s*([-*+•]|\d+[.)、])\s+`)
+
+// sentenceEnd 句末标点，超长的自然段在句末处切分
+var sentenceEnd = regexp.MustCompile(`[。！？；!?;]|\.\s`)
+
+// GuidelinePassage 检索到的指南段落及出处
+type GuidelinePassage struct {
+	Citation string  `json:"citation"`          // 引用出处，如 《2020 ACR 痛风管理指南》降尿酸治疗（acr_2020.md 第 12 行）
+	Source   string  `json:"source"`            // 文档路径，相对于指南目录
+	Title    string  `json:"title"`             // 文档标题
+	Section  string  `json:"section,omitempty"` // 所在章节
+	Page     int     `json:"page,omitempty"`    // 所在页（PDF 导出的文本）
+	Line     int     `json:"line"`              // 段落起始行
+	Text     string  `json:"text"`              // 段落原文
+	Score    float64 `json:"score"`             // 与问题的余弦相似度
+}
+
+// GuidelineResult 指南检索结果
+type GuidelineResult struct {
+	Query         string             `json:"query"`
+	CorpusVersion string             `json:"corpus_version"` // 指南语料版本，任一文档变化时改变
+	Passages      []GuidelinePassage `json:"passages"`
+}
+
+// GuidelineIndex 指南语料的向量索引：切分后的段落保存在内存向量库中，可保存为文件
+type GuidelineIndex struct {
+	store    *MemoryVectorStore
+	embedder *TFIDFEmbedder
+	version  string
+	files    int
+}
+
+// guidelineIndexFile 索引文件内容
+type guidelineIndexFile struct {
+	Format   int            `json:"format"`
+	Version  string         `json:"version"` // 语料版本
+	Files    int            `json:"files"`
+	BuiltAt  time.Time      `json:"built_at"`
+	Embedder *TFIDFEmbedder `json:"embedder"`
+	Records  []VectorRecord `json:"records"`
+}
+
+// guidelineFile 一份指南文档
+type guidelineFile struct {
+	path string // 相对于指南目录，以 / 分隔
+	text string
+}
+
+// Version 返回语料版本
+func (g *GuidelineIndex) Version() string {
+	return g.version
+}
+
+// Files 返回文档数
+func (g *GuidelineIndex) Files() int {
+	return g.files
+}
+
+// Chunks 返回段落数
+func (g *GuidelineIndex) Chunks() int {
+	return g.store.Len()
+}
+
+// BuildGuidelineIndex 读取指南目录下的 .md、.markdown 和 .txt 文档，切分段落并计算向量
+func BuildGuidelineIndex(dir string) (*GuidelineIndex, error) {
+	files, err := readGuidelineFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return buildGuidelineIndex(files)
+}
+
+// buildGuidelineIndex 切分文档，用全部段落拟合向量模型后加入向量库
+func buildGuidelineIndex(files []guidelineFile) (*GuidelineIndex, error) {
+	var docs []schema.Document
+	for _, file := range files {
+		docs = append(docs, chunkGuideline(file)...)
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("指南目录中没有可检索的文档 (.md、.markdown 或 .txt 文件)")
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.PageContent
+	}
+	embedder := NewTFIDFEmbedder(0)
+	embedder.Fit(texts)
+	store := NewMemoryVectorStore(embedder)
+	if _, err := store.AddDocuments(context.Background(), docs); err != nil {
+		return nil, err
+	}
+	return &GuidelineIndex{store: store, embedder: embedder, version: guidelineVersion(files), files: len(files)}, nil
+}
+
+// ReadGuidelineIndex 读取保存的指南索引
+func ReadGuidelineIndex(path string) (*GuidelineIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取指南索引失败: %w", err)
+	}
+	var file guidelineIndexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析指南索引 %s 失败: %w", path, err)
+	}
+	if file.Format != guidelineIndexFormat || file.Embedder == nil {
+		return nil, fmt.Errorf("指南索引 %s 的格式版本 %d 不受支持，请重新建立索引", path, file.Format)
+	}
+	store := NewMemoryVectorStore(file.Embedder)
+	store.Restore(file.Records)
+	return &GuidelineIndex{store: store, embedder: file.Embedder, version: file.Version, files: file.Files}, nil
+}
+
+// Save 将索引保存为文件，载入时无需重新计算向量
+func (g *GuidelineIndex) Save(path string) error {
+	data, err := json.Marshal(guidelineIndexFile{
+		Format:   guidelineIndexFormat,
+		Version:  g.version,
+		Files:    g.files,
+		BuiltAt:  time.Now().UTC(),
+		Embedder: g.embedder,
+		Records:  g.store.Records(),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// openGuidelineIndex 打开指南索引：指定文档目录时，索引文件不存在或与文档内容不一致则重建并保存；
+// 只指定索引文件时直接读取；两者都未指定时返回 nil，不启用指南检索
+func openGuidelineIndex(dir, indexPath string) (index *GuidelineIndex, rebuilt bool, err error) {
+	if dir == "" {
+		if indexPath == "" {
+			return nil, false, nil
+		}
+		index, err := ReadGuidelineIndex(indexPath)
+		return index, false, err
+	}
+	if indexPath == "" {
+		indexPath = filepath.Join(dir, defaultGuidelineIndexName)
+	}
+	files, err := readGuidelineFiles(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing, err := ReadGuidelineIndex(indexPath); err == nil && existing.version == guidelineVersion(files) {
+		return existing, false, nil
+	}
+	if index, err = buildGuidelineIndex(files); err != nil {
+		return nil, false, err
+	}
+	if err := index.Save(indexPath); err != nil {
+		return nil, false, fmt.Errorf("保存指南索引失败: %w", err)
+	}
+	return index, true, nil
+}
+
+// guidelineIndexFromEnv 按环境变量打开指南索引，未配置时返回 nil
+func guidelineIndexFromEnv() (*GuidelineIndex, bool, error) {
+	return openGuidelineIndex(os.Getenv(guidelineDirEnv), os.Getenv(guidelineIndexEnv))
+}
+
+// loadGuidelines 按环境变量打开指南索引并输出文档和段落数，未配置时返回 nil
+func loadGuidelines(out io.Writer) (*GuidelineIndex, error) {
+	index, rebuilt, err := guidelineIndexFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("加载临床指南失败: %w", err)
+	}
+	if index != nil {
+		note := ""
+		if rebuilt {
+			note = "，已建立索引"
+		}
+		fmt.Fprintf(out, "📖 临床指南: %d 个文档，%d 个段落 (语料版本 %s%s)\n", index.Files(), index.Chunks(), index.Version(), note)
+	}
+	return index, nil
+}
+
+// Search 返回与问题最相关的 k 个段落，按相似度从高到低排序
+func (g *GuidelineIndex) Search(ctx context.Context, query string, k int) ([]GuidelinePassage, error) {
+	retriever := vectorstores.ToRetriever(g.store, k, vectorstores.WithScoreThreshold(minGuidelineScore))
+	docs, err := retriever.GetRelevantDocuments(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	passages := make([]GuidelinePassage, len(docs))
+	for i, doc := range docs {
+		p := GuidelinePassage{
+			Source:  metadataString(doc.Metadata, "source"),
+			Title:   metadataString(doc.Metadata, "title"),
+			Section: metadataString(doc.Metadata, "section"),
+			Page:    metadataInt(doc.Metadata, "page"),
+			Line:    metadataInt(doc.Metadata, "line"),
+			Text:    doc.PageContent,
+			Score:   math.Round(float64(doc.Score)*1000) / 1000,
+		}
+		p.Citation = guidelineCitation(p)
+		passages[i] = p
+	}
+	return passages, nil
+}
+
+// guidelineCitation 生成段落的引用出处
+func guidelineCitation(p GuidelinePassage) string {
+	citation := "《" + p.Title + "》"
+	if p.Section != "" {
+		citation += p.Section
+	}
+	if p.Page > 0 {
+		citation += fmt.Sprintf("，第 %d 页", p.Page)
+	}
+	return citation + fmt.Sprintf("（%s 第 %d 行）", p.Source, p.Line)
+}
+
+// metadataString 读取字符串元数据
+func metadataString(metadata map[string]any, key string) string {
+	value, _ := metadata[key].(string)
+	return value
+}
+
+// metadataInt 读取整数元数据，从文件载入的数字为 float64
+func metadataInt(metadata map[string]any, key string) int {
+	switch value := metadata[key].(type) {
+	case int:
+		return value
+	case float64:
+		return int(value)
+	}
+	return 0
+}
+
+// isGuidelineFile 判断文件是否为指南文档，PDF 需先导出为文本（如 pdftotext），分页符用于标注页码
+func isGuidelineFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown", ".txt":
+		return !strings.HasPrefix(path.Base(name), ".")
+	}
+	return false
+}
+
+// readGuidelineFiles 按路径顺序读取目录及子目录下的指南文档
+func readGuidelineFiles(dir string) ([]guidelineFile, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取指南目录失败: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("指南路径 %s 不是目录", dir)
+	}
+	fsys := os.DirFS(dir)
+	var files []guidelineFile
+	err = fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !isGuidelineFile(name) {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(data) {
+			return fmt.Errorf("%s 不是 UTF-8 编码的文本", name)
+		}
+		files = append(files, guidelineFile{path: name, text: string(data)})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取指南文档失败: %w", err)
+	}
+	return files, nil
+}
+
+// guidelineVersion 计算语料版本：文档路径和内容以及切分、向量化参数的摘要
+func guidelineVersion(files []guidelineFile) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "format %d chunk %d dimensions %d\n", guidelineIndexFormat, maxChunkRunes, defaultEmbeddingDimensions)
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s\n%d\n%s", file.path, len(file.text), file.text)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// guidelineChunker 按标题、分页和自然段切分一份文档
+type guidelineChunker struct {
+	file     guidelineFile
+	title    string
+	headings [6]string // Markdown 各级标题，第一个一级标题作为文档标题
+	page     int       // 当前页，文档不含分页符时为 0
+	docs     []schema.Document
+
+	paragraph     []string // 当前自然段的行
+	paragraphLine int
+	chunk         []string // 当前段落的自然段
+	chunkLine     int
+	chunkRunes    int
+}
+
+// chunkGuideline 将文档切分为段落：段落不跨越标题和分页，不超过 maxChunkRunes 字，
+// 超长的自然段在句末处切分；元数据记录文档、标题、章节、页码和起始行
+func chunkGuideline(file guidelineFile) []schema.Document {
+	c := &guidelineChunker{file: file, title: strings.TrimSuffix(path.Base(file.path), path.Ext(file.path))}
+	markdown := strings.ToLower(path.Ext(file.path)) != ".txt"
+	if strings.Contains(file.text, "\f") {
+		c.page = 1
+	}
+	titled := false
+	for i, line := range strings.Split(file.text, "\n") {
+		parts := strings.Split(line, "\f")
+		for j, part := range parts {
+			if j > 0 {
+				c.flushChunk()
+				c.page++
+			}
+			part = strings.TrimRight(part, " \t\r")
+			if markdown {
+				if m := markdownHeading.FindStringSubmatch(part); m != nil {
+					c.flushChunk()
+					level := len(m[1])
+					if level == 1 && !titled {
+						c.title, titled = m[2], true
+						continue
+					}
+					c.headings[level-1] = m[2]
+					clear(c.headings[level:])
+					continue
+				}
+			}
+			if strings.TrimSpace(part) == "" {
+				c.flushParagraph()
+				continue
+			}
+			if len(c.paragraph) == 0 {
+				c.paragraphLine = i + 1
+			}
+			c.paragraph = append(c.paragraph, part)
+		}
+	}
+	c.flushChunk()
+	return c.docs
+}
+
+// flushParagraph 结束当前自然段并加入段落，放不下时先结束当前段落
+func (c *guidelineChunker) flushParagraph() {
+	if len(c.paragraph) == 0 {
+		return
+	}
+	text := joinGuidelineLines(c.paragraph)
+	line := c.paragraphLine
+	c.paragraph = nil
+	for _, piece := range splitLongText(text, maxChunkRunes) {
+		runes := utf8.RuneCountInString(piece)
+		if c.chunkRunes > 0 && c.chunkRunes+runes > maxChunkRunes {
+			c.flushChunk()
+		}
+		if len(c.chunk) == 0 {
+			c.chunkLine = line
+		}
+		c.chunk = append(c.chunk, piece)
+		c.chunkRunes += runes
+	}
+}
+
+// flushChunk 结束当前段落，没有可检索词项的段落丢弃
+func (c *guidelineChunker) flushChunk() {
+	if len(c.paragraph) > 0 {
+		c.flushParagraph()
+	}
+	if len(c.chunk) == 0 {
+		return
+	}
+	text := strings.Join(c.chunk, "\n")
+	c.chunk, c.chunkRunes = nil, 0
+	if len(vectorTerms(text)) == 0 {
+		return
+	}
+	metadata := map[string]any{"source": c.file.path, "title": c.title, "line": c.chunkLine}
+	var sections []string
+	for _, heading := range c.headings {
+		if heading != "" {
+			sections = append(sections, heading)
+		}
+	}
+	if len(sections) > 0 {
+		metadata["section"] = strings.Join(sections, " > ")
+	}
+	if c.page > 0 {
+		metadata["page"] = c.page
+	}
+	c.docs = append(c.docs, schema.Document{PageContent: text, Metadata: metadata})
+}
+
+// joinGuidelineLines 合并自然段中的行：列表项分行保存，英文单词之间补空格，中文直接相连
+func joinGuidelineLines(lines []string) string {
+	var b strings.Builder
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if i > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(b.String())
+			next, _ := utf8.DecodeRuneInString(line)
+			switch {
+			case listItem.MatchString(line):
+				b.WriteByte('\n')
+			case prev < utf8.RuneSelf && next < utf8.RuneSelf:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// splitLongText 将超过 limit 字的文本在句末处切分，单句仍超长时按字数切分
+func splitLongText(text string, limit int) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	var sentences []string
+	for len(text) > 0 {
+		loc := sentenceEnd.FindStringIndex(text)
+		if loc == nil {
+			sentences = append(sentences, text)
+			break
+		}
+		sentences = append(sentences, text[:loc[1]])
+		text = text[loc[1]:]
+	}
+
+	var pieces []string
+	current := ""
+	for _, sentence := range sentences {
+		for utf8.RuneCountInString(sentence) > limit {
+			runes := []rune(sentence)
+			if current != "" {
+				pieces = append(pieces, strings.TrimSpace(current))
+				current = ""
+			}
+			pieces = append(pieces, strings.TrimSpace(string(runes[:limit])))
+			sentence = string(runes[limit:])
+		}
+		if current != "" && utf8.RuneCountInString(current)+utf8.RuneCountInString(sentence) > limit {
+			pieces = append(pieces, strings.TrimSpace(current))
+			current = ""
+		}
+		current += sentence
+	}
+	if strings.TrimSpace(current) != "" {
+		pieces = append(pieces, strings.TrimSpace(current))
+	}
+	return slices.DeleteFunc(pieces, func(piece string) bool { return piece == "" })
+}
+
+// GuidelineSearchTool 临床指南检索工具
+type GuidelineSearchTool struct {
+	CallbacksHandler callbacks.Handler
+	Index            *GuidelineIndex
+}
+
+// Name 返回工具名称
+func (t GuidelineSearchTool) Name() string {
+	return "clinical_guideline_search"
+}
+
+// Description 返回工具描述
+func (t GuidelineSearchTool) Description() string {
+	return `痛风临床指南检索工具。在本地的痛风诊疗指南文档（如 ACR、EULAR 和中国痛风诊疗指南）中检索与问题最相关的原文段落。
+需要依据指南回答治疗时机、药物选择和剂量、血尿酸控制目标、预防发作、随访等问题时使用，输入问题或关键词。
+返回段落原文 text 及其出处 citation（文档标题、章节、页码和行号），按相关性排序。
+回答时直接引用段落原文，并在引用后注明 citation 中的出处；没有返回相关段落时不要编造指南内容。`
+}
+
+// Call 检索指南段落
+func (t GuidelineSearchTool) Call(ctx context.Context, input string) (string, error) {
+	if t.CallbacksHandler != nil {
+		t.CallbacksHandler.HandleToolStart(ctx, input)
+	}
+
+	if t.Index == nil {
+		return "未配置指南文档", nil
+	}
+	query := strings.TrimSpace(input)
+	if query == "" {
+		return "请输入要在指南中检索的问题或关键词", nil
+	}
+
+	passages, err := t.Index.Search(ctx, query, defaultGuidelineTopK)
+	if err != nil {
+		return fmt.Sprintf("检索指南时出错: %v", err), nil
+	}
+	if len(passages) == 0 {
+		return fmt.Sprintf("未在指南文档中找到与问题相关的段落（语料版本 %s），请换用其他关键词或根据医学知识库回答。", t.Index.Version()), nil
+	}
+
+	output, err := json.MarshalIndent(GuidelineResult{Query: query, CorpusVersion: t.Index.Version(), Passages: passages}, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("格式化指南段落时出错: %v", err), nil
+	}
+
+	if t.CallbacksHandler != nil {
+		t.CallbacksHandler.HandleToolEnd(ctx, string(output))
+	}
+
+	return string(output), nil
+}
+
+// runGuidelinesCommand 处理 guidelines 子命令
+func runGuidelinesCommand(args []string) error {
+	usage := errors.New("用法: guidelines index [指南目录] | guidelines search <问题>")
+	if len(args) == 0 {
+		return usage
+	}
+	switch args[0] {
+	case "index":
+		if len(args) > 2 {
+			return usage
+		}
+		dir := os.Getenv(guidelineDirEnv)
+		if len(args) == 2 {
+			dir = args[1]
+		}
+		if dir == "" {
+			return fmt.Errorf("请指定指南目录或设置 %s", guidelineDirEnv)
+		}
+		indexPath := os.Getenv(guidelineIndexEnv)
+		if indexPath == "" {
+			indexPath = filepath.Join(dir, defaultGuidelineIndexName)
+		}
+		return indexGuidelines(dir, indexPath, os.Stdout)
+	case "search":
+		if len(args) < 2 {
+			return usage
+		}
+		index, _, err := guidelineIndexFromEnv()
+		if err != nil {
+			return err
+		}
+		if index == nil {
+			return fmt.Errorf("未配置指南文档，请设置 %s 或 %s", guidelineDirEnv, guidelineIndexEnv)
+		}
+		return searchGuidelines(context.Background(), index, strings.Join(args[1:], " "), os.Stdout)
+	}
+	return usage
+}
+
+// indexGuidelines 重新建立指南索引并保存
+func indexGuidelines(dir, indexPath string, out io.Writer) error {
+	fmt.Fprintf(out, "🔨 建立指南索引: %s\n", dir)
+	index, err := BuildGuidelineIndex(dir)
+	if err != nil {
+		return err
+	}
+	if err := index.Save(indexPath); err != nil {
+		return fmt.Errorf("保存指南索引失败: %w", err)
+	}
+	fmt.Fprintf(out, "✅ %d 个文档，%d 个段落，语料版本 %s\n", index.Files(), index.Chunks(), index.Version())
+	fmt.Fprintf(out, "💾 已保存到 %s\n", indexPath)
+	return nil
+}
+
+// searchGuidelines 检索并打印指南段落
+func searchGuidelines(ctx context.Context, index *GuidelineIndex, query string, out io.Writer) error {
+	passages, err := index.Search(ctx, query, defaultGuidelineTopK)
+	if err != nil {
+		return err
+	}
+	if len(passages) == 0 {
+		fmt.Fprintln(out, "未找到相关段落")
+		return nil
+	}
+	for i, p := range passages {
+		fmt.Fprintf(out, "[%d] %s  相似度 %.3f\n%s\n\n", i+1, p.Citation, p.Score, p.Text)
+	}
+	return nil
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peterh/liner"
+	"github.com/tmc/langchaingo/agents"
+	"github.com/tmc/langchaingo/chains"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/memory"
+	"github.com/tmc/langchaingo/tools"
+)
+
+// 交互模式的提示符和输入块分隔符，liner 不接受含控制字符（包括组合表情中的零宽连接符）的提示符
+const (
+	promptPrimary  = "🩺 您的问题: "
+	promptContinue = "   … "
+	blockDelimiter = `"""`
+)
+
+// historyFileName 输入历史文件，保存在用户主目录下
+const historyFileName = ".gout_agent_history"
+
+// errAnalysisCanceled 用户按 Ctrl-C 取消了正在进行的分析
+var errAnalysisCanceled = errors.New("已取消本次分析")
+
+// slashCommandHelp 交互模式命令说明
+const slashCommandHelp = `可用命令：
+  /help              显示此帮助
+  /reset             清空对话记忆，开始新的对话
+  /patient [编号]     查看当前患者，或切换到指定患者（同时清空对话记忆）
+  /export [文件]      将本次对话导出为 Markdown 文件
+  exit, /exit        退出程序
+多行输入：
+  直接粘贴化验单，以空行结束；或以单独一行 """ 开始和结束输入块
+  输入时按 Ctrl-C 放弃当前输入，分析过程中按 Ctrl-C 取消本次分析，Ctrl-D 退出`
+
+// lineReader 按行读取用户输入，liner.State 实现了该接口
+type lineReader interface {
+	Prompt(prompt string) (string, error)
+}
+
+// readInput 读取一次完整的用户输入
+// 单独一行 """ 开始时读取到下一个 """ 为止；首行像化验数据（化验项目、患者信息、日期行或以冒号结尾的标题行）时
+// 继续读取到空行为止，这样粘贴多行化验单时不会被拆成多次提问
+func readInput(r lineReader) (string, error) {
+	first, err := r.Prompt(promptPrimary)
+	if err != nil {
+		return "", err
+	}
+
+	trimmed := strings.TrimSpace(first)
+	switch {
+	case trimmed == blockDelimiter:
+		return readBlock(r, nil, func(line string) bool { return strings.TrimSpace(line) == blockDelimiter })
+	case looksLikeLabData(trimmed):
+		return readBlock(r, []string{first}, func(line string) bool { return strings.TrimSpace(line) == "" })
+	}
+	return first, nil
+}
+
+// readBlock 持续读取直到 end 返回 true；中途放弃输入时返回 ErrPromptAborted，输入结束时返回已读取的内容
+func readBlock(r lineReader, lines []string, end func(string) bool) (string, error) {
+	for {
+		line, err := r.Prompt(promptContinue)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if end(line) {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// looksLikeLabData 判断一行输入是否像化验单的一部分
+func looksLikeLabData(line string) bool {
+	if line == "" || strings.HasPrefix(line, "/") {
+		return false
+	}
+	if patientLineRe.MatchString(line) || patientIDLineRe.MatchString(line) || sectionHeaderRe.MatchString(line) {
+		return true
+	}
+	if _, ok := parseReportDate(line); ok {
+		return true
+	}
+	if m := labValueRe.FindStringSubmatch(line); m != nil {
+		return classifyAnalyte(m[1]) != ""
+	}
+	return false
+}
+
+// exchange 一轮问答
+type exchange struct {
+	Time     time.Time `json:"time"`
+	Question string    `json:"question"`
+	Answer   string    `json:"answer"`
+}
+
+// session 交互式对话会话
+type session struct {
+	llm       llms.Model
+	rules     *RuleEngine
+	knowledge *MedicalKnowledgeBase
+	patients  *PatientStore
+	guideline *GuidelineIndex // 指南检索索引，未配置指南文档时为 nil
+	memory    *memory.ConversationBuffer
+	executor  *agents.Executor
+	patient   *PatientProfile // 当前患者，未设置时为 nil
+	history   []exchange      // 本次会话的问答记录，用于 /export
+	out       io.Writer
+	recorder  *cassetteRecorder // 录制或回放模型和工具调用，未启用时为 nil
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // 正在进行的分析，按 Ctrl-C 时取消
+}
+
+// newSession 创建对话会话并按当前患者构建智能体，knowledge 为 nil 时使用内置知识
+func newSession(llm llms.Model, rules *RuleEngine, knowledge *MedicalKnowledgeBase, patients *PatientStore, out io.Writer) (*session, error) {
+	if knowledge == nil {
+		knowledge = NewMedicalKnowledgeBase()
+	}
+	s := &session{
+		llm:       llm,
+		rules:     rules,
+		knowledge: knowledge,
+		patients:  patients,
+		memory:    memory.NewConversationBuffer(),
+		out:       out,
+	}
+	if patients != nil {
+		current, err := patients.CurrentPatient()
+		if err != nil {
+			return nil, fmt.Errorf("读取当前患者失败: %w", err)
+		}
+		if current != "" {
+			if s.patient, err = patients.GetPatient(current); err != nil {
+				return nil, fmt.Errorf("读取当前患者失败: %w", err)
+			}
+		}
+	}
+	s.buildAgent()
+	return s, nil
+}
+
+// buildAgent 创建工具和智能体，当前患者的档案作为化验单分析的默认患者信息
+func (s *session) buildAgent() {
+	goutAnalyzer := GoutLabAnalyzer{Rules: s.rules, Knowledge: s.knowledge}
+	if s.patients != nil {
+		goutAnalyzer.History = s.patients
+	}
+	if s.recorder != nil {
+		// 录制和回放时未注明日期的化验单都记为录制当天，回放结果与录音一致
+		goutAnalyzer.ReportDate = s.recorder.cassette.RecordedAt
+	}
+	patientTool := CurrentPatientTool{Store: s.patients, Knowledge: s.knowledge}
+	if s.patient != nil {
+		goutAnalyzer.Patient = s.patient.Context()
+		goutAnalyzer.PatientID = s.patient.ID
+		patientTool.PatientID = s.patient.ID
+	}
+	// 工具列表
+	agentTools := []tools.Tool{
+		goutAnalyzer,
+		s.knowledge,
+		GoutClassifier{LabAnalyzer: goutAnalyzer}, // ACR/EULAR 2015 痛风分类评分
+		UrateTrendTool{LabAnalyzer: goutAnalyzer}, // 血尿酸趋势，与化验单分析共用化验历史
+		patientTool,        // 查询本次会话的患者
+		tools.Calculator{}, // 添加计算器工具用于数值计算
+	}
+	if s.guideline != nil {
+		agentTools = append(agentTools, GuidelineSearchTool{Index: s.guideline}) // 检索本地临床指南原文
+	}
+	for i, t := range agentTools {
+		agentTools[i] = eventTool{Tool: t}
+		if s.recorder != nil {
+			agentTools[i] = s.recorder.tool(agentTools[i])
+		}
+	}
+
+	// 创建对话型智能体
+	// 回调将模型输出片段和工具调用转换为流式事件
+	agent := agents.NewConversationalAgent(
+		s.llm,
+		agentTools,
+		agents.WithMaxIterations(5),
+		agents.WithCallbacksHandler(agentEventHandler{}),
+	)
+
+	// 创建执行器
+	s.executor = agents.NewExecutor(
+		agent,
+		agents.WithMemory(s.memory),
+		agents.WithCallbacksHandler(agentEventHandler{}),
+	)
+}
+
+// setPatient 切换当前患者并重建智能体，profile 为 nil 时不使用患者档案
+func (s *session) setPatient(profile *PatientProfile) {
+	s.patient = profile
+	s.buildAgent()
+}
+
+// setGuidelines 启用指南检索并重建智能体
+func (s *session) setGuidelines(index *GuidelineIndex) {
+	s.guideline = index
+	s.buildAgent()
+}
+
+// setRecorder 启用录制或回放，模型和工具调用经录音机转发
+func (s *session) setRecorder(r *cassetteRecorder) {
+	s.recorder = r
+	s.llm = r.model(s.llm)
+	s.buildAgent()
+}
+
+// loop 交互式对话循环，输入 exit 或 Ctrl-D 时返回
+func (s *session) loop(ctx context.Context) error {
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetCompleter(completeSlashCommand)
+
+	historyPath := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyPath = filepath.Join(home, historyFileName)
+		if f, err := os.Open(historyPath); err == nil {
+			line.ReadHistory(f)
+			f.Close()
+		}
+	}
+	defer func() {
+		if historyPath == "" {
+			return
+		}
+		if f, err := os.Create(historyPath); err == nil {
+			line.WriteHistory(f)
+			f.Close()
+		}
+	}()
+
+	// 分析过程中终端处于普通模式，Ctrl-C 以信号送达，只取消当前分析
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			if !s.interrupt() {
+				fmt.Fprintln(s.out, "\n（输入 exit 或按 Ctrl-D 退出）")
+			}
+		}
+	}()
+
+	for {
+		fmt.Fprintln(s.out)
+		input, err := readInput(line)
+		if errors.Is(err, liner.ErrPromptAborted) {
+			fmt.Fprintln(s.out, "（已放弃本次输入，输入 exit 或按 Ctrl-D 退出）")
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(s.out, "\n👋 感谢使用痛风分析智能体，祝您身体健康！")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取输入失败: %w", err)
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			fmt.Fprintln(s.out, "请输入您的问题或化验单数据，输入 /help 查看可用命令。")
+			continue
+		}
+		if !strings.Contains(input, "\n") {
+			line.AppendHistory(input)
+		}
+
+		if quit := s.handle(ctx, input); quit {
+			fmt.Fprintln(s.out, "\n👋 感谢使用痛风分析智能体，祝您身体健康！")
+			return nil
+		}
+	}
+}
+
+// handle 处理一次输入，返回是否退出
+func (s *session) handle(ctx context.Context, input string) bool {
+	lower := strings.ToLower(input)
+	if lower == "exit" || lower == "/exit" || lower == "/quit" {
+		return true
+	}
+	if strings.HasPrefix(input, "/") {
+		if err := s.command(ctx, input); err != nil {
+			fmt.Fprintf(s.out, "❌ %v\n", err)
+		}
+		return false
+	}
+
+	fmt.Fprintln(s.out, "\n🔍 分析中...（按 Ctrl-C 取消）")
+	printer := &streamPrinter{out: s.out}
+	result, err := s.askStream(ctx, input, printer.print)
+	if printer.answering {
+		fmt.Fprintln(s.out)
+	}
+	if errors.Is(err, errAnalysisCanceled) {
+		fmt.Fprintln(s.out, "⏹  已取消本次分析")
+		return false
+	}
+	if err != nil {
+		fmt.Fprintf(s.out, "❌ 处理过程中出现错误: %v\n", err)
+		return false
+	}
+
+	// 模型不支持流式输出时一次性显示答复
+	if !printer.answering {
+		printer.header()
+		fmt.Fprintln(s.out, result)
+	}
+	fmt.Fprintln(s.out, "───────────────────────────────────────")
+	fmt.Fprintln(s.out, "\n💬 如有其他问题，请继续输入，或输入 'exit' 退出")
+	return false
+}
+
+// streamPrinter 在终端上逐步显示工具调用和答复
+type streamPrinter struct {
+	out       io.Writer
+	answering bool // 已开始输出答复
+}
+
+// print 显示一个智能体事件
+func (p *streamPrinter) print(e AgentEvent) {
+	switch e.Type {
+	case agentEventThought:
+		fmt.Fprintf(p.out, "💭 %s\n", e.Text)
+	case agentEventToolStart:
+		fmt.Fprintf(p.out, "🔧 调用 %s: %s\n", e.Tool, abbreviate(e.Input, 60))
+	case agentEventToolEnd:
+		if e.Error != "" {
+			fmt.Fprintf(p.out, "⚠️  %s 出错: %s\n", e.Tool, e.Error)
+		} else {
+			fmt.Fprintf(p.out, "   ✔ %s 完成\n", e.Tool)
+		}
+	case agentEventToken:
+		if !p.answering {
+			p.header()
+			p.answering = true
+		}
+		fmt.Fprint(p.out, e.Text)
+	}
+}
+
+// header 显示答复标题
+func (p *streamPrinter) header() {
+	fmt.Fprintln(p.out, "\n📋 分析结果:")
+	fmt.Fprintln(p.out, "───────────────────────────────────────")
+}
+
+// abbreviate 将文本压缩为一行，超过 n 个字符时截断
+func abbreviate(text string, n int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	return string(runes[:n]) + "…"
+}
+
+// ask 调用智能体，分析过程可通过 interrupt 取消
+func (s *session) ask(ctx context.Context, input string) (string, error) {
+	runCtx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	if s.recorder != nil {
+		if err := s.recorder.begin(input); err != nil {
+			return "", err
+		}
+	}
+	result, err := chains.Run(runCtx, s.executor, input)
+	if err != nil && runCtx.Err() != nil && ctx.Err() == nil {
+		if s.recorder != nil {
+			s.recorder.discard()
+		}
+		return "", errAnalysisCanceled
+	}
+	if s.recorder != nil {
+		if recErr := s.recorder.end(result, err); errors.Is(recErr, errCassetteDrift) {
+			return "", recErr
+		} else if recErr != nil {
+			fmt.Fprintf(s.out, "⚠️  保存录音失败: %v\n", recErr)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	s.history = append(s.history, exchange{Time: time.Now(), Question: input, Answer: result})
+	return result, nil
+}
+
+// askStream 调用智能体，处理过程中的思考、工具调用和答复片段依次传给 emit
+func (s *session) askStream(ctx context.Context, input string, emit func(AgentEvent)) (string, error) {
+	return s.ask(withAgentEvents(ctx, emit), input)
+}
+
+// interrupt 取消正在进行的分析，没有进行中的分析时返回 false
+func (s *session) interrupt() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel == nil {
+		return false
+	}
+	s.cancel()
+	return true
+}
+
+// command 执行斜杠命令
+func (s *session) command(ctx context.Context, input string) error {
+	fields := strings.Fields(input)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "/help":
+		fmt.Fprintln(s.out, slashCommandHelp)
+	case "/reset":
+		if err := s.memory.Clear(ctx); err != nil {
+			return fmt.Errorf("清空对话记忆失败: %w", err)
+		}
+		s.history = nil
+		fmt.Fprintln(s.out, "✅ 已清空对话记忆，开始新的对话")
+		return s.recordCommand(input)
+	case "/patient":
+		if err := s.patientCommand(ctx, args); err != nil || len(args) == 0 {
+			return err
+		}
+		return s.recordCommand(input)
+	case "/export":
+		path := fmt.Sprintf("gout_session_%s.md", time.Now().Format("20060102_150405"))
+		if len(args) > 0 {
+			path = args[0]
+		}
+		if err := s.export(path); err != nil {
+			return fmt.Errorf("导出对话失败: %w", err)
+		}
+		fmt.Fprintf(s.out, "✅ 已导出 %d 轮对话到 %s\n", len(s.history), path)
+	default:
+		return fmt.Errorf("未知命令 %s，输入 /help 查看可用命令", name)
+	}
+	return nil
+}
+
+// recordCommand 录制改变会话状态的命令，回放时检查命令顺序是否一致
+func (s *session) recordCommand(input string) error {
+	if s.recorder == nil {
+		return nil
+	}
+	if err := s.recorder.command(input); errors.Is(err, errCassetteDrift) {
+		return err
+	} else if err != nil {
+		fmt.Fprintf(s.out, "⚠️  保存录音失败: %v\n", err)
+	}
+	return nil
+}
+
+// patientCommand 查看或切换当前患者
+func (s *session) patientCommand(ctx context.Context, args []string) error {
+	if s.patients == nil {
+		return errors.New("未配置患者库")
+	}
+	if len(args) == 0 {
+		if s.patient == nil {
+			fmt.Fprintln(s.out, "尚未设置当前患者，使用 /patient <编号> 切换患者")
+			return nil
+		}
+		summary, err := summarizePatient(s.patients, s.patient.ID, s.knowledge)
+		if err != nil {
+			return err
+		}
+		p := summary.Patient
+		fmt.Fprintf(s.out, "👤 当前患者: %s %s %s %d岁\n", p.ID, p.Name, p.Sex, p.Age)
+		fmt.Fprintf(s.out, "   合并症: %s\n", strings.Join(p.Comorbidities, "、"))
+		fmt.Fprintf(s.out, "   当前用药: %s\n", strings.Join(p.Medications, "、"))
+		fmt.Fprintf(s.out, "   发作 %d 次，化验记录 %d 次\n", len(p.Flares), len(summary.ReportDates))
+		return nil
+	}
+
+	id := args[0]
+	if err := s.patients.SetCurrentPatient(id); err != nil {
+		return err
+	}
+	profile, err := s.patients.GetPatient(id)
+	if err != nil {
+		return err
+	}
+	if err := s.memory.Clear(ctx); err != nil {
+		return fmt.Errorf("清空对话记忆失败: %w", err)
+	}
+	s.setPatient(profile)
+	fmt.Fprintf(s.out, "✅ 已切换到患者 %s %s，对话记忆已清空\n", profile.ID, profile.Name)
+	return nil
+}
+
+// export 将问答记录写入 Markdown 文件
+func (s *session) export(path string) error {
+	var b strings.Builder
+	b.WriteString("# 痛风分析对话记录\n\n")
+	if s.patient != nil {
+		fmt.Fprintf(&b, "患者: %s %s\n\n", s.patient.ID, s.patient.Name)
+	}
+	for i, e := range s.history {
+		fmt.Fprintf(&b, "## %d. %s\n\n", i+1, e.Time.Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(&b, "**问题**\n\n```\n%s\n```\n\n", e.Question)
+		fmt.Fprintf(&b, "**回答**\n\n%s\n\n", e.Answer)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// completeSlashCommand 补全斜杠命令
+func completeSlashCommand(line string) []string {
+	if !strings.HasPrefix(line, "/") {
+		return nil
+	}
+	var matches []string
+	for _, command := range []string{"/help", "/reset", "/patient", "/export", "/exit"} {
+		if strings.HasPrefix(command, line) {
+			matches = append(matches, command)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// knowledgeDirEnv 指定知识库数据目录的环境变量，未设置时使用内置知识
+const knowledgeDirEnv = "GOUT_KNOWLEDGE_DIR"
+
+// knowledgeDateLayout 条目审核日期的格式
+const knowledgeDateLayout = "2006-01-02"
+
+// defaultKnowledgeFS 内置的知识库数据文件
+//
+//go:embed knowledge/*.yaml
+var defaultKnowledgeFS embed.FS
+
+var (
+	defaultKnowledgeOnce sync.Once
+	defaultKnowledge     *MedicalKnowledgeBase
+)
+
+// KnowledgeError 知识库数据校验错误，列出全部问题
+type KnowledgeError struct {
+	Problems []string
+}
+
+func (e *KnowledgeError) Error() string {
+	return fmt.Sprintf("知识库校验失败: %s", strings.Join(e.Problems, "; "))
+}
+
+// LoadMedicalKnowledgeBase 从数据目录加载知识库，dir 为空时使用内置知识
+// 目录下每个 .json、.yaml 或 .yml 文件包含一个条目或条目列表，整个目录替换内置知识
+func LoadMedicalKnowledgeBase(dir string) (*MedicalKnowledgeBase, error) {
+	if dir == "" {
+		sub, err := fs.Sub(defaultKnowledgeFS, "knowledge")
+		if err != nil {
+			return nil, err
+		}
+		return loadKnowledge(sub)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取知识库目录失败: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("知识库路径 %s 不是目录", dir)
+	}
+	return loadKnowledge(os.DirFS(dir))
+}
+
+// loadKnowledgeBase 按环境变量加载知识库：GOUT_KNOWLEDGE_DIR 指定数据目录，
+// GOUT_SITE_RANGES 指定检验机构参考范围文件，登记到知识库的参考范围登记表
+// 各运行模式都通过它加载知识库
+func loadKnowledgeBase() (*MedicalKnowledgeBase, error) {
+	kb, err := LoadMedicalKnowledgeBase(os.Getenv(knowledgeDirEnv))
+	if err != nil {
+		return nil, fmt.Errorf("加载医学知识库失败: %w", err)
+	}
+	if path := os.Getenv(siteRangesEnv); path != "" {
+		if err := kb.ReferenceRanges().LoadSiteRangesFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return kb, nil
+}
+
+// defaultKnowledgeBase 返回内置知识的共享副本
+func defaultKnowledgeBase() *MedicalKnowledgeBase {
+	defaultKnowledgeOnce.Do(func() {
+		kb, err := LoadMedicalKnowledgeBase("")
+		if err != nil {
+			panic(fmt.Sprintf("内置知识库无效: %v", err))
+		}
+		defaultKnowledge = kb
+	})
+	kb := *defaultKnowledge
+	return &kb
+}
+
+// loadKnowledge 按文件名顺序读取目录下的数据文件并校验全部条目
+func loadKnowledge(fsys fs.FS) (*MedicalKnowledgeBase, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("读取知识库目录失败: %w", err)
+	}
+
+	var problems []string
+	knowledge := make(map[string]MedicalInfo)
+	sources := make(map[string]string)
+	phrases := make(map[string]string) // 关键词和别名的规范形式 → 所属条目
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !isKnowledgeFile(name) {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		entries, err := parseKnowledgeFile(name, data)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		for i, info := range entries {
+			source := name
+			if len(entries) > 1 {
+				source = fmt.Sprintf("%s 第 %d 条", name, i+1)
+			}
+			for _, problem := range info.Validate() {
+				problems = append(problems, fmt.Sprintf("%s: %s", source, problem))
+			}
+			if info.Key == "" {
+				continue
+			}
+			if previous, ok := sources[info.Key]; ok {
+				problems = append(problems, fmt.Sprintf("%s: 主题关键词 %q 与 %s 重复", source, info.Key, previous))
+				continue
+			}
+			sources[info.Key] = source
+			knowledge[info.Key] = info
+			for _, value := range append([]string{info.Key}, info.Aliases...) {
+				phrase := newKnowledgePhrase("aliases", value).text
+				if owner, ok := phrases[phrase]; ok && phrase != "" {
+					problems = append(problems, fmt.Sprintf("%s: 别名 %q 与条目 %s 的关键词或别名重复", source, value, owner))
+					continue
+				}
+				phrases[phrase] = info.Key
+			}
+		}
+	}
+	if len(problems) == 0 && len(knowledge) == 0 {
+		problems = append(problems, "没有找到知识条目 (.json、.yaml 或 .yml 文件)")
+	}
+	if len(problems) > 0 {
+		return nil, &KnowledgeError{Problems: problems}
+	}
+
+	kb := &MedicalKnowledgeBase{
+		knowledge: knowledge,
+		index:     newKnowledgeIndex(knowledge),
+		version:   knowledgeVersion(knowledge),
+	}
+	// 化验单分析的默认参考范围和降尿酸目标取自加载的条目，修改数据文件后与知识查询的内容一致
+	kb.ranges = NewReferenceRangeRegistry(kb)
+	kb.targets = urateTargetsFromKnowledge(kb)
+	return kb, nil
+}
+
+// isKnowledgeFile 判断文件是否为知识库数据文件
+func isKnowledgeFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// parseKnowledgeFile 解析数据文件，内容可以是单个条目或条目列表，不允许出现未定义的字段
+func parseKnowledgeFile(name string, data []byte) ([]MedicalInfo, error) {
+	if strings.ToLower(path.Ext(name)) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			var entries []MedicalInfo
+			if err := decoder.Decode(&entries); err != nil {
+				return nil, fmt.Errorf("解析 JSON 失败: %w", err)
+			}
+			return entries, nil
+		}
+		var info MedicalInfo
+		if err := decoder.Decode(&info); err != nil {
+			return nil, fmt.Errorf("解析 JSON 失败: %w", err)
+		}
+		return []MedicalInfo{info}, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析 YAML 失败: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("文件为空")
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if doc.Content[0].Kind == yaml.SequenceNode {
+		var entries []MedicalInfo
+		if err := decoder.Decode(&entries); err != nil {
+			return nil, fmt.Errorf("解析 YAML 失败: %w", err)
+		}
+		return entries, nil
+	}
+	var info MedicalInfo
+	if err := decoder.Decode(&info); err != nil {
+		return nil, fmt.Errorf("解析 YAML 失败: %w", err)
+	}
+	return []MedicalInfo{info}, nil
+}
+
+// Validate 校验条目的必填字段、审核日期、别名和内容小节，返回全部问题
+// 审核日期只能由内容编辑在临床审核后填写，未审核的条目可以省略，填写时须为 YYYY-MM-DD
+func (info MedicalInfo) Validate() []string {
+	var problems []string
+	required := []struct{ field, value string }{
+		{"key", info.Key},
+		{"topic", info.Topic},
+		{"definition", info.Definition},
+		{"version", info.Version},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			problems = append(problems, fmt.Sprintf("缺少 %s", r.field))
+		}
+	}
+	if info.LastReviewed != "" {
+		if _, err := time.Parse(knowledgeDateLayout, info.LastReviewed); err != nil {
+			problems = append(problems, fmt.Sprintf("last_reviewed %q 不是 YYYY-MM-DD 格式的日期", info.LastReviewed))
+		}
+	}
+
+	for i, alias := range info.Aliases {
+		if newKnowledgePhrase("aliases", alias).text == "" {
+			problems = append(problems, fmt.Sprintf("aliases 第 %d 项为空", i+1))
+		}
+	}
+
+	empty := true
+	for _, section := range info.sections() {
+		for i, item := range section.items {
+			if strings.TrimSpace(item) == "" {
+				problems = append(problems, fmt.Sprintf("%s 第 %d 项为空", section.field, i+1))
+			}
+		}
+		if len(section.items) > 0 {
+			empty = false
+		}
+	}
+	if empty {
+		problems = append(problems, "没有任何内容小节 (symptoms、treatment、references 等)")
+	}
+	return problems
+}
+
+// knowledgeSection 条目中的一个列表小节
+type knowledgeSection struct {
+	field string
+	items []string
+}
+
+// sections 按数据文件中的字段名返回条目的列表小节
+func (info MedicalInfo) sections() []knowledgeSection {
+	return []knowledgeSection{
+		{"symptoms", info.Symptoms},
+		{"causes", info.Causes},
+		{"risk_factors", info.RiskFactors},
+		{"diagnosis", info.Diagnosis},
+		{"treatment", info.Treatment},
+		{"prevention", info.Prevention},
+		{"references", info.References},
+	}
+}
+
+// knowledgeVersion 计算知识库的内容版本：全部条目内容的摘要，任一条目变化时随之改变
+func knowledgeVersion(knowledge map[string]MedicalInfo) string {
+	hash := sha256.New()
+	encoder := json.NewEncoder(hash)
+	for _, key := range slices.Sorted(maps.Keys(knowledge)) {
+		encoder.Encode(knowledge[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// runKnowledgeCommand 处理 knowledge 子命令
+func runKnowledgeCommand(args []string) error {
+	if len(args) == 0 || args[0] != "check" || len(args) > 2 {
+		return fmt.Errorf("用法: knowledge check [知识库目录]")
+	}
+	dir := os.Getenv(knowledgeDirEnv)
+	if len(args) == 2 {
+		dir = args[1]
+	}
+	return checkKnowledge(dir, os.Stdout)
+}
+
+// checkKnowledge 校验知识库目录并列出条目的版本和审核日期
+func checkKnowledge(dir string, out io.Writer) error {
+	source := dir
+	if source == "" {
+		source = "内置知识"
+	}
+	fmt.Fprintf(out, "🔎 检查知识库: %s\n", source)
+
+	kb, err := LoadMedicalKnowledgeBase(dir)
+	if err != nil {
+		if knowledgeErr, ok := err.(*KnowledgeError); ok {
+			for _, problem := range knowledgeErr.Problems {
+				fmt.Fprintf(out, "❌ %s\n", problem)
+			}
+		}
+		return err
+	}
+	for _, info := range kb.Entries() {
+		reviewed := "尚未审核"
+		if info.LastReviewed != "" {
+			reviewed = "审核于 " + info.LastReviewed
+		}
+		fmt.Fprintf(out, "✅ %s: %s (版本 %s，%s)\n", info.Key, info.Topic, info.Version, reviewed)
+	}
+	fmt.Fprintf(out, "\n共 %d 个条目，知识库版本 %s\n", len(kb.Entries()), kb.Version())
+	return nil
+}
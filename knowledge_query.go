@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// knowledgeSectionNames 可单独查询的小节，按条目字段顺序
+var knowledgeSectionNames = []string{
+	"definition", "symptoms", "causes", "risk_factors", "diagnosis", "treatment", "prevention", "references",
+}
+
+// knowledgeSectionLabels 小节的中文名称，结构化查询中可代替字段名
+var knowledgeSectionLabels = map[string]string{
+	"定义":   "definition",
+	"症状":   "symptoms",
+	"病因":   "causes",
+	"危险因素": "risk_factors",
+	"诊断":   "diagnosis",
+	"诊断标准": "diagnosis",
+	"治疗":   "treatment",
+	"治疗方法": "treatment",
+	"预防":   "prevention",
+	"预防措施": "prevention",
+	"参考值":  "references",
+	"参考标准": "references",
+}
+
+// KnowledgeQuery 结构化知识查询：查询主题及需要返回的小节
+type KnowledgeQuery struct {
+	Topic    string   `json:"topic"`              // 查询主题的关键词或问题
+	Sections []string `json:"sections,omitempty"` // 只返回这些小节，为空时返回完整条目
+}
+
+// newKnowledgeQuery 创建结构化查询，小节可用字段名或中文名称，按条目字段顺序去重
+func newKnowledgeQuery(topic string, sections []string) (KnowledgeQuery, error) {
+	query := KnowledgeQuery{Topic: strings.TrimSpace(topic)}
+	if query.Topic == "" {
+		return query, fmt.Errorf("缺少查询主题 topic")
+	}
+	for _, section := range sections {
+		name := strings.ToLower(strings.TrimSpace(section))
+		if name == "" {
+			continue
+		}
+		if label, ok := knowledgeSectionLabels[name]; ok {
+			name = label
+		}
+		if !slices.Contains(knowledgeSectionNames, name) {
+			return query, fmt.Errorf("未知的小节 %q，可选: %s", section, strings.Join(knowledgeSectionNames, "、"))
+		}
+		if !slices.Contains(query.Sections, name) {
+			query.Sections = append(query.Sections, name)
+		}
+	}
+	slices.SortFunc(query.Sections, func(a, b string) int {
+		return slices.Index(knowledgeSectionNames, a) - slices.Index(knowledgeSectionNames, b)
+	})
+	return query, nil
+}
+
+// parseKnowledgeQuery 解析工具输入：以 { 开头时按结构化查询解析，否则整段文本作为查询主题
+func parseKnowledgeQuery(input string) (KnowledgeQuery, error) {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "{") {
+		return newKnowledgeQuery(input, nil)
+	}
+	var query KnowledgeQuery
+	decoder := json.NewDecoder(bytes.NewReader([]byte(input)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&query); err != nil {
+		return query, fmt.Errorf("解析结构化查询失败: %w", err)
+	}
+	return newKnowledgeQuery(query.Topic, query.Sections)
+}
+
+// hasContent 判断条目是否含有定义或任一非空小节
+func (info MedicalInfo) hasContent() bool {
+	return info.Definition != "" || slices.ContainsFunc(info.sections(), func(section knowledgeSection) bool {
+		return len(section.items) > 0
+	})
+}
+
+// withSections 返回只含指定小节的条目副本，保留主题关键词、主题、版本和审核日期，sections 为空时返回完整条目
+func (info MedicalInfo) withSections(sections []string) MedicalInfo {
+	if len(sections) == 0 {
+		return info
+	}
+	selected := MedicalInfo{Key: info.Key, Topic: info.Topic, Version: info.Version, LastReviewed: info.LastReviewed}
+	for _, section := range sections {
+		switch section {
+		case "definition":
+			selected.Definition = info.Definition
+		case "symptoms":
+			selected.Symptoms = info.Symptoms
+		case "causes":
+			selected.Causes = info.Causes
+		case "risk_factors":
+			selected.RiskFactors = info.RiskFactors
+		case "diagnosis":
+			selected.Diagnosis = info.Diagnosis
+		case "treatment":
+			selected.Treatment = info.Treatment
+		case "prevention":
+			selected.Prevention = info.Prevention
+		case "references":
+			selected.References = info.References
+		}
+	}
+	return selected
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BM25 参数
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// keyPhraseBoost 查询中完整出现主题关键词或别名时的加分，出现多个时较长的加分更多
+const keyPhraseBoost = 2.0
+
+// maxPhraseWords 字母别名最多由几个相邻的词拼接匹配，如 "tong feng shi" 匹配 "tongfengshi"
+const maxPhraseWords = 4
+
+// minRelativeScore 得分低于最高分此比例的条目视为噪声，不返回
+const minRelativeScore = 0.2
+
+// 查询返回的条目数
+const (
+	defaultKnowledgeTopK = 3
+	maxKnowledgeTopK     = 10
+)
+
+// knowledgeFieldWeights 各字段词频的权重，主题关键词、别名和主题命中比正文更能说明相关性
+var knowledgeFieldWeights = map[string]float64{
+	"key":        3,
+	"aliases":    3,
+	"topic":      2,
+	"definition": 1.5,
+}
+
+// KnowledgeMatch 一条检索结果：条目内容、相关性得分和命中的字段
+type KnowledgeMatch struct {
+	MedicalInfo
+	Score         float64  `json:"score"`          // BM25F 得分，越高越相关
+	MatchedFields []string `json:"matched_fields"` // 命中查询词的字段，按条目字段顺序
+}
+
+// knowledgeDoc 索引中的一个条目
+type knowledgeDoc struct {
+	info        MedicalInfo
+	fieldTerms  map[string]map[string]float64 // 各字段中词项的词频
+	fieldLength map[string]float64            // 各字段的词项数
+	phrases     []knowledgePhrase             // 主题关键词和别名
+}
+
+// knowledgeIndex 知识条目的全文索引，覆盖全部字段，按 BM25F 排序
+// 各字段分别按自身的平均长度归一化词频，再按字段权重累加，避免正文较长的条目因长度被压低
+type knowledgeIndex struct {
+	docs        []knowledgeDoc     // 按主题关键词排序
+	docFreq     map[string]int     // 包含词项的条目数
+	avgFieldLen map[string]float64 // 各字段的平均长度
+}
+
+// newKnowledgeIndex 为知识条目建立索引
+func newKnowledgeIndex(knowledge map[string]MedicalInfo) *knowledgeIndex {
+	idx := &knowledgeIndex{docFreq: make(map[string]int), avgFieldLen: make(map[string]float64)}
+	for _, key := range slices.Sorted(maps.Keys(knowledge)) {
+		info := knowledge[key]
+		doc := knowledgeDoc{
+			info:        info,
+			fieldTerms:  make(map[string]map[string]float64),
+			fieldLength: make(map[string]float64),
+		}
+		for _, field := range info.fields()[:2] {
+			for _, value := range field.values {
+				if phrase := newKnowledgePhrase(field.name, value); phrase.text != "" {
+					doc.phrases = append(doc.phrases, phrase)
+				}
+			}
+		}
+		seen := make(map[string]bool)
+		for _, field := range info.fields() {
+			terms := make(map[string]float64)
+			for _, text := range field.values {
+				for _, term := range indexTerms(text) {
+					terms[term]++
+					doc.fieldLength[field.name]++
+					seen[term] = true
+				}
+			}
+			doc.fieldTerms[field.name] = terms
+			idx.avgFieldLen[field.name] += doc.fieldLength[field.name]
+		}
+		for term := range seen {
+			idx.docFreq[term]++
+		}
+		idx.docs = append(idx.docs, doc)
+	}
+	for field := range idx.avgFieldLen {
+		idx.avgFieldLen[field] /= float64(len(idx.docs))
+	}
+	return idx
+}
+
+// search 返回得分最高的 k 个条目，得分相同时按主题关键词排序，得分过低的条目不返回
+func (idx *knowledgeIndex) search(query string, k int) []KnowledgeMatch {
+	terms := queryTerms(query)
+	if len(terms) == 0 || len(idx.docs) == 0 {
+		return nil
+	}
+
+	// 二字切分无法区分几乎所有条目都含有的词（如"痛风""尿酸"），完整出现的主题关键词或别名单独加分
+	phrases := newQueryPhrases(query)
+	phraseLen := make([]int, len(idx.docs))
+	longest := 0
+	for i, doc := range idx.docs {
+		for _, phrase := range doc.phrases {
+			if phrases.contains(phrase) {
+				phraseLen[i] = max(phraseLen[i], utf8.RuneCountInString(phrase.text))
+			}
+		}
+		longest = max(longest, phraseLen[i])
+	}
+
+	n := float64(len(idx.docs))
+	var matches []KnowledgeMatch
+	for i, doc := range idx.docs {
+		score := 0.0
+		matched := make(map[string]bool)
+		if phraseLen[i] > 0 {
+			score += keyPhraseBoost * float64(phraseLen[i]) / float64(longest)
+			for _, phrase := range doc.phrases {
+				if phrases.contains(phrase) {
+					matched[phrase.field] = true
+				}
+			}
+		}
+		for _, term := range terms {
+			tf := 0.0
+			for field, counts := range doc.fieldTerms {
+				count := counts[term]
+				if count == 0 {
+					continue
+				}
+				matched[field] = true
+				weight := knowledgeFieldWeights[field]
+				if weight == 0 {
+					weight = 1
+				}
+				tf += weight * count / (1 - bm25B + bm25B*doc.fieldLength[field]/idx.avgFieldLen[field])
+			}
+			if tf == 0 {
+				continue
+			}
+			df := float64(idx.docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1)
+		}
+		if score == 0 {
+			continue
+		}
+		match := KnowledgeMatch{MedicalInfo: doc.info, Score: math.Round(score*1000) / 1000}
+		for _, field := range doc.info.fields() {
+			if matched[field.name] {
+				match.MatchedFields = append(match.MatchedFields, field.name)
+			}
+		}
+		matches = append(matches, match)
+	}
+
+	slices.SortStableFunc(matches, func(a, b KnowledgeMatch) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	for i, m := range matches {
+		if m.Score < matches[0].Score*minRelativeScore {
+			matches = matches[:i]
+			break
+		}
+	}
+	if k > 0 && len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+// knowledgeField 条目中参与检索的一个字段
+type knowledgeField struct {
+	name   string
+	values []string
+}
+
+// fields 按数据文件中的字段名返回参与检索的字段，前两项为主题关键词和别名
+func (info MedicalInfo) fields() []knowledgeField {
+	fields := []knowledgeField{
+		{"key", []string{info.Key}},
+		{"aliases", info.Aliases},
+		{"topic", []string{info.Topic}},
+		{"definition", []string{info.Definition}},
+	}
+	for _, section := range info.sections() {
+		fields = append(fields, knowledgeField{section.field, section.items})
+	}
+	return fields
+}
+
+// indexTerms 将条目文本切分为词项：汉字切分为单字和相邻二字，其他字母和数字按词切分
+func indexTerms(text string) []string {
+	var terms []string
+	for _, run := range textRuns(text) {
+		if !run.han {
+			terms = append(terms, run.text)
+			continue
+		}
+		chars := []rune(run.text)
+		for i := range chars {
+			terms = append(terms, string(chars[i]))
+			if i+1 < len(chars) {
+				terms = append(terms, string(chars[i:i+2]))
+			}
+		}
+	}
+	return terms
+}
+
+// queryTerms 将查询切分为词项：汉字按相邻二字切分，单独的汉字按单字，重复的词项只保留一次
+func queryTerms(query string) []string {
+	var terms []string
+	for _, run := range textRuns(query) {
+		chars := []rune(run.text)
+		if !run.han || len(chars) == 1 {
+			terms = append(terms, run.text)
+			continue
+		}
+		for i := 0; i+1 < len(chars); i++ {
+			terms = append(terms, string(chars[i:i+2]))
+		}
+	}
+	slices.Sort(terms)
+	return slices.Compact(terms)
+}
+
+// knowledgePhrase 条目的主题关键词或一个别名
+type knowledgePhrase struct {
+	field string // key 或 aliases
+	text  string // 规范形式：小写、去掉声调，去掉标点和空白后拼接
+	latin bool   // 不含汉字，须与查询中相邻的完整词匹配，避免 "ua" 匹配到 "uric"
+}
+
+// newKnowledgePhrase 返回关键词或别名的规范形式，"Uric-Acid"、"uric acid" 和 "uricacid" 规范形式相同
+func newKnowledgePhrase(field, value string) knowledgePhrase {
+	phrase := knowledgePhrase{field: field, latin: true}
+	for _, run := range textRuns(value) {
+		phrase.text += run.text
+		if run.han {
+			phrase.latin = false
+		}
+	}
+	return phrase
+}
+
+// queryPhrases 查询中可与关键词或别名匹配的形式
+type queryPhrases struct {
+	text  string          // 全部文本拼接，汉字关键词按子串匹配
+	words map[string]bool // 相邻字母数字词的拼接，字母关键词按整体匹配
+}
+
+// newQueryPhrases 规范化查询，拼接最多 maxPhraseWords 个相邻的字母数字词
+func newQueryPhrases(query string) queryPhrases {
+	q := queryPhrases{words: make(map[string]bool)}
+	runs := textRuns(query)
+	for i, run := range runs {
+		q.text += run.text
+		word := ""
+		for j := i; j < len(runs) && j < i+maxPhraseWords && !runs[j].han; j++ {
+			word += runs[j].text
+			q.words[word] = true
+		}
+	}
+	return q
+}
+
+// contains 判断查询中是否完整出现关键词或别名
+func (q queryPhrases) contains(phrase knowledgePhrase) bool {
+	if phrase.latin {
+		return q.words[phrase.text]
+	}
+	return strings.Contains(q.text, phrase.text)
+}
+
+// textRun 连续的汉字或连续的字母数字
+type textRun struct {
+	text string
+	han  bool
+}
+
+// pinyinTones 去掉拼音声调，"tòngfēng" 与 "tongfeng" 相同，ü 按输入法习惯写作 v
+var pinyinTones = strings.NewReplacer(
+	"ā", "a", "á", "a", "ǎ", "a", "à", "a",
+	"ē", "e", "é", "e", "ě", "e", "è", "e",
+	"ī", "i", "í", "i", "ǐ", "i", "ì", "i",
+	"ō", "o", "ó", "o", "ǒ", "o", "ò", "o",
+	"ū", "u", "ú", "u", "ǔ", "u", "ù", "u",
+	"ǖ", "v", "ǘ", "v", "ǚ", "v", "ǜ", "v", "ü", "v",
+)
+
+// textRuns 按字符类别切分文本，转为小写并去掉拼音声调，标点和空白作为分隔
+func textRuns(text string) []textRun {
+	var runs []textRun
+	var current []rune
+	han := false
+	flush := func() {
+		if len(current) > 0 {
+			runs = append(runs, textRun{text: string(current), han: han})
+			current = current[:0]
+		}
+	}
+	for _, r := range pinyinTones.Replace(strings.ToLower(text)) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			if !han {
+				flush()
+			}
+			han = true
+			current = append(current, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if han {
+				flush()
+			}
+			han = false
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return runs
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reportDateLayout 化验日期的输出格式
+const reportDateLayout = "2006-01-02"
+
+var (
+	// 化验日期行，如 "日期: 2024-03-15"、"采样日期：2024年3月15日"、"[2024/03/15]"
+	reportDateLineRe = regexp.MustCompile(`(?i)^\s*[\[【(（]?\s*(?:(?:检查|采样|采集|报告|化验)?日期|date)?\s*[：:]?\s*` +
+		`([0-9]{4})\s*[-/.年]\s*([0-9]{1,2})\s*[-/.月]\s*([0-9]{1,2})\s*日?\s*[\]】)）]?\s*$`)
+	// 患者编号行，如 "患者编号: P001"、"病历号：123456"
+	patientIDLineRe = regexp.MustCompile(`(?i)^\s*(?:患者编号|患者ID|病历号|门诊号|住院号|patient[ _-]?id)\s*[：:]\s*(\S+)\s*$`)
+)
+
+// DatedLabReport 某一日期的化验结果
+type DatedLabReport struct {
+	Date    time.Time   `json:"date"`
+	Results []LabResult `json:"results"`
+}
+
+// LabHistoryStore 患者历次化验结果存储
+type LabHistoryStore interface {
+	// SaveReport 保存一次化验结果，同一日期的结果会被替换
+	SaveReport(patientID string, report DatedLabReport) error
+	// Reports 按日期升序返回患者的历次化验结果
+	Reports(patientID string) ([]DatedLabReport, error)
+}
+
+// MemoryLabHistory 内存中的化验历史存储
+type MemoryLabHistory struct {
+	mu      sync.RWMutex
+	reports map[string][]DatedLabReport
+}
+
+// NewMemoryLabHistory 创建内存化验历史存储
+func NewMemoryLabHistory() *MemoryLabHistory {
+	return &MemoryLabHistory{reports: make(map[string][]DatedLabReport)}
+}
+
+// SaveReport 保存一次化验结果
+func (m *MemoryLabHistory) SaveReport(patientID string, report DatedLabReport) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reports := m.reports[patientID]
+	for i := range reports {
+		if reports[i].Date.Equal(report.Date) {
+			reports[i] = report
+			return nil
+		}
+	}
+	reports = append(reports, report)
+	sortReports(reports)
+	m.reports[patientID] = reports
+	return nil
+}
+
+// Reports 返回患者的历次化验结果
+func (m *MemoryLabHistory) Reports(patientID string) ([]DatedLabReport, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]DatedLabReport(nil), m.reports[patientID]...), nil
+}
+
+// sortReports 按日期升序排列
+func sortReports(reports []DatedLabReport) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Date.Before(reports[j].Date)
+	})
+}
+
+// datedSection 输入中某一日期的化验数据
+// Text 保留原始行数，其他日期的行替换为空行，保证解析报告中的行号与原始输入一致
+type datedSection struct {
+	Date time.Time
+	Text string
+}
+
+// labHistoryInput 从输入中拆分出的患者编号和各日期化验数据
+type labHistoryInput struct {
+	PatientID string
+	Sections  []datedSection // 按日期升序；输入不含日期行时为空
+	Text      string         // 去除患者编号和日期行后的全部化验数据
+}
+
+// latest 返回最近一次化验数据，无日期时返回全部化验数据
+func (h labHistoryInput) latest() string {
+	if len(h.Sections) == 0 {
+		return h.Text
+	}
+	return h.Sections[len(h.Sections)-1].Text
+}
+
+// splitLabHistory 按日期行拆分多次化验数据
+// 第一个日期行之前的化验项目归入第一次化验；同一日期出现多次时合并
+func splitLabHistory(input string) labHistoryInput {
+	var history labHistoryInput
+	lines := strings.Split(input, "\n")
+	owner := make([]int, len(lines)) // 各行所属的日期下标，-1 表示不属于任何日期
+	byDate := make(map[time.Time]int)
+	var dates []time.Time
+	current := -1
+
+	for i, line := range lines {
+		owner[i] = -1
+		if m := patientIDLineRe.FindStringSubmatch(line); m != nil {
+			history.PatientID = m[1]
+			lines[i] = ""
+			continue
+		}
+		if date, ok := parseReportDate(line); ok {
+			idx, seen := byDate[date]
+			if !seen {
+				idx = len(dates)
+				byDate[date] = idx
+				dates = append(dates, date)
+			}
+			current = idx
+			lines[i] = ""
+			continue
+		}
+		owner[i] = current
+	}
+	history.Text = strings.Join(lines, "\n")
+	if len(dates) == 0 {
+		return history
+	}
+
+	for i := range owner {
+		if owner[i] == -1 {
+			owner[i] = 0
+		}
+	}
+	for idx, date := range dates {
+		section := make([]string, len(lines))
+		for i, line := range lines {
+			if owner[i] == idx {
+				section[i] = line
+			}
+		}
+		history.Sections = append(history.Sections, datedSection{Date: date, Text: strings.Join(section, "\n")})
+	}
+	sort.SliceStable(history.Sections, func(i, j int) bool {
+		return history.Sections[i].Date.Before(history.Sections[j].Date)
+	})
+	return history
+}
+
+// parseReportDate 解析化验日期行
+func parseReportDate(line string) (time.Time, bool) {
+	m := reportDateLineRe.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	// 拒绝 2024-02-30 之类被 time.Date 自动进位的日期
+	if date.Month() != time.Month(month) || date.Day() != day {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// reportDay 返回 t 当地日期的零点（UTC），与化验日期行的解析结果一致
+func reportDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// prepareInput 依次提取患者信息行、检验机构行、患者编号和各日期化验数据，Analyze 和 UrateTrendTool 共用
+// 输入中的患者信息覆盖默认患者信息，检验机构行覆盖默认检验机构；患者编号与绑定的患者不一致时返回错误
+func (g *GoutLabAnalyzer) prepareInput(input string) (PatientContext, labHistoryInput, error) {
+	inputPatient, labInput := parsePatientContext(input)
+	patient := g.Patient.merge(inputPatient)
+	site, labInput := parseSiteLine(labInput)
+	if site != "" {
+		g.Site = site
+	}
+	history := splitLabHistory(labInput)
+	return patient, history, g.checkPatientID(history)
+}
+
+// checkPatientID 分析器已绑定患者时，输入中的患者编号必须与之一致，不能借此查看或写入其他患者的化验历史
+func (g *GoutLabAnalyzer) checkPatientID(history labHistoryInput) error {
+	if g.PatientID != "" && history.PatientID != "" && history.PatientID != g.PatientID {
+		return fmt.Errorf("化验单中的患者编号 %s 与当前患者 %s 不一致", history.PatientID, g.PatientID)
+	}
+	return nil
+}
+
+// historyPatientID 返回保存化验历史的患者编号：分析器绑定的患者，未绑定时为输入中的患者编号；未配置历史存储时返回空
+// 调用前应已通过 checkPatientID 检查
+func (g *GoutLabAnalyzer) historyPatientID(history labHistoryInput) string {
+	if g.History == nil {
+		return ""
+	}
+	if g.PatientID != "" {
+		return g.PatientID
+	}
+	return history.PatientID
+}
+
+// labHistory 解析输入中的各日期化验数据；输入或分析器提供患者编号且配置了历史存储时保存并返回该患者的全部历史
+// 保存时不含日期行的化验单记为 ReportDate 当天的化验，ReportDate 为零时记为分析当天
+func (g *GoutLabAnalyzer) labHistory(history labHistoryInput, patient PatientContext) ([]DatedLabReport, error) {
+	reports := make([]DatedLabReport, 0, len(history.Sections))
+	for _, section := range history.Sections {
+		results, _, _ := g.parseLabInput(section.Text, patient)
+		reports = append(reports, DatedLabReport{Date: section.Date, Results: results})
+	}
+
+	patientID := g.historyPatientID(history)
+	if patientID == "" {
+		return reports, nil
+	}
+	if len(history.Sections) == 0 {
+		if results, _, _ := g.parseLabInput(history.Text, patient); len(results) > 0 {
+			date := g.ReportDate
+			if date.IsZero() {
+				date = time.Now()
+			}
+			reports = append(reports, DatedLabReport{Date: reportDay(date), Results: results})
+		}
+	}
+	for _, report := range reports {
+		if err := g.History.SaveReport(patientID, report); err != nil {
+			return nil, err
+		}
+	}
+	return g.History.Reports(patientID)
+}
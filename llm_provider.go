@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// 模型后端类型
+const (
+	backendOpenAI    = "openai"    // OpenAI 及兼容接口（阿里百炼、vLLM、LM Studio 等）
+	backendOllama    = "ollama"    // 本地 Ollama 服务
+	backendAnthropic = "anthropic" // Anthropic Messages API
+	backendOffline   = "offline"   // 离线脚本模型，不访问网络
+)
+
+// defaultProvider 未指定时使用的模型提供方
+const defaultProvider = "dashscope"
+
+// 模型配置相关的环境变量，优先级高于配置文件
+const (
+	llmConfigEnv      = "GOUT_LLM_CONFIG"
+	llmProviderEnv    = "GOUT_LLM_PROVIDER"
+	llmModelEnv       = "GOUT_LLM_MODEL"
+	llmBaseURLEnv     = "GOUT_LLM_BASE_URL"
+	llmAPIKeyEnv      = "GOUT_LLM_API_KEY"
+	llmTemperatureEnv = "GOUT_LLM_TEMPERATURE"
+	llmMaxTokensEnv   = "GOUT_LLM_MAX_TOKENS"
+	llmTimeoutEnv     = "GOUT_LLM_TIMEOUT"
+)
+
+// Duration 以 "90s"、"2m" 形式书写的时长
+type Duration time.Duration
+
+// UnmarshalJSON 解析时长字符串
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("时长应为字符串，如 \"90s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON 输出时长字符串
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LLMConfig 单个模型提供方的配置
+type LLMConfig struct {
+	Type        string   `json:"type"`                  // 后端类型: openai/ollama/anthropic/offline
+	BaseURL     string   `json:"base_url,omitempty"`    // 接口地址，为空时使用后端默认地址
+	Model       string   `json:"model"`                 // 模型名称
+	APIKey      string   `json:"api_key,omitempty"`     // API 密钥，建议改用 api_key_env
+	APIKeyEnv   string   `json:"api_key_env,omitempty"` // 读取 API 密钥的环境变量
+	Temperature *float64 `json:"temperature,omitempty"` // 采样温度
+	MaxTokens   int      `json:"max_tokens,omitempty"`  // 单次生成的最大 token 数
+	Timeout     Duration `json:"timeout,omitempty"`     // 单次请求超时
+}
+
+// LLMSettings 模型配置文件
+type LLMSettings struct {
+	Provider  string               `json:"provider"`  // 默认使用的提供方
+	Providers map[string]LLMConfig `json:"providers"` // 提供方配置，与内置配置同名时按字段覆盖
+}
+
+// builtinProviders 内置的模型提供方，配置文件中可按名称覆盖其字段
+var builtinProviders = map[string]LLMConfig{
+	"dashscope": {
+		Type:      backendOpenAI,
+		BaseURL:   "https://dashscope.aliyuncs.com/compatible-mode/v1",
+		Model:     "qwen-plus",
+		APIKeyEnv: "DASHSCOPE_API_KEY",
+		Timeout:   Duration(2 * time.Minute),
+	},
+	"openai": {
+		Type:      backendOpenAI,
+		Model:     "gpt-4o-mini",
+		APIKeyEnv: "OPENAI_API_KEY",
+		Timeout:   Duration(2 * time.Minute),
+	},
+	"ollama": {
+		Type:    backendOllama,
+		BaseURL: "http://localhost:11434",
+		Model:   "qwen2.5:7b",
+		Timeout: Duration(5 * time.Minute),
+	},
+	"anthropic": {
+		Type:      backendAnthropic,
+		Model:     "claude-3-5-haiku-latest",
+		APIKeyEnv: "ANTHROPIC_API_KEY",
+		Timeout:   Duration(2 * time.Minute),
+	},
+	"offline": {
+		Type:  backendOffline,
+		Model: "scripted",
+	},
+}
+
+// llmFlags 模型相关的命令行参数，优先级最高
+type llmFlags struct {
+	config      string
+	provider    string
+	model       string
+	baseURL     string
+	temperature float64
+	maxTokens   int
+	timeout     time.Duration
+	offline     bool
+	set         map[string]bool
+}
+
+// registerLLMFlags 在 flags 上注册模型相关参数
+func registerLLMFlags(flags *flag.FlagSet) *llmFlags {
+	f := &llmFlags{}
+	flags.StringVar(&f.config, "config", "", "模型配置文件 (也可用 "+llmConfigEnv+" 指定)")
+	flags.StringVar(&f.provider, "provider", "", "模型提供方，如 dashscope/openai/ollama/anthropic/offline 或配置文件中的名称")
+	flags.StringVar(&f.model, "model", "", "模型名称")
+	flags.StringVar(&f.baseURL, "base-url", "", "接口地址")
+	flags.Float64Var(&f.temperature, "temperature", 0, "采样温度")
+	flags.IntVar(&f.maxTokens, "max-tokens", 0, "单次生成的最大 token 数")
+	flags.DurationVar(&f.timeout, "timeout", 0, "单次请求超时，如 90s")
+	flags.BoolVar(&f.offline, "offline", false, "离线模式，使用确定性的脚本模型，等同于 -provider offline")
+	return f
+}
+
+// parseLLMFlags 解析命令行中的模型参数，不接受其他参数
+func parseLLMFlags(name string, args []string) (*llmFlags, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	f := registerLLMFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("无法识别的参数: %s", strings.Join(flags.Args(), " "))
+	}
+	f.markSet(flags)
+	return f, nil
+}
+
+// markSet 记录命令行中出现过的参数，在 flags 解析后调用
+func (f *llmFlags) markSet(flags *flag.FlagSet) {
+	f.set = make(map[string]bool)
+	flags.Visit(func(fl *flag.Flag) { f.set[fl.Name] = true })
+}
+
+// loadLLMSettings 读取模型配置文件，path 为空时返回空配置
+func loadLLMSettings(path string) (LLMSettings, error) {
+	var settings LLMSettings
+	if path == "" {
+		return settings, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return settings, fmt.Errorf("读取模型配置文件失败: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil {
+		return settings, fmt.Errorf("解析模型配置文件 %s 失败: %w", path, err)
+	}
+	return settings, nil
+}
+
+// resolveLLMConfig 按 命令行参数 > 环境变量 > 配置文件 > 内置配置 的优先级确定模型配置
+func resolveLLMConfig(f *llmFlags) (string, LLMConfig, error) {
+	if f == nil {
+		f = &llmFlags{set: map[string]bool{}}
+	}
+	path := f.config
+	if path == "" {
+		path = os.Getenv(llmConfigEnv)
+	}
+	settings, err := loadLLMSettings(path)
+	if err != nil {
+		return "", LLMConfig{}, err
+	}
+
+	// GOUT_LLM_API_KEY 只用于环境变量或配置文件选定的提供方，
+	// 命令行改选其他提供方时不使用，避免把一个提供方的密钥发送到另一个提供方的接口
+	envProvider := firstNonEmpty(os.Getenv(llmProviderEnv), settings.Provider, defaultProvider)
+	name := firstNonEmpty(f.provider, envProvider)
+	if f.offline {
+		name = "offline"
+	}
+	cfg, builtin := builtinProviders[name]
+	custom, configured := settings.Providers[name]
+	if !builtin && !configured {
+		return "", LLMConfig{}, fmt.Errorf("未知的模型提供方 %q，可选: %s", name, strings.Join(providerNames(settings), ", "))
+	}
+	if configured {
+		cfg = overlayLLMConfig(cfg, custom)
+	}
+
+	// 环境变量
+	env := LLMConfig{
+		Model:   os.Getenv(llmModelEnv),
+		BaseURL: os.Getenv(llmBaseURLEnv),
+	}
+	if name == envProvider {
+		env.APIKey = os.Getenv(llmAPIKeyEnv)
+	}
+	if v := os.Getenv(llmTemperatureEnv); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return "", LLMConfig{}, fmt.Errorf("%s 格式错误: %w", llmTemperatureEnv, err)
+		}
+		env.Temperature = &t
+	}
+	if v := os.Getenv(llmMaxTokensEnv); v != "" {
+		if env.MaxTokens, err = strconv.Atoi(v); err != nil {
+			return "", LLMConfig{}, fmt.Errorf("%s 格式错误: %w", llmMaxTokensEnv, err)
+		}
+	}
+	if v := os.Getenv(llmTimeoutEnv); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return "", LLMConfig{}, fmt.Errorf("%s 格式错误: %w", llmTimeoutEnv, err)
+		}
+		env.Timeout = Duration(timeout)
+	}
+	cfg = overlayLLMConfig(cfg, env)
+
+	// 命令行参数
+	cli := LLMConfig{Model: f.model, BaseURL: f.baseURL, MaxTokens: f.maxTokens, Timeout: Duration(f.timeout)}
+	if f.set["temperature"] {
+		cli.Temperature = &f.temperature
+	}
+	cfg = overlayLLMConfig(cfg, cli)
+
+	return name, cfg, cfg.validate(name)
+}
+
+// overlayLLMConfig 用 override 中已设置的字段覆盖 base
+func overlayLLMConfig(base, override LLMConfig) LLMConfig {
+	if override.Type != "" {
+		base.Type = override.Type
+	}
+	if override.BaseURL != "" {
+		base.BaseURL = override.BaseURL
+	}
+	if override.Model != "" {
+		base.Model = override.Model
+	}
+	if override.APIKey != "" {
+		base.APIKey = override.APIKey
+	}
+	if override.APIKeyEnv != "" {
+		base.APIKeyEnv = override.APIKeyEnv
+	}
+	if override.Temperature != nil {
+		base.Temperature = override.Temperature
+	}
+	if override.MaxTokens > 0 {
+		base.MaxTokens = override.MaxTokens
+	}
+	if override.Timeout > 0 {
+		base.Timeout = override.Timeout
+	}
+	return base
+}
+
+// validate 检查配置是否完整
+func (c LLMConfig) validate(name string) error {
+	var problems []string
+	switch c.Type {
+	case backendOpenAI, backendOllama, backendAnthropic, backendOffline:
+	case "":
+		problems = append(problems, "未指定后端类型 type")
+	default:
+		problems = append(problems, fmt.Sprintf("不支持的后端类型 %q (可选 openai/ollama/anthropic/offline)", c.Type))
+	}
+	if c.Model == "" {
+		problems = append(problems, "未指定模型 model")
+	}
+	if c.Temperature != nil && (*c.Temperature < 0 || *c.Temperature > 2) {
+		problems = append(problems, fmt.Sprintf("temperature 应在 0-2 之间，实际为 %g", *c.Temperature))
+	}
+	if c.MaxTokens < 0 {
+		problems = append(problems, "max_tokens 不能为负数")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("模型提供方 %s 配置错误: %s", name, strings.Join(problems, "；"))
+	}
+	return nil
+}
+
+// apiKey 返回 API 密钥，api_key（含适用于该提供方的 GOUT_LLM_API_KEY）优先，其次读取 api_key_env 指定的环境变量
+func (c LLMConfig) apiKey() string {
+	if c.APIKey != "" {
+		return c.APIKey
+	}
+	if c.APIKeyEnv != "" {
+		return os.Getenv(c.APIKeyEnv)
+	}
+	return ""
+}
+
+// String 返回便于显示的模型描述
+func (c LLMConfig) String() string {
+	if c.BaseURL != "" {
+		return fmt.Sprintf("%s %s @ %s", c.Type, c.Model, c.BaseURL)
+	}
+	return fmt.Sprintf("%s %s", c.Type, c.Model)
+}
+
+// errMissingAPIKey 需要 API 密钥但未提供
+var errMissingAPIKey = errors.New("缺少 API 密钥")
+
+// newLLM 按配置创建模型，采样温度、最大 token 数和超时作用于每次调用
+func newLLM(name string, cfg LLMConfig) (llms.Model, error) {
+	key := cfg.apiKey()
+	var model llms.Model
+	var err error
+
+	switch cfg.Type {
+	case backendOpenAI:
+		if key == "" {
+			// 本地部署的兼容接口（vLLM、LM Studio 等）通常不校验密钥，但客户端要求非空
+			if cfg.BaseURL == "" || cfg.APIKeyEnv != "" {
+				return nil, missingKeyError(name, cfg)
+			}
+			key = "not-needed"
+		}
+		opts := []openai.Option{openai.WithModel(cfg.Model), openai.WithToken(key)}
+		if cfg.BaseURL != "" {
+			opts = append(opts, openai.WithBaseURL(cfg.BaseURL))
+		}
+		model, err = openai.New(opts...)
+	case backendOllama:
+		opts := []ollama.Option{ollama.WithModel(cfg.Model)}
+		if cfg.BaseURL != "" {
+			opts = append(opts, ollama.WithServerURL(cfg.BaseURL))
+		}
+		model, err = ollama.New(opts...)
+	case backendAnthropic:
+		if key == "" {
+			return nil, missingKeyError(name, cfg)
+		}
+		opts := []anthropic.Option{anthropic.WithModel(cfg.Model), anthropic.WithToken(key)}
+		if cfg.BaseURL != "" {
+			opts = append(opts, anthropic.WithBaseURL(cfg.BaseURL))
+		}
+		model, err = anthropic.New(opts...)
+	case backendOffline:
+		model = NewScriptedLLM()
+	default:
+		return nil, cfg.validate(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("初始化模型 %s 失败: %w", name, err)
+	}
+	return newConfiguredModel(model, cfg), nil
+}
+
+// missingKeyError 提示如何提供 API 密钥
+func missingKeyError(name string, cfg LLMConfig) error {
+	if cfg.APIKeyEnv != "" {
+		return fmt.Errorf("%w: 模型提供方 %s 需要设置环境变量 %s（或 %s=%s 并设置 %s）", errMissingAPIKey, name, cfg.APIKeyEnv, llmProviderEnv, name, llmAPIKeyEnv)
+	}
+	return fmt.Errorf("%w: 模型提供方 %s 需要在配置文件中设置 api_key_env，或设置 %s=%s 和 %s", errMissingAPIKey, name, llmProviderEnv, name, llmAPIKeyEnv)
+}
+
+// configuredModel 为每次调用附加配置中的默认参数和超时
+// 智能体内部的调用不会透传 chains.Run 的选项，因此在模型层统一设置
+type configuredModel struct {
+	llms.Model
+	options []llms.CallOption
+	timeout time.Duration
+}
+
+// newConfiguredModel 包装模型，使配置中的采样温度、最大 token 数和超时生效
+func newConfiguredModel(model llms.Model, cfg LLMConfig) *configuredModel {
+	m := &configuredModel{Model: model, timeout: time.Duration(cfg.Timeout)}
+	if cfg.Temperature != nil {
+		m.options = append(m.options, llms.WithTemperature(*cfg.Temperature))
+	}
+	if cfg.MaxTokens > 0 {
+		m.options = append(m.options, llms.WithMaxTokens(cfg.MaxTokens))
+	}
+	return m
+}
+
+// GenerateContent 附加默认参数后调用模型，调用方传入的参数优先
+func (m *configuredModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if m.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+	}
+	return m.Model.GenerateContent(ctx, messages, append(slices.Clone(m.options), options...)...)
+}
+
+// Call 以单条提示调用模型
+func (m *configuredModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// setupLLM 解析模型参数并创建模型，供各运行模式共用
+func setupLLM(name string, args []string) (llms.Model, LLMConfig, error) {
+	f, err := parseLLMFlags(name, args)
+	if err != nil {
+		return nil, LLMConfig{}, err
+	}
+	return setupLLMFromFlags(f)
+}
+
+// setupLLMFromFlags 按已解析的模型参数创建模型
+func setupLLMFromFlags(f *llmFlags) (llms.Model, LLMConfig, error) {
+	provider, cfg, err := resolveLLMConfig(f)
+	if err != nil {
+		return nil, cfg, err
+	}
+	llm, err := newLLM(provider, cfg)
+	return llm, cfg, err
+}
+
+// providerNames 返回内置和配置文件中的提供方名称
+func providerNames(settings LLMSettings) []string {
+	var names []string
+	for name := range builtinProviders {
+		names = append(names, name)
+	}
+	for name := range settings.Providers {
+		if _, ok := builtinProviders[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -2,14 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/tmc/langchaingo/agents"
 	"github.com/tmc/langchaingo/chains"
-	"github.com/tmc/langchaingo/llms/openai"
-	"github.com/tmc/langchaingo/memory"
 	"github.com/tmc/langchaingo/tools"
 )
 
@@ -19,7 +19,7 @@ func main() {
 		switch os.Args[1] {
 		case "demo":
 			// 运行演示模式
-			runDemo()
+			runDemo(os.Args[2:])
 			return
 		case "test":
 			// 运行测试模式
@@ -27,151 +27,234 @@ func main() {
 			return
 		case "example":
 			// 运行示例模式
-			if err := runExample(); err != nil {
+			if err := runExample(os.Args[2:]); err != nil {
 				fmt.Fprintf(os.Stderr, "示例运行错误: %v\n", err)
 				os.Exit(1)
 			}
 			return
+		case "rules":
+			// 检查风险评估规则
+			if err := runRulesCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "规则检查错误: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "knowledge":
+			// 检查医学知识库
+			if err := runKnowledgeCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "知识库检查错误: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "guidelines":
+			// 建立指南索引或检索指南
+			if err := runGuidelinesCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "指南检索错误: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "serve":
+			// 运行 HTTP 接口服务
+			if err := runServeCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "服务错误: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "replay":
+			// 回放录制的会话
+			if err := runReplayCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "回放错误: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "mcp":
+			// 运行 MCP 工具服务
+			if err := runMCPCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "MCP 服务错误: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "patient":
+			// 管理患者库
+			if err := runPatientCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "患者库错误: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "help", "-h", "--help":
 			printUsage()
 			return
 		}
 	}
 
-	// 默认运行交互模式
-	if err := run(); err != nil {
+	// 默认运行交互模式，其余参数为模型参数
+	if err := run(os.Args[1:]); err != nil {
 		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 		os.Exit(1)
 	}
 }
 
 func printUsage() {
-	fmt.Println("🩺 痛风化验单分析智能体 (Powered by 阿里百炼 Qwen-plus)")
+	fmt.Println("🩺 痛风化验单分析智能体")
 	fmt.Println("使用方法:")
-	fmt.Println("  go run *.go          - 交互式对话模式 (默认)")
+	fmt.Println("  go run *.go [模型参数]          - 交互式对话模式 (默认)")
 	fmt.Println("  go run *.go demo     - 运行演示模式")
 	fmt.Println("  go run *.go test     - 运行测试模式")
 	fmt.Println("  go run *.go example  - 运行简单示例")
+	fmt.Println("  go run *.go rules check [-fixtures 样例文件] [规则文件]")
+	fmt.Println("                       - 校验风险评估规则并运行样例")
+	fmt.Println("  go run *.go knowledge check [目录]")
+	fmt.Println("                       - 校验医学知识库数据文件，列出条目版本和审核日期")
+	fmt.Println("  go run *.go guidelines index [目录] | guidelines search <问题>")
+	fmt.Println("                       - 建立本地临床指南索引 / 检索指南段落")
+	fmt.Println("  go run *.go patient  - 管理患者库 (list/show/add/update/delete/flare/labs/use)")
+	fmt.Println("  go run *.go serve [-addr :8080] [模型参数]")
+	fmt.Println("                       - 运行 HTTP 接口服务，接口文档见 /openapi.json")
+	fmt.Println("                         -max-body 字节 -request-timeout 2m -session-ttl 30m -max-sessions 100")
+	fmt.Println("  go run *.go mcp      - 以 MCP stdio 方式提供 gout_lab_analyzer、medical_knowledge_base 和 calculator 工具")
+	fmt.Println("  go run *.go replay <录音文件>")
+	fmt.Println("                       - 回放 -record 录制的会话，提示词或工具结果变化时报错")
 	fmt.Println("  go run *.go help     - 显示此帮助信息")
 	fmt.Println("")
+	fmt.Println("模型参数 (交互、demo、example、serve 模式，优先级: 命令行 > 环境变量 > 配置文件 > 内置配置):")
+	fmt.Println("  -provider 名称       - 模型提供方: dashscope (默认)/openai/ollama/anthropic/offline 或配置文件中的名称")
+	fmt.Println("  -config 文件         - 模型配置文件 (JSON)，示例见 llm.example.json")
+	fmt.Println("  -model 模型 -base-url 地址 -temperature 温度 -max-tokens 数量 -timeout 90s")
+	fmt.Println("  -offline             - 离线模式: 使用确定性脚本模型，无需 API 密钥和网络")
+	fmt.Println("  -record 文件         - 录制交互会话 (仅交互模式)，供 replay 回放")
+	fmt.Println("")
 	fmt.Println("环境变量:")
-	fmt.Println("  DASHSCOPE_API_KEY    - 阿里百炼 API 密钥 (必需)")
+	fmt.Println("  DASHSCOPE_API_KEY    - 阿里百炼 API 密钥 (使用默认的 dashscope 时必需)")
+	fmt.Println("  GOUT_LLM_CONFIG / GOUT_LLM_PROVIDER / GOUT_LLM_MODEL / GOUT_LLM_BASE_URL")
+	fmt.Println("  GOUT_LLM_API_KEY / GOUT_LLM_TEMPERATURE / GOUT_LLM_MAX_TOKENS / GOUT_LLM_TIMEOUT")
+	fmt.Println("                       - 覆盖配置文件中的对应字段；GOUT_LLM_API_KEY 只用于 GOUT_LLM_PROVIDER 或配置文件选定的提供方")
+	fmt.Println("  GOUT_RULES_FILE      - 风险评估规则文件 (可选，修改后自动重新加载)")
+	fmt.Println("  GOUT_KNOWLEDGE_DIR   - 医学知识库数据目录 (可选，JSON/YAML 文件，替换内置知识)")
+	fmt.Println("  GOUT_PATIENT_DB      - 患者库文件 (可选，默认 gout_patients.db)")
+	fmt.Println("  GOUT_GUIDELINE_DIR   - 临床指南文档目录 (可选，Markdown/文本，设置后启用指南检索工具)")
+	fmt.Println("  GOUT_GUIDELINE_INDEX - 指南索引文件 (可选，默认为文档目录下的 .guideline_index.json)")
 }
 
-func run() error {
-	// 检查环境变量
-	if os.Getenv("DASHSCOPE_API_KEY") == "" {
-		fmt.Println("⚠️  请设置 DASHSCOPE_API_KEY 环境变量")
-		fmt.Println("   export DASHSCOPE_API_KEY=\"your-dashscope-api-key\"")
-		fmt.Println("   获取 API Key: https://dashscope.aliyun.com/")
+func run(args []string) error {
+	fmt.Println("🩺 痛风化验单分析智能体启动中...")
+	fmt.Println("═══════════════════════════════════════")
+
+	// 解析命令行参数并按配置初始化模型
+	flags := flag.NewFlagSet("gout-analysis-agent", flag.ContinueOnError)
+	llmArgs := registerLLMFlags(flags)
+	recordPath := flags.String("record", "", "将本次会话的提示词、模型输出和工具调用录制到文件，可用 replay 回放")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("无法识别的参数: %s", strings.Join(flags.Args(), " "))
+	}
+	llmArgs.markSet(flags)
+	llm, cfg, err := setupLLMFromFlags(llmArgs)
+	if errors.Is(err, errMissingAPIKey) {
+		fmt.Printf("⚠️  %v\n", err)
+		fmt.Println("   阿里百炼: export DASHSCOPE_API_KEY=\"your-dashscope-api-key\" (获取: https://dashscope.aliyun.com/)")
+		fmt.Println("   本地模型: go run . -provider ollama -model qwen2.5:7b")
+		fmt.Println("   离线模式: go run . -offline (确定性脚本模型，无需网络)")
 		return fmt.Errorf("缺少必需的环境变量")
 	}
-	
-	fmt.Println("🩺 痛风化验单分析智能体启动中... (Powered by 阿里百炼 Qwen-plus)")
-	fmt.Println("═══════════════════════════════════════")
-	
-	// 初始化阿里百炼 Qwen LLM (通过OpenAI兼容接口)
-	llm, err := openai.New(
-		openai.WithBaseURL("https://dashscope.aliyuncs.com/compatible-mode/v1"),
-		openai.WithModel("qwen-plus"),
-		openai.WithToken(os.Getenv("DASHSCOPE_API_KEY")),
-	)
 	if err != nil {
-		return fmt.Errorf("初始化阿里百炼 Qwen LLM失败: %w", err)
+		return err
 	}
+	fmt.Printf("🤖 模型: %s\n", cfg)
 
-	// 创建专用工具
-	goutAnalyzer := GoutLabAnalyzer{}
-	medicalKnowledge := NewMedicalKnowledgeBase()
+	// 加载风险评估规则，指定规则文件时监听文件变更
+	rules, err := loadRuleEngine()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rules.Watch(ctx, rulesReloadInterval, func(rs *RuleSet, err error) {
+		if err != nil {
+			fmt.Printf("\n⚠️  规则文件重新加载失败，继续使用原有规则: %v\n", err)
+			return
+		}
+		fmt.Printf("\n🔄 已重新加载风险评估规则 (版本 %s)\n", rs.Version)
+	})
 
-	// 工具列表
-	agentTools := []tools.Tool{
-		goutAnalyzer,
-		medicalKnowledge,
-		tools.Calculator{}, // 添加计算器工具用于数值计算
+	// 加载医学知识库，指定数据目录时替换内置知识
+	knowledge, err := loadKnowledgeBase()
+	if err != nil {
+		return err
 	}
+	fmt.Printf("📚 医学知识库: %d 个条目 (版本 %s)\n", len(knowledge.Entries()), knowledge.Version())
 
-	// 创建对话记忆
-	conversationMemory := memory.NewConversationBuffer()
+	// 打开患者库，已设置当前患者时默认使用其档案
+	patients, err := OpenPatientStore(os.Getenv(patientDBEnv))
+	if err != nil {
+		return err
+	}
+	defer patients.Close()
 
-	// 创建对话型智能体
-	agent := agents.NewConversationalAgent(
-		llm,
-		agentTools,
-		agents.WithMaxIterations(5),
-	)
+	// 加载临床指南索引，文档变化时重新建立
+	guidelines, err := loadGuidelines(os.Stdout)
+	if err != nil {
+		return err
+	}
 
-	// 创建执行器
-	executor := agents.NewExecutor(
-		agent,
-		agents.WithMemory(conversationMemory),
-	)
+	// 创建对话会话，已设置当前患者时以其档案作为默认患者信息
+	session, err := newSession(llm, rules, knowledge, patients, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if guidelines != nil {
+		session.setGuidelines(guidelines)
+	}
+	if session.patient != nil {
+		fmt.Printf("👤 当前患者: %s %s\n", session.patient.ID, session.patient.Name)
+	}
+	if *recordPath != "" {
+		recorder := newCassetteRecording(*recordPath, cfg.String())
+		if session.patient != nil {
+			recorder.cassette.Patient = session.patient.ID
+		}
+		session.setRecorder(recorder)
+		fmt.Printf("⏺  正在录制会话到 %s\n", *recordPath)
+	}
 
 	fmt.Println("✅ 智能体初始化完成！")
 	fmt.Println("\n🔬 我是您的痛风化验单分析助手，可以帮您：")
 	fmt.Println("   • 分析化验单数据，评估痛风风险")
+	fmt.Println("   • 按 ACR/EULAR 2015 标准进行痛风分类评分")
+	fmt.Println("   • 查询患者库中的档案和历次化验记录")
 	fmt.Println("   • 提供痛风相关医学知识")
 	fmt.Println("   • 给出个性化的健康建议")
 	fmt.Println("   • 解答痛风相关疑问")
 	fmt.Println("\n💡 使用示例：")
-	fmt.Println("   1. 输入化验单数据进行分析")
+	fmt.Println("   1. 直接粘贴多行化验单数据进行分析（空行结束输入）")
 	fmt.Println("   2. 询问痛风相关医学知识")
 	fmt.Println("   3. 咨询治疗和预防建议")
-	fmt.Println("\n输入 'exit' 退出程序")
+	fmt.Println("\n输入 /help 查看命令，输入 'exit' 退出程序")
 	fmt.Println("═══════════════════════════════════════")
 
 	// 交互式对话循环
-	for {
-		fmt.Print("\n👨‍⚕️ 您的问题: ")
-		
-		var input string
-		fmt.Scanln(&input)
-		
-		if strings.ToLower(strings.TrimSpace(input)) == "exit" {
-			fmt.Println("\n👋 感谢使用痛风分析智能体，祝您身体健康！")
-			break
-		}
-
-		if strings.TrimSpace(input) == "" {
-			fmt.Println("请输入您的问题或化验单数据。")
-			continue
-		}
-
-		// 执行智能体处理
-		fmt.Println("\n🔍 分析中...")
-		result, err := chains.Run(context.Background(), executor, input)
-		if err != nil {
-			fmt.Printf("❌ 处理过程中出现错误: %v\n", err)
-			continue
-		}
-
-		fmt.Println("\n📋 分析结果:")
-		fmt.Println("───────────────────────────────────────")
-		fmt.Println(result)
-		fmt.Println("───────────────────────────────────────")
-		
-		// 提示继续对话
-		fmt.Println("\n💬 如有其他问题，请继续输入，或输入 'exit' 退出")
-	}
-
-	return nil
+	return session.loop(ctx)
 }
 
 // 示例用法函数
-func runExample() error {
-	// 初始化阿里百炼 Qwen LLM
-	llm, err := openai.New(
-		openai.WithBaseURL("https://dashscope.aliyuncs.com/compatible-mode/v1"),
-		openai.WithModel("qwen-plus"),
-		openai.WithToken(os.Getenv("DASHSCOPE_API_KEY")),
-	)
+func runExample(args []string) error {
+	// 按配置初始化模型
+	llm, _, err := setupLLM("example", args)
 	if err != nil {
 		return err
 	}
 
 	// 创建工具
-	goutAnalyzer := GoutLabAnalyzer{}
-	medicalKnowledge := NewMedicalKnowledgeBase()
+	medicalKnowledge, err := loadKnowledgeBase()
+	if err != nil {
+		return err
+	}
+	rules, err := loadRuleEngine()
+	if err != nil {
+		return err
+	}
+	goutAnalyzer := GoutLabAnalyzer{Rules: rules, Knowledge: medicalKnowledge}
 	
 	agentTools := []tools.Tool{
 		goutAnalyzer,
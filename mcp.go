@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/tmc/langchaingo/tools"
+)
+
+// mcpToolsJSON MCP 工具定义，含输入和输出的 JSON Schema
+//
+//go:embed api/mcp_tools.json
+var mcpToolsJSON []byte
+
+// mcpProtocolVersions 支持的 MCP 协议版本，第一个为最新版本
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// mcpServerName MCP 服务名称
+const mcpServerName = "gout-analysis-agent"
+
+// JSON-RPC 错误码
+const (
+	jsonrpcParseError     = -32700
+	jsonrpcInvalidRequest = -32600
+	jsonrpcMethodNotFound = -32601
+	jsonrpcInvalidParams  = -32602
+	jsonrpcInternalError  = -32603
+)
+
+// calculatorErrorPrefix 计算器对无效表达式返回的结果前缀
+const calculatorErrorPrefix = "error from evaluator"
+
+// jsonrpcMessage JSON-RPC 2.0 请求或通知，通知没有 id
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// jsonrpcResponse JSON-RPC 2.0 响应
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+}
+
+// jsonrpcError JSON-RPC 2.0 错误
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool MCP 工具定义
+type mcpTool struct {
+	Name         string          `json:"name"`
+	Title        string          `json:"title,omitempty"`
+	Description  string          `json:"description"`
+	InputSchema  json.RawMessage `json:"inputSchema"`
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+	Annotations  json.RawMessage `json:"annotations,omitempty"`
+}
+
+// mcpContent 工具结果中的内容块
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpToolResult tools/call 的结果，structuredContent 符合工具的 outputSchema
+type mcpToolResult struct {
+	Content           []mcpContent `json:"content"`
+	StructuredContent any          `json:"structuredContent,omitempty"`
+	IsError           bool         `json:"isError,omitempty"`
+}
+
+// CalculatorResult calculator 工具的结构化结果
+type CalculatorResult struct {
+	Expression string `json:"expression"`
+	Result     string `json:"result"`
+}
+
+// mcpServer 通过 MCP 提供化验单分析、医学知识查询和计算器工具
+type mcpServer struct {
+	rules     *RuleEngine
+	patients  *PatientStore
+	knowledge *MedicalKnowledgeBase
+	tools     []mcpTool
+}
+
+// runMCPCommand 以 stdio 方式运行 MCP 服务
+// 标准输出只用于协议消息，其他输出改写到标准错误
+func runMCPCommand(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("无法识别的参数: %s", strings.Join(args, " "))
+	}
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+
+	rules, err := loadRuleEngine()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go rules.Watch(ctx, rulesReloadInterval, func(rs *RuleSet, err error) {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  规则文件重新加载失败，继续使用原有规则: %v\n", err)
+		}
+	})
+
+	knowledge, err := loadKnowledgeBase()
+	if err != nil {
+		return err
+	}
+
+	patients, err := OpenPatientStore(os.Getenv(patientDBEnv))
+	if err != nil {
+		return err
+	}
+	defer patients.Close()
+
+	server, err := newMCPServer(rules, knowledge, patients)
+	if err != nil {
+		return err
+	}
+	return server.serve(ctx, os.Stdin, stdout)
+}
+
+// newMCPServer 创建 MCP 服务，rules 和 patients 可以为 nil，knowledge 为 nil 时使用内置知识
+func newMCPServer(rules *RuleEngine, knowledge *MedicalKnowledgeBase, patients *PatientStore) (*mcpServer, error) {
+	if knowledge == nil {
+		knowledge = NewMedicalKnowledgeBase()
+	}
+	var defs []mcpTool
+	if err := json.Unmarshal(mcpToolsJSON, &defs); err != nil {
+		return nil, fmt.Errorf("解析 MCP 工具定义失败: %w", err)
+	}
+	return &mcpServer{
+		rules:     rules,
+		patients:  patients,
+		knowledge: knowledge,
+		tools:     defs,
+	}, nil
+}
+
+// serve 逐行读取 JSON-RPC 消息并依次处理，直到输入结束
+func (m *mcpServer) serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if resp := m.handleMessage(ctx, line); resp != nil {
+				if err := encoder.Encode(resp); err != nil {
+					return err
+				}
+			}
+		}
+		if errors.Is(readErr, io.EOF) || ctx.Err() != nil {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// handleMessage 处理一条消息，通知不需要响应时返回 nil
+func (m *mcpServer) handleMessage(ctx context.Context, data []byte) *jsonrpcResponse {
+	var msg jsonrpcMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &jsonrpcError{Code: jsonrpcParseError, Message: fmt.Sprintf("无法解析消息: %v", err)}}
+	}
+	if msg.ID == nil {
+		// 通知（initialized、cancelled 等）无需响应
+		return nil
+	}
+	resp := &jsonrpcResponse{JSONRPC: "2.0", ID: msg.ID}
+	if msg.JSONRPC != "2.0" || msg.Method == "" {
+		resp.Error = &jsonrpcError{Code: jsonrpcInvalidRequest, Message: "不是有效的 JSON-RPC 2.0 请求"}
+		return resp
+	}
+	resp.Result, resp.Error = m.handle(ctx, msg.Method, msg.Params)
+	return resp
+}
+
+// handle 按方法名处理请求
+func (m *mcpServer) handle(ctx context.Context, method string, params json.RawMessage) (any, *jsonrpcError) {
+	switch method {
+	case "initialize":
+		var req struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("参数格式错误: %v", err)}
+		}
+		// 客户端请求的版本不受支持时返回最新版本，由客户端决定是否继续
+		version := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, req.ProtocolVersion) {
+			version = req.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{"listChanged": false}},
+			"serverInfo":      map[string]any{"name": mcpServerName, "title": "痛风化验单分析智能体", "version": "1.0.0"},
+			"instructions":    "gout_lab_analyzer 按规则分析化验单并评估痛风风险，medical_knowledge_base 查询痛风相关医学知识，calculator 计算数学表达式。分析结果仅供参考，不能替代医生诊断。",
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return map[string]any{"tools": m.tools}, nil
+	case "tools/call":
+		var req struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("参数格式错误: %v", err)}
+		}
+		return m.callTool(ctx, req.Name, req.Arguments)
+	default:
+		return nil, &jsonrpcError{Code: jsonrpcMethodNotFound, Message: fmt.Sprintf("不支持的方法: %s", method)}
+	}
+}
+
+// callTool 调用工具，未知工具和参数错误返回协议错误，工具执行失败在结果中标记 isError
+func (m *mcpServer) callTool(ctx context.Context, name string, arguments json.RawMessage) (any, *jsonrpcError) {
+	if !slices.ContainsFunc(m.tools, func(t mcpTool) bool { return t.Name == name }) {
+		return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("未知工具: %s", name)}
+	}
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+
+	switch name {
+	case "gout_lab_analyzer":
+		var args AnalyzeRequest
+		if err := decodeArguments(arguments, &args); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(args.Report) == "" {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: "report 不能为空"}
+		}
+		return m.analyze(args), nil
+	case "medical_knowledge_base":
+		var args struct {
+			Query    string   `json:"query"`
+			Sections []string `json:"sections"`
+			TopK     int      `json:"top_k"`
+		}
+		if err := decodeArguments(arguments, &args); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(args.Query) == "" {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: "query 不能为空"}
+		}
+		if args.TopK == 0 {
+			args.TopK = defaultKnowledgeTopK
+		}
+		if args.TopK < 1 || args.TopK > maxKnowledgeTopK {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("top_k 应为 1-%d 的整数", maxKnowledgeTopK)}
+		}
+		query, err := newKnowledgeQuery(args.Query, args.Sections)
+		if err != nil {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: err.Error()}
+		}
+		results := m.knowledge.Query(query, args.TopK)
+		if results == nil {
+			results = []KnowledgeMatch{}
+		}
+		return structuredResult(KnowledgeResult{Query: query.Topic, Sections: query.Sections, KnowledgeVersion: m.knowledge.Version(), Results: results}), nil
+	case "calculator":
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		if err := decodeArguments(arguments, &args); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(args.Expression) == "" {
+			return nil, &jsonrpcError{Code: jsonrpcInvalidParams, Message: "expression 不能为空"}
+		}
+		result, err := tools.Calculator{}.Call(ctx, args.Expression)
+		if err == nil && strings.HasPrefix(result, calculatorErrorPrefix) {
+			err = errors.New(result)
+		}
+		if err != nil {
+			return errorResult(fmt.Sprintf("计算表达式时出错: %v", err)), nil
+		}
+		return structuredResult(CalculatorResult{Expression: args.Expression, Result: result}), nil
+	default:
+		return nil, &jsonrpcError{Code: jsonrpcInternalError, Message: fmt.Sprintf("工具 %s 没有实现", name)}
+	}
+}
+
+// analyze 分析化验单，指定患者时结合患者档案并保存化验记录
+func (m *mcpServer) analyze(args AnalyzeRequest) *mcpToolResult {
+	analyzer := GoutLabAnalyzer{Rules: m.rules, Knowledge: m.knowledge, Site: args.Site, RequireUricAcid: args.RequireUricAcid}
+	if args.PatientID != "" {
+		if m.patients == nil {
+			return errorResult("未配置患者库")
+		}
+		profile, err := m.patients.GetPatient(args.PatientID)
+		if err != nil {
+			return errorResult(err.Error())
+		}
+		analyzer.Patient = profile.Context()
+		analyzer.History = m.patients
+		analyzer.PatientID = profile.ID
+	}
+	result, err := analyzer.Analyze(args.Report)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	return structuredResult(result)
+}
+
+// decodeArguments 解析工具参数，不接受未定义的字段
+func decodeArguments(arguments json.RawMessage, v any) *jsonrpcError {
+	decoder := json.NewDecoder(bytes.NewReader(arguments))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &jsonrpcError{Code: jsonrpcInvalidParams, Message: fmt.Sprintf("工具参数格式错误: %v", err)}
+	}
+	return nil
+}
+
+// structuredResult 返回结构化结果，同时以 JSON 文本提供给不支持结构化内容的客户端
+func structuredResult(v any) *mcpToolResult {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errorResult(fmt.Sprintf("序列化结果时出错: %v", err))
+	}
+	return &mcpToolResult{
+		Content:           []mcpContent{{Type: "text", Text: string(data)}},
+		StructuredContent: v,
+	}
+}
+
+// errorResult 返回工具执行失败的结果，错误信息提供给模型以便修正输入
+func errorResult(message string) *mcpToolResult {
+	return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: message}}, IsError: true}
+}
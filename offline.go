@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// 离线模式的答复前缀，便于区分脚本答复与真实模型输出
+const offlinePrefix = "【离线模式】"
+
+// scriptedActionRe 已执行步骤中的工具名称
+var scriptedActionRe = regexp.MustCompile(`(?m)^Action: (.*)$`)
+
+// ScriptedLLM 离线模式使用的确定性模型，不访问网络
+// 按固定脚本生成对话型智能体的 ReAct 步骤: 输入含化验数据时调用 gout_lab_analyzer，
+// 其他问题调用 medical_knowledge_base，拿到工具结果后据此整理最终答复。
+// 相同的提示总是得到相同的输出，可在无网络环境和 CI 中完整运行执行器、工具调用、对话记忆和输出格式化。
+type ScriptedLLM struct{}
+
+// NewScriptedLLM 创建离线脚本模型
+func NewScriptedLLM() *ScriptedLLM {
+	return &ScriptedLLM{}
+}
+
+// GenerateContent 根据提示中的新输入和已有的工具结果生成下一步
+func (m *ScriptedLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	opts := llms.CallOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	output := scriptedStep(promptText(messages))
+
+	if opts.StreamingFunc != nil {
+		if err := opts.StreamingFunc(ctx, []byte(output)); err != nil {
+			return nil, err
+		}
+	}
+	return &llms.ContentResponse{
+		Choices: []*llms.ContentChoice{{Content: output, StopReason: "stop"}},
+	}, nil
+}
+
+// Call 以单条提示调用模型
+func (m *ScriptedLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// scriptedStep 按对话型智能体的提示格式生成一步输出
+// 提示以 "New input: 问题\n\nThought:" 结尾，其后为已执行步骤的记录
+func scriptedStep(prompt string) string {
+	input, scratchpad := prompt, ""
+	if i := strings.LastIndex(prompt, "New input: "); i >= 0 {
+		input = prompt[i+len("New input: "):]
+		if j := strings.Index(input, "\n\nThought:"); j >= 0 {
+			input, scratchpad = input[:j], input[j+len("\n\nThought:"):]
+		}
+	}
+	input = strings.TrimSpace(input)
+
+	// 已有工具结果时给出最终答复
+	if i := strings.LastIndex(scratchpad, "\nObservation: "); i >= 0 {
+		tool := ""
+		if m := scriptedActionRe.FindAllStringSubmatch(scratchpad[:i], -1); len(m) > 0 {
+			tool = strings.TrimSpace(m[len(m)-1][1])
+		}
+		observation := scratchpad[i+len("\nObservation: "):]
+		observation = strings.TrimSuffix(strings.TrimSpace(observation), "Thought:")
+		return " Do I need to use a tool? No\nAI: " + offlinePrefix + summarizeObservation(tool, strings.TrimSpace(observation))
+	}
+
+	available := scriptedToolNames(prompt)
+	if labLines := extractLabLines(input); len(labLines) > 0 && available["gout_lab_analyzer"] {
+		// Action Input 只能占一行，多项结果以分号分隔
+		return scriptedAction("gout_lab_analyzer", strings.Join(labLines, "；"))
+	}
+	if available["medical_knowledge_base"] {
+		return scriptedAction("medical_knowledge_base", strings.Join(strings.Fields(input), " "))
+	}
+	return " Do I need to use a tool? No\nAI: " + offlinePrefix + "当前为离线模式，只能分析化验单和查询内置医学知识库，请粘贴化验单或询问痛风相关问题。"
+}
+
+// scriptedAction 生成调用工具的步骤
+func scriptedAction(tool, input string) string {
+	return fmt.Sprintf(" Do I need to use a tool? Yes\nAction: %s\nAction Input: %s", tool, input)
+}
+
+// scriptedToolNames 从提示的格式说明中读取可用的工具
+func scriptedToolNames(prompt string) map[string]bool {
+	names := make(map[string]bool)
+	const marker = "should be one of ["
+	i := strings.Index(prompt, marker)
+	if i < 0 {
+		return names
+	}
+	list := prompt[i+len(marker):]
+	if j := strings.Index(list, "]"); j >= 0 {
+		list = list[:j]
+	}
+	for _, name := range strings.Split(list, ",") {
+		names[strings.TrimSpace(name)] = true
+	}
+	return names
+}
+
+// extractLabLines 提取输入中的化验数据、日期和患者信息行
+func extractLabLines(input string) []string {
+	var lines []string
+	hasValue := false
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if !looksLikeLabData(line) || sectionHeaderRe.MatchString(line) {
+			continue
+		}
+		lines = append(lines, line)
+		if m := labValueRe.FindStringSubmatch(line); m != nil && classifyAnalyte(m[1]) != "" {
+			hasValue = true
+		}
+	}
+	if !hasValue {
+		return nil
+	}
+	return lines
+}
+
+// summarizeObservation 将工具结果整理为中文答复
+func summarizeObservation(tool, observation string) string {
+	switch tool {
+	case "gout_lab_analyzer":
+		var result GoutAnalysisResult
+		if err := json.Unmarshal([]byte(observation), &result); err == nil {
+			return summarizeLabAnalysis(result)
+		}
+	case "medical_knowledge_base":
+		var knowledge KnowledgeResult
+		if err := json.Unmarshal([]byte(observation), &knowledge); err == nil && len(knowledge.Results) > 0 {
+			return summarizeKnowledge(knowledge.Results)
+		}
+	}
+	return observation
+}
+
+// summarizeLabAnalysis 整理化验单分析结果
+func summarizeLabAnalysis(result GoutAnalysisResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "化验单分析结果，痛风风险等级: %s。\n", result.RiskLevel)
+	if u := result.UricAcidLevel; u != nil {
+		fmt.Fprintf(&b, "- %s %.0f %s（%s）\n", u.Parameter, u.Value, u.Unit, u.Status)
+	}
+	for _, group := range [][]LabResult{result.InflammatoryMarkers, result.KidneyFunction} {
+		for _, r := range group {
+			fmt.Fprintf(&b, "- %s %g %s（%s）\n", r.Parameter, r.Value, r.Unit, r.Status)
+		}
+	}
+	if t := result.UrateTrend; t != nil {
+		fmt.Fprintf(&b, "血尿酸共 %d 次检测，治疗目标 <%.0f μmol/L，达标时间占比 %.0f%%。\n", len(t.Points), t.Target, t.TimeInTarget*100)
+	}
+	if len(result.Recommendations) > 0 {
+		b.WriteString("建议:\n")
+		for i, r := range result.Recommendations {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, r)
+		}
+	}
+	if result.FollowUpNeeded {
+		b.WriteString("请及时到风湿免疫科随访复查。\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// summarizeKnowledge 整理医学知识查询结果
+func summarizeKnowledge(infos []KnowledgeMatch) string {
+	var b strings.Builder
+	for _, info := range infos {
+		if info.Definition != "" {
+			fmt.Fprintf(&b, "%s: %s\n", info.Topic, info.Definition)
+		} else {
+			fmt.Fprintf(&b, "%s\n", info.Topic)
+		}
+		if len(info.Symptoms) > 0 {
+			fmt.Fprintf(&b, "主要症状: %s\n", strings.Join(info.Symptoms, "；"))
+		}
+		if len(info.Treatment) > 0 {
+			fmt.Fprintf(&b, "治疗方法: %s\n", strings.Join(info.Treatment, "；"))
+		}
+		if len(info.Prevention) > 0 {
+			fmt.Fprintf(&b, "预防措施: %s\n", strings.Join(info.Prevention, "；"))
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 性别取值
+const (
+	sexMale   = "男"
+	sexFemale = "女"
+)
+
+// pediatricAgeLimit 未满该年龄按儿童参考值评估
+const pediatricAgeLimit = 18
+
+// PatientContext 患者基本信息，用于选择参考范围和诊断阈值
+type PatientContext struct {
+	Sex       string  `json:"sex,omitempty"`       // 性别: 男/女
+	Age       int     `json:"age,omitempty"`       // 年龄（岁）
+	Pregnant  *bool   `json:"pregnant,omitempty"`  // 是否妊娠，为空表示未提供
+	Pediatric bool    `json:"pediatric,omitempty"` // 是否儿童（未满18岁）
+	WeightKg  float64 `json:"weight_kg,omitempty"` // 体重（kg），用于 Cockcroft-Gault 公式
+	Tophi     *bool   `json:"tophi,omitempty"`     // 是否有痛风石，影响降尿酸治疗目标，为空表示未提供
+}
+
+// IsEmpty 判断是否未提供任何患者信息
+func (p PatientContext) IsEmpty() bool {
+	return p == PatientContext{}
+}
+
+// IsPregnant 判断是否妊娠，未提供时按否处理
+func (p PatientContext) IsPregnant() bool {
+	return p.Pregnant != nil && *p.Pregnant
+}
+
+// HasTophi 判断是否有痛风石，未提供时按否处理
+func (p PatientContext) HasTophi() bool {
+	return p.Tophi != nil && *p.Tophi
+}
+
+// merge 用 other 中已提供的字段覆盖当前信息，妊娠和痛风石明确为否时也会覆盖
+func (p PatientContext) merge(other PatientContext) PatientContext {
+	if other.Sex != "" {
+		p.Sex = other.Sex
+	}
+	if other.Age > 0 {
+		p.Age = other.Age
+		p.Pediatric = other.Age < pediatricAgeLimit
+	}
+	if other.Pregnant != nil {
+		p.Pregnant = other.Pregnant
+	}
+	if other.Pediatric {
+		p.Pediatric = true
+	}
+	if other.WeightKg > 0 {
+		p.WeightKg = other.WeightKg
+	}
+	if other.Tophi != nil {
+		p.Tophi = other.Tophi
+	}
+	return p
+}
+
+var (
+	// 患者信息行，如 "性别: 男"、"年龄: 45岁"、"体重: 70kg"、"患者: 女, 32岁, 妊娠"、"痛风石: 有"
+	patientLineRe = regexp.MustCompile(`(?i)^\s*(性别|年龄|体重|妊娠|怀孕|孕期|痛风石|患者|病人|sex|gender|age|weight|pregnant|pregnancy|tophi|tophus)\s*[：:\s]`)
+	weightRe      = regexp.MustCompile(`(?i)([0-9]{1,3}(?:\.[0-9]+)?)\s*(?:kg|公斤|千克)`)
+	ageRe         = regexp.MustCompile(`(?i)(?:年龄|age)\s*[：:]?\s*([0-9]{1,3})|([0-9]{1,3})\s*(?:岁|周岁|years?)`)
+	negationRe    = regexp.MustCompile(`(?i)(?:妊娠|怀孕|孕期|pregnant|pregnancy)\s*[：:]?\s*(?:否|无|未|no|false)`)
+	tophiNegRe    = regexp.MustCompile(`(?i)(?:痛风石|tophi|tophus)\s*[：:]?\s*(?:否|无|未|no|false)|(?:无|没有|未见|no)\s*(?:痛风石|tophi|tophus)`)
+)
+
+// inputItemSeparator 单行输入中的分项分隔符
+var inputItemSeparator = strings.NewReplacer("；", "\n", ";", "\n")
+
+// parsePatientContext 从输入中提取患者信息行，返回患者信息及剩余的化验数据
+// 患者信息行替换为空行，保证化验数据的行号与原始输入一致
+func parsePatientContext(input string) (PatientContext, string) {
+	var patient PatientContext
+	// 智能体的 Action Input 只有一行，此时多项内容以分号分隔
+	if !strings.Contains(input, "\n") {
+		input = inputItemSeparator.Replace(input)
+	}
+	lines := strings.Split(input, "\n")
+
+	for i, line := range lines {
+		if !patientLineRe.MatchString(line) {
+			continue
+		}
+		patient = patient.merge(parsePatientLine(line))
+		lines[i] = ""
+	}
+
+	return patient, strings.Join(lines, "\n")
+}
+
+// parsePatientLine 解析单行患者信息
+func parsePatientLine(line string) PatientContext {
+	var p PatientContext
+	lower := strings.ToLower(line)
+
+	switch {
+	case strings.Contains(lower, "女") || strings.Contains(lower, "female"):
+		p.Sex = sexFemale
+	case strings.Contains(lower, "男") || strings.Contains(lower, "male"):
+		p.Sex = sexMale
+	}
+
+	if m := ageRe.FindStringSubmatch(line); m != nil {
+		ageText := m[1]
+		if ageText == "" {
+			ageText = m[2]
+		}
+		if age, err := strconv.Atoi(ageText); err == nil && age > 0 {
+			p.Age = age
+			p.Pediatric = age < pediatricAgeLimit
+		}
+	}
+
+	if m := weightRe.FindStringSubmatch(line); m != nil {
+		if weight, err := strconv.ParseFloat(m[1], 64); err == nil && weight > 0 {
+			p.WeightKg = weight
+		}
+	}
+
+	if strings.Contains(lower, "妊娠") || strings.Contains(lower, "怀孕") ||
+		strings.Contains(lower, "孕期") || strings.Contains(lower, "pregnan") {
+		pregnant := !negationRe.MatchString(line)
+		p.Pregnant = &pregnant
+	}
+
+	if strings.Contains(lower, "痛风石") || strings.Contains(lower, "toph") {
+		tophi := !tophiNegRe.MatchString(line)
+		p.Tophi = &tophi
+	}
+
+	if strings.Contains(lower, "儿童") || strings.Contains(lower, "pediatric") {
+		p.Pediatric = true
+	}
+
+	return p
+}
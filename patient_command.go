@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// patientUsage patient 子命令用法
+const patientUsage = `用法:
+  patient list                          列出全部患者
+  patient show <编号>                    查看患者档案、发作史及化验记录摘要
+  patient add <编号> [选项]              新建患者档案
+  patient update <编号> [选项]           修改患者档案，仅更新指定的选项
+  patient delete <编号>                  删除患者档案及其化验记录
+  patient flare <编号> -date 日期 [-joints 关节] [-note 备注]
+                                        记录一次痛风发作
+  patient labs <编号> [-date 日期] <化验单文件|->
+                                        导入化验单，文件中可含多个日期行
+  patient use [编号]                     设置当前患者，省略编号时显示当前患者
+选项:
+  -name 姓名 -sex 男/女 -age 年龄 -weight 体重kg -pregnant -tophi
+  -comorbidities 高血压,糖尿病 -medications 别嘌醇300mg,秋水仙碱0.5mg
+患者库文件由环境变量 GOUT_PATIENT_DB 指定，默认为当前目录下的 gout_patients.db`
+
+// runPatientCommand 处理 patient 子命令
+func runPatientCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(patientUsage)
+	}
+
+	store, err := OpenPatientStore(os.Getenv(patientDBEnv))
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	command, args := args[0], args[1:]
+	if command == "list" {
+		return listPatients(store)
+	}
+	if command == "use" && len(args) == 0 {
+		current, err := store.CurrentPatient()
+		if err != nil {
+			return err
+		}
+		if current == "" {
+			fmt.Println("尚未设置当前患者")
+		} else {
+			fmt.Printf("当前患者: %s\n", current)
+		}
+		return nil
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New(patientUsage)
+	}
+	id, args := args[0], args[1:]
+
+	// 患者摘要和导入化验时的血尿酸治疗目标、默认参考范围取自知识库，导入化验与其他模式使用相同的规则
+	var knowledge *MedicalKnowledgeBase
+	var rules *RuleEngine
+	if command == "show" || command == "labs" {
+		if knowledge, err = loadKnowledgeBase(); err != nil {
+			return err
+		}
+	}
+	if command == "labs" {
+		if rules, err = loadRuleEngine(); err != nil {
+			return err
+		}
+	}
+
+	switch command {
+	case "show":
+		return showPatient(store, id, knowledge)
+	case "add":
+		profile := PatientProfile{ID: id}
+		if err := parseProfileFlags("patient add", args, &profile); err != nil {
+			return err
+		}
+		if err := store.CreatePatient(profile); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 已新建患者 %s\n", id)
+	case "update":
+		profile, err := store.GetPatient(id)
+		if err != nil {
+			return err
+		}
+		if err := parseProfileFlags("patient update", args, profile); err != nil {
+			return err
+		}
+		if err := store.UpdatePatient(*profile); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 已更新患者 %s\n", id)
+	case "delete":
+		if err := store.DeletePatient(id); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 已删除患者 %s\n", id)
+	case "flare":
+		return addFlare(store, id, args)
+	case "labs":
+		return importLabs(store, id, rules, knowledge, args)
+	case "use":
+		if err := store.SetCurrentPatient(id); err != nil {
+			return err
+		}
+		fmt.Printf("✅ 当前患者已设置为 %s\n", id)
+	default:
+		return errors.New(patientUsage)
+	}
+	return nil
+}
+
+// parseProfileFlags 解析患者档案选项，只修改命令行中出现的字段
+func parseProfileFlags(name string, args []string, p *PatientProfile) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	patientName := flags.String("name", p.Name, "姓名")
+	sex := flags.String("sex", p.Sex, "性别: 男/女")
+	age := flags.Int("age", p.Age, "年龄（岁）")
+	weight := flags.Float64("weight", p.WeightKg, "体重（kg）")
+	pregnant := flags.Bool("pregnant", p.Pregnant, "是否妊娠")
+	tophi := flags.Bool("tophi", p.Tophi, "是否有痛风石")
+	comorbidities := flags.String("comorbidities", strings.Join(p.Comorbidities, ","), "合并症，以逗号分隔")
+	medications := flags.String("medications", strings.Join(p.Medications, ","), "当前用药，以逗号分隔")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("无法识别的参数: %s", strings.Join(flags.Args(), " "))
+	}
+
+	if *sex != "" {
+		normalized := parsePatientLine("性别: " + *sex).Sex
+		if normalized == "" {
+			return fmt.Errorf("无法识别的性别: %s", *sex)
+		}
+		*sex = normalized
+	}
+	if *age < 0 || *weight < 0 {
+		return errors.New("年龄和体重不能为负数")
+	}
+
+	p.Name, p.Sex, p.Age, p.WeightKg = *patientName, *sex, *age, *weight
+	p.Pregnant, p.Tophi = *pregnant, *tophi
+	p.Comorbidities = splitList(*comorbidities)
+	p.Medications = splitList(*medications)
+	return nil
+}
+
+// splitList 拆分以逗号或顿号分隔的列表
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '，' || r == '、' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listPatients 打印患者列表
+func listPatients(store *PatientStore) error {
+	patients, err := store.ListPatients()
+	if err != nil {
+		return err
+	}
+	current, err := store.CurrentPatient()
+	if err != nil {
+		return err
+	}
+	if len(patients) == 0 {
+		fmt.Println("患者库为空，可使用 \"patient add <编号>\" 新建患者")
+		return nil
+	}
+	for _, p := range patients {
+		marker := "  "
+		if p.ID == current {
+			marker = "▶ "
+		}
+		fmt.Printf("%s%-12s %-8s %-2s %3d岁  合并症: %s\n", marker, p.ID, p.Name, p.Sex, p.Age, strings.Join(p.Comorbidities, "、"))
+	}
+	return nil
+}
+
+// showPatient 以 JSON 格式打印患者档案摘要
+func showPatient(store *PatientStore, id string, knowledge *MedicalKnowledgeBase) error {
+	summary, err := summarizePatient(store, id, knowledge)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// addFlare 记录一次痛风发作
+func addFlare(store *PatientStore, id string, args []string) error {
+	flags := flag.NewFlagSet("patient flare", flag.ContinueOnError)
+	dateText := flags.String("date", "", "发作日期，如 2024-03-15")
+	joints := flags.String("joints", "", "受累关节")
+	note := flags.String("note", "", "备注")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	date, ok := parseReportDate(*dateText)
+	if !ok {
+		return fmt.Errorf("无法识别的发作日期: %q", *dateText)
+	}
+	if err := store.AddFlare(id, Flare{Date: date, Joints: *joints, Note: *note}); err != nil {
+		return err
+	}
+	fmt.Printf("✅ 已记录患者 %s 于 %s 的发作\n", id, date.Format(reportDateLayout))
+	return nil
+}
+
+// importLabs 导入化验单文件，"-" 表示从标准输入读取
+// 文件中没有日期行时使用 -date 指定的日期，未指定则为当天
+func importLabs(store *PatientStore, id string, rules *RuleEngine, knowledge *MedicalKnowledgeBase, args []string) error {
+	flags := flag.NewFlagSet("patient labs", flag.ContinueOnError)
+	dateText := flags.String("date", "", "化验日期，文件中没有日期行时使用，默认为当天")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(patientUsage)
+	}
+
+	var data []byte
+	var err error
+	if path := flags.Arg(0); path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("读取化验单失败: %w", err)
+	}
+
+	profile, err := store.GetPatient(id)
+	if err != nil {
+		return err
+	}
+	input := string(data)
+	if !hasReportDate(input) {
+		date := time.Now()
+		if *dateText != "" {
+			var ok bool
+			if date, ok = parseReportDate(*dateText); !ok {
+				return fmt.Errorf("无法识别的化验日期: %q", *dateText)
+			}
+		}
+		input = "日期: " + date.Format(reportDateLayout) + "\n" + input
+	}
+
+	analyzer := GoutLabAnalyzer{Patient: profile.Context(), Rules: rules, Knowledge: knowledge, History: store, PatientID: id}
+	if err := analyzer.checkPatientID(splitLabHistory(input)); err != nil {
+		return err
+	}
+	output, err := UrateTrendTool{LabAnalyzer: analyzer}.Call(context.Background(), input)
+	if err != nil {
+		return err
+	}
+	reports, err := store.Reports(id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ 已导入化验单，患者 %s 共有 %d 次化验记录\n", id, len(reports))
+	fmt.Println(output)
+	return nil
+}
+
+// hasReportDate 判断输入中是否含有化验日期行
+func hasReportDate(input string) bool {
+	for _, line := range strings.Split(input, "\n") {
+		if _, ok := parseReportDate(line); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // 纯 Go 实现的 SQLite 驱动，无需 cgo
+)
+
+// 患者库文件
+const (
+	patientDBEnv     = "GOUT_PATIENT_DB"
+	defaultPatientDB = "gout_patients.db"
+)
+
+// currentPatientKey 当前患者编号在 settings 表中的键
+const currentPatientKey = "current_patient"
+
+var (
+	errPatientNotFound = errors.New("患者不存在")
+	errPatientExists   = errors.New("患者编号已存在")
+)
+
+// patientSchema 患者库表结构
+const patientSchema = `
+CREATE TABLE IF NOT EXISTS patients (
+	id            TEXT PRIMARY KEY,
+	name          TEXT NOT NULL DEFAULT '',
+	sex           TEXT NOT NULL DEFAULT '',
+	age           INTEGER NOT NULL DEFAULT 0,
+	weight_kg     REAL NOT NULL DEFAULT 0,
+	pregnant      INTEGER NOT NULL DEFAULT 0,
+	tophi         INTEGER NOT NULL DEFAULT 0,
+	comorbidities TEXT NOT NULL DEFAULT '[]',
+	medications   TEXT NOT NULL DEFAULT '[]',
+	created_at    TEXT NOT NULL,
+	updated_at    TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS flares (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	patient_id TEXT NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+	date       TEXT NOT NULL,
+	joints     TEXT NOT NULL DEFAULT '',
+	note       TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS lab_results (
+	patient_id  TEXT NOT NULL REFERENCES patients(id) ON DELETE CASCADE,
+	report_date TEXT NOT NULL,
+	seq         INTEGER NOT NULL,
+	analyte_id  TEXT NOT NULL DEFAULT '',
+	value       REAL NOT NULL,
+	unit        TEXT NOT NULL DEFAULT '',
+	status      TEXT NOT NULL DEFAULT '',
+	result      TEXT NOT NULL,
+	PRIMARY KEY (patient_id, report_date, seq)
+);
+CREATE TABLE IF NOT EXISTS settings (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// Flare 痛风发作记录
+type Flare struct {
+	Date   time.Time `json:"date"`             // 发作日期
+	Joints string    `json:"joints,omitempty"` // 受累关节
+	Note   string    `json:"note,omitempty"`   // 备注，如持续时间、用药
+}
+
+// PatientProfile 患者档案
+type PatientProfile struct {
+	ID            string    `json:"id"`                  // 患者编号
+	Name          string    `json:"name,omitempty"`      // 姓名
+	Sex           string    `json:"sex,omitempty"`       // 性别: 男/女
+	Age           int       `json:"age,omitempty"`       // 年龄（岁）
+	WeightKg      float64   `json:"weight_kg,omitempty"` // 体重（kg）
+	Pregnant      bool      `json:"pregnant,omitempty"`  // 是否妊娠
+	Tophi         bool      `json:"tophi,omitempty"`     // 是否有痛风石
+	Comorbidities []string  `json:"comorbidities"`       // 合并症，如高血压、糖尿病、慢性肾病
+	Medications   []string  `json:"medications"`         // 当前用药
+	Flares        []Flare   `json:"flares"`              // 发作史，按日期升序
+	CreatedAt     time.Time `json:"created_at"`          // 建档时间
+	UpdatedAt     time.Time `json:"updated_at"`          // 最后修改时间
+}
+
+// Context 返回用于化验单分析的患者信息，档案中为否的妊娠和痛风石按未提供处理
+func (p PatientProfile) Context() PatientContext {
+	ctx := PatientContext{
+		Sex:       p.Sex,
+		Age:       p.Age,
+		Pediatric: p.Age > 0 && p.Age < pediatricAgeLimit,
+		WeightKg:  p.WeightKg,
+	}
+	if p.Pregnant {
+		ctx.Pregnant = &p.Pregnant
+	}
+	if p.Tophi {
+		ctx.Tophi = &p.Tophi
+	}
+	return ctx
+}
+
+// PatientStore 基于嵌入式 SQLite 的患者库，同时实现 LabHistoryStore
+type PatientStore struct {
+	db *sql.DB
+}
+
+// OpenPatientStore 打开患者库文件，不存在时自动创建
+func OpenPatientStore(path string) (*PatientStore, error) {
+	if path == "" {
+		path = defaultPatientDB
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("打开患者库失败: %w", err)
+	}
+	return initPatientStore(db)
+}
+
+// OpenMemoryPatientStore 创建内存中的患者库，关闭后内容丢弃，用于回放等不能修改患者库文件的场景
+func OpenMemoryPatientStore() (*PatientStore, error) {
+	db, err := sql.Open("sqlite", "file::memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, fmt.Errorf("打开患者库失败: %w", err)
+	}
+	// 每个连接各有一个内存数据库，只保留一个连接
+	db.SetMaxOpenConns(1)
+	return initPatientStore(db)
+}
+
+// openPatientStoreReadOnly 以只读方式打开已有的患者库文件，文件不存在时返回 os.ErrNotExist
+func openPatientStoreReadOnly(path string) (*PatientStore, error) {
+	if path == "" {
+		path = defaultPatientDB
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("打开患者库失败: %w", err)
+	}
+	return &PatientStore{db: db}, nil
+}
+
+// initPatientStore 建立患者库表结构
+func initPatientStore(db *sql.DB) (*PatientStore, error) {
+	if _, err := db.Exec(patientSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化患者库失败: %w", err)
+	}
+	return &PatientStore{db: db}, nil
+}
+
+// Close 关闭患者库
+func (s *PatientStore) Close() error {
+	return s.db.Close()
+}
+
+// CreatePatient 新建患者档案
+func (s *PatientStore) CreatePatient(p PatientProfile) error {
+	if strings.TrimSpace(p.ID) == "" {
+		return errors.New("患者编号不能为空")
+	}
+	comorbidities, medications, err := encodeLists(p)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`INSERT INTO patients (id, name, sex, age, weight_kg, pregnant, tophi, comorbidities, medications, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING`,
+		p.ID, p.Name, p.Sex, p.Age, p.WeightKg, p.Pregnant, p.Tophi, comorbidities, medications, now, now)
+	if err != nil {
+		return fmt.Errorf("保存患者档案失败: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", errPatientExists, p.ID)
+	}
+	return nil
+}
+
+// UpdatePatient 更新患者基本信息，不影响发作史和化验记录
+func (s *PatientStore) UpdatePatient(p PatientProfile) error {
+	comorbidities, medications, err := encodeLists(p)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`UPDATE patients SET name = ?, sex = ?, age = ?, weight_kg = ?, pregnant = ?, tophi = ?,
+		comorbidities = ?, medications = ?, updated_at = ? WHERE id = ?`,
+		p.Name, p.Sex, p.Age, p.WeightKg, p.Pregnant, p.Tophi, comorbidities, medications,
+		time.Now().UTC().Format(time.RFC3339), p.ID)
+	if err != nil {
+		return fmt.Errorf("更新患者档案失败: %w", err)
+	}
+	return expectAffected(res, p.ID)
+}
+
+// GetPatient 读取患者档案及发作史
+func (s *PatientStore) GetPatient(id string) (*PatientProfile, error) {
+	rows, err := s.db.Query(patientSelect+` WHERE id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("读取患者档案失败: %w", err)
+	}
+	patients, err := scanPatients(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(patients) == 0 {
+		return nil, fmt.Errorf("%w: %s", errPatientNotFound, id)
+	}
+
+	p := &patients[0]
+	if p.Flares, err = s.flares(id); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ListPatients 按编号列出全部患者（不含发作史）
+func (s *PatientStore) ListPatients() ([]PatientProfile, error) {
+	rows, err := s.db.Query(patientSelect + ` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("读取患者列表失败: %w", err)
+	}
+	return scanPatients(rows)
+}
+
+// DeletePatient 删除患者档案及其发作史、化验记录
+func (s *PatientStore) DeletePatient(id string) error {
+	res, err := s.db.Exec(`DELETE FROM patients WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("删除患者档案失败: %w", err)
+	}
+	if err := expectAffected(res, id); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`DELETE FROM settings WHERE key = ? AND value = ?`, currentPatientKey, id)
+	return err
+}
+
+// AddFlare 记录一次痛风发作
+func (s *PatientStore) AddFlare(id string, flare Flare) error {
+	if _, err := s.GetPatient(id); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO flares (patient_id, date, joints, note) VALUES (?, ?, ?, ?)`,
+		id, flare.Date.Format(reportDateLayout), flare.Joints, flare.Note)
+	if err != nil {
+		return fmt.Errorf("保存发作记录失败: %w", err)
+	}
+	return nil
+}
+
+// copyPatient 从 src 复制患者档案、发作史和化验记录，只复制 until 当天及之前的发作和化验，保留建档和修改时间
+func (s *PatientStore) copyPatient(src *PatientStore, id string, until time.Time) error {
+	p, err := src.GetPatient(id)
+	if err != nil {
+		return err
+	}
+	reports, err := src.Reports(id)
+	if err != nil {
+		return err
+	}
+	comorbidities, medications, err := encodeLists(*p)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`INSERT INTO patients (id, name, sex, age, weight_kg, pregnant, tophi, comorbidities, medications, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID, p.Name, p.Sex, p.Age, p.WeightKg, p.Pregnant, p.Tophi, comorbidities, medications,
+		p.CreatedAt.UTC().Format(time.RFC3339), p.UpdatedAt.UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("复制患者档案失败: %w", err)
+	}
+	cutoff := until.Format(reportDateLayout)
+	for _, flare := range p.Flares {
+		if flare.Date.Format(reportDateLayout) > cutoff {
+			continue
+		}
+		if err := s.AddFlare(id, flare); err != nil {
+			return err
+		}
+	}
+	for _, report := range reports {
+		if report.Date.Format(reportDateLayout) > cutoff {
+			continue
+		}
+		if err := s.SaveReport(id, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveReport 保存一次化验结果，同一日期的结果会被替换；患者不存在时自动建档
+func (s *PatientStore) SaveReport(patientID string, report DatedLabReport) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("保存化验结果失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	date := report.Date.Format(reportDateLayout)
+	if _, err := tx.Exec(`INSERT INTO patients (id, created_at, updated_at) VALUES (?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+		patientID, now, now); err != nil {
+		return fmt.Errorf("保存化验结果失败: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM lab_results WHERE patient_id = ? AND report_date = ?`, patientID, date); err != nil {
+		return fmt.Errorf("保存化验结果失败: %w", err)
+	}
+	for i, result := range report.Results {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("保存化验结果失败: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO lab_results (patient_id, report_date, seq, analyte_id, value, unit, status, result)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			patientID, date, i, result.AnalyteID, result.Value, result.Unit, result.Status, string(data)); err != nil {
+			return fmt.Errorf("保存化验结果失败: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Reports 按日期升序返回患者的历次化验结果
+func (s *PatientStore) Reports(patientID string) ([]DatedLabReport, error) {
+	rows, err := s.db.Query(`SELECT report_date, result FROM lab_results WHERE patient_id = ? ORDER BY report_date, seq`, patientID)
+	if err != nil {
+		return nil, fmt.Errorf("读取化验结果失败: %w", err)
+	}
+	defer rows.Close()
+
+	var reports []DatedLabReport
+	for rows.Next() {
+		var dateText, data string
+		if err := rows.Scan(&dateText, &data); err != nil {
+			return nil, fmt.Errorf("读取化验结果失败: %w", err)
+		}
+		date, err := time.Parse(reportDateLayout, dateText)
+		if err != nil {
+			return nil, fmt.Errorf("化验日期格式错误: %w", err)
+		}
+		var result LabResult
+		if err := json.Unmarshal([]byte(data), &result); err != nil {
+			return nil, fmt.Errorf("化验结果格式错误: %w", err)
+		}
+		if n := len(reports); n == 0 || !reports[n-1].Date.Equal(date) {
+			reports = append(reports, DatedLabReport{Date: date})
+		}
+		reports[len(reports)-1].Results = append(reports[len(reports)-1].Results, result)
+	}
+	return reports, rows.Err()
+}
+
+// SetCurrentPatient 设置当前患者，智能体默认使用该患者的档案
+func (s *PatientStore) SetCurrentPatient(id string) error {
+	if _, err := s.GetPatient(id); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value`,
+		currentPatientKey, id)
+	return err
+}
+
+// CurrentPatient 返回当前患者编号，未设置时返回空字符串
+func (s *PatientStore) CurrentPatient() (string, error) {
+	var id string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, currentPatientKey).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return id, err
+}
+
+// flares 读取患者的发作史
+func (s *PatientStore) flares(id string) ([]Flare, error) {
+	rows, err := s.db.Query(`SELECT date, joints, note FROM flares WHERE patient_id = ? ORDER BY date, id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("读取发作记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	flares := []Flare{}
+	for rows.Next() {
+		var flare Flare
+		var dateText string
+		if err := rows.Scan(&dateText, &flare.Joints, &flare.Note); err != nil {
+			return nil, fmt.Errorf("读取发作记录失败: %w", err)
+		}
+		if flare.Date, err = time.Parse(reportDateLayout, dateText); err != nil {
+			return nil, fmt.Errorf("发作日期格式错误: %w", err)
+		}
+		flares = append(flares, flare)
+	}
+	return flares, rows.Err()
+}
+
+const patientSelect = `SELECT id, name, sex, age, weight_kg, pregnant, tophi, comorbidities, medications, created_at, updated_at FROM patients`
+
+// scanPatients 读取患者档案查询结果
+func scanPatients(rows *sql.Rows) ([]PatientProfile, error) {
+	defer rows.Close()
+
+	var patients []PatientProfile
+	for rows.Next() {
+		var p PatientProfile
+		var comorbidities, medications, created, updated string
+		if err := rows.Scan(&p.ID, &p.Name, &p.Sex, &p.Age, &p.WeightKg, &p.Pregnant, &p.Tophi,
+			&comorbidities, &medications, &created, &updated); err != nil {
+			return nil, fmt.Errorf("读取患者档案失败: %w", err)
+		}
+		if err := json.Unmarshal([]byte(comorbidities), &p.Comorbidities); err != nil {
+			return nil, fmt.Errorf("合并症格式错误: %w", err)
+		}
+		if err := json.Unmarshal([]byte(medications), &p.Medications); err != nil {
+			return nil, fmt.Errorf("用药记录格式错误: %w", err)
+		}
+		p.CreatedAt, _ = time.Parse(time.RFC3339, created)
+		p.UpdatedAt, _ = time.Parse(time.RFC3339, updated)
+		patients = append(patients, p)
+	}
+	return patients, rows.Err()
+}
+
+// encodeLists 将合并症和用药序列化为 JSON 数组
+func encodeLists(p PatientProfile) (string, string, error) {
+	if p.Comorbidities == nil {
+		p.Comorbidities = []string{}
+	}
+	if p.Medications == nil {
+		p.Medications = []string{}
+	}
+	comorbidities, err := json.Marshal(p.Comorbidities)
+	if err != nil {
+		return "", "", err
+	}
+	medications, err := json.Marshal(p.Medications)
+	if err != nil {
+		return "", "", err
+	}
+	return string(comorbidities), string(medications), nil
+}
+
+// expectAffected 检查更新或删除是否命中患者记录
+func expectAffected(res sql.Result, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", errPatientNotFound, id)
+	}
+	return nil
+}
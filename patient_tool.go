@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/callbacks"
+)
+
+// PatientSummary 患者档案及化验记录摘要
+type PatientSummary struct {
+	Patient      PatientProfile  `json:"patient"`                 // 患者档案
+	ReportDates  []string        `json:"report_dates"`            // 已保存的化验日期
+	LatestReport *DatedLabReport `json:"latest_report,omitempty"` // 最近一次化验结果
+	UrateTrend   *UrateTrend     `json:"urate_trend,omitempty"`   // 血尿酸变化趋势
+}
+
+// summarizePatient 汇总患者档案和化验记录，血尿酸治疗目标取自知识库 kb，为 nil 时使用内置知识库
+func summarizePatient(store *PatientStore, id string, kb *MedicalKnowledgeBase) (*PatientSummary, error) {
+	profile, err := store.GetPatient(id)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := store.Reports(id)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &PatientSummary{Patient: *profile, ReportDates: []string{}}
+	for _, report := range reports {
+		summary.ReportDates = append(summary.ReportDates, report.Date.Format(reportDateLayout))
+	}
+	if len(reports) > 0 {
+		summary.LatestReport = &reports[len(reports)-1]
+		summary.UrateTrend = analyzeUrateTrend(reports, profile.Context(), knowledgeUrateTargets(kb))
+	}
+	return summary, nil
+}
+
+// CurrentPatientTool 当前患者查询工具，只返回会话所用患者的档案，不读取患者库中 "patient use" 设置的当前患者
+type CurrentPatientTool struct {
+	CallbacksHandler callbacks.Handler
+	Store            *PatientStore
+	PatientID        string                // 会话的患者编号，为空时会话未设置患者
+	Knowledge        *MedicalKnowledgeBase // 血尿酸治疗目标取自该知识库，为空时使用内置知识库
+}
+
+// Name 返回工具名称
+func (t CurrentPatientTool) Name() string {
+	return "current_patient"
+}
+
+// Description 返回工具描述
+func (t CurrentPatientTool) Description() string {
+	return `当前患者档案查询工具。用户提到"我"、"这位患者"、"上次的化验"等而未提供数据时，先用该工具查询患者库，
+不要让用户重复粘贴。输入为空或"当前患者"时查询本次会话的患者，不能查询其他患者。
+返回患者性别、年龄、体重、妊娠、痛风石、合并症、当前用药、发作史，
+已保存的化验日期、最近一次化验结果和血尿酸变化趋势。`
+}
+
+// Call 查询患者档案
+func (t CurrentPatientTool) Call(ctx context.Context, input string) (string, error) {
+	if t.CallbacksHandler != nil {
+		t.CallbacksHandler.HandleToolStart(ctx, input)
+	}
+
+	if t.Store == nil {
+		return "未配置患者库", nil
+	}
+
+	if t.PatientID == "" {
+		return "本次会话尚未设置患者，请用户提供化验单数据", nil
+	}
+	id := strings.Trim(strings.TrimSpace(input), `"'`)
+	if id != "" && id != "当前患者" && id != t.PatientID {
+		return fmt.Sprintf("只能查询本次会话的患者 %s，不能查询患者 %s", t.PatientID, id), nil
+	}
+	id = t.PatientID
+
+	summary, err := summarizePatient(t.Store, id, t.Knowledge)
+	if errors.Is(err, errPatientNotFound) {
+		return fmt.Sprintf("患者库中没有编号为 %s 的患者", id), nil
+	}
+	if err != nil {
+		return fmt.Sprintf("读取患者档案时出错: %v", err), nil
+	}
+
+	result, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("格式化患者档案时出错: %v", err), nil
+	}
+
+	if t.CallbacksHandler != nil {
+		t.CallbacksHandler.HandleToolEnd(ctx, string(result))
+	}
+
+	return string(result), nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ReferenceRange 参考范围登记项（数值均为标准单位）
+type ReferenceRange struct {
+	Analyte   string  `json:"analyte"`             // 检测项目标识，如 uric_acid
+	Sex       string  `json:"sex,omitempty"`       // 适用性别，空表示不区分
+	Pediatric bool    `json:"pediatric,omitempty"` // 是否为儿童参考范围
+	Min       float64 `json:"min"`                 // 下限，0 表示无下限
+	Max       float64 `json:"max"`                 // 上限，0 表示无上限
+	Unit      string  `json:"unit"`                // 单位
+	Source    string  `json:"source"`              // 来源，如知识库条目或检验机构
+}
+
+// siteRangesEnv 指定检验机构参考范围文件的环境变量，文件格式见 LoadSiteRanges
+const siteRangesEnv = "GOUT_SITE_RANGES"
+
+// ReferenceRangeRegistry 参考范围登记表
+// 默认范围来自知识库中尿酸、炎症、肾功能条目的参考值，检验机构可按站点覆盖
+type ReferenceRangeRegistry struct {
+	mu       sync.RWMutex
+	defaults []ReferenceRange
+	sites    map[string][]ReferenceRange
+}
+
+// referenceSourceEntries 用于生成默认参考范围的知识库条目
+var referenceSourceEntries = []string{"尿酸", "炎症", "肾功能"}
+
+// 参考值片段，如 "男性54-106μmol/L"、"<3.0 mg/L"、">90ml/min/1.73m²"
+var referenceSegmentRe = regexp.MustCompile(`^(男性|女性|儿童)?\s*([<>])?\s*([0-9]+\.?[0-9]*)\s*(?:-\s*([0-9]+\.?[0-9]*))?(.*)`)
+
+// 检验机构行，如 "检验机构: 示例医院"
+var siteLineRe = regexp.MustCompile(`(?i)^\s*(?:检验机构|检验单位|site)\s*[：:]\s*(.*?)\s*$`)
+
+// NewReferenceRangeRegistry 从知识库参考值创建参考范围登记表
+func NewReferenceRangeRegistry(kb *MedicalKnowledgeBase) *ReferenceRangeRegistry {
+	r := &ReferenceRangeRegistry{sites: make(map[string][]ReferenceRange)}
+	for _, key := range referenceSourceEntries {
+		info, ok := kb.knowledge[key]
+		if !ok {
+			continue
+		}
+		r.defaults = append(r.defaults, parseKnowledgeReferences(key, info)...)
+	}
+	return r
+}
+
+// ReferenceRanges 返回由知识库参考值得到的参考范围登记表，同一知识库的副本共用该登记表
+func (mkb MedicalKnowledgeBase) ReferenceRanges() *ReferenceRangeRegistry {
+	return mkb.ranges
+}
+
+// defaultReferenceRegistry 返回基于内置知识库的共享登记表
+func defaultReferenceRegistry() *ReferenceRangeRegistry {
+	return defaultKnowledgeBase().ranges
+}
+
+// parseKnowledgeReferences 解析知识条目的参考值文本
+// 条目内以 "：" 结尾的行为小节标题，仅解析 "正常参考值" 小节及无标题的行
+func parseKnowledgeReferences(key string, info MedicalInfo) []ReferenceRange {
+	var ranges []ReferenceRange
+	section := ""
+	for _, line := range info.References {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, "：") || strings.HasSuffix(line, ":") {
+			section = strings.TrimRight(line, "：:")
+			continue
+		}
+		if section != "" && section != "正常参考值" {
+			continue
+		}
+
+		label, body, found := strings.Cut(line, "：")
+		if !found {
+			continue
+		}
+
+		// 形如 "男性：208-428 μmol/L" 的行，检测项目由条目本身决定
+		analyte := classifyAnalyte(label)
+		if analyte == "" {
+			analyte = classifyAnalyte(key)
+			body = line
+		}
+		if analyte == "" {
+			continue
+		}
+
+		for _, segment := range strings.Split(body, "，") {
+			ref, ok := parseReferenceSegment(analyte, strings.TrimSpace(segment))
+			if !ok {
+				continue
+			}
+			ref.Source = "知识库: " + key
+			ranges = append(ranges, ref)
+		}
+	}
+	return ranges
+}
+
+// parseReferenceSegment 解析单个参考值片段并换算为标准单位
+func parseReferenceSegment(analyte, segment string) (ReferenceRange, bool) {
+	segment = strings.Replace(segment, "：", "", 1)
+	m := referenceSegmentRe.FindStringSubmatch(segment)
+	if m == nil {
+		return ReferenceRange{}, false
+	}
+
+	rawUnit, _, ok := parseUnit(m[5])
+	if !ok {
+		return ReferenceRange{}, false
+	}
+	// 单位与检测项目不符时（如尿酸清除率的 ml/min）不登记
+	factor, unit, err := canonicalFactor(analyte, rawUnit)
+	if err != nil {
+		return ReferenceRange{}, false
+	}
+
+	ref := ReferenceRange{Analyte: analyte, Unit: unit}
+	switch m[1] {
+	case "男性":
+		ref.Sex = sexMale
+	case "女性":
+		ref.Sex = sexFemale
+	case "儿童":
+		ref.Pediatric = true
+	}
+
+	low, _ := strconv.ParseFloat(m[3], 64)
+	switch {
+	case m[4] != "":
+		high, _ := strconv.ParseFloat(m[4], 64)
+		ref.Min, ref.Max = roundValue(low*factor), roundValue(high*factor)
+	case m[2] == "<":
+		ref.Max = roundValue(low * factor)
+	case m[2] == ">":
+		ref.Min = roundValue(low * factor)
+	default:
+		return ReferenceRange{}, false
+	}
+	return ref, true
+}
+
+// SetSiteRange 为指定检验机构登记参考范围，覆盖同项目同人群的已有登记
+func (r *ReferenceRangeRegistry) SetSiteRange(site string, ref ReferenceRange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ref.Source == "" {
+		ref.Source = "检验机构: " + site
+	}
+	ranges := r.sites[site]
+	for i, existing := range ranges {
+		if existing.Analyte == ref.Analyte && existing.Sex == ref.Sex && existing.Pediatric == ref.Pediatric {
+			ranges[i] = ref
+			return
+		}
+	}
+	r.sites[site] = append(ranges, ref)
+}
+
+// LoadSiteRanges 从 JSON 读取检验机构参考范围，格式为 {"机构名": [ReferenceRange...]}
+func (r *ReferenceRangeRegistry) LoadSiteRanges(reader io.Reader) error {
+	var sites map[string][]ReferenceRange
+	if err := json.NewDecoder(reader).Decode(&sites); err != nil {
+		return fmt.Errorf("解析检验机构参考范围失败: %w", err)
+	}
+	for site, ranges := range sites {
+		for _, ref := range ranges {
+			if ref.Analyte == "" {
+				return fmt.Errorf("检验机构 %s 的参考范围缺少 analyte", site)
+			}
+			r.SetSiteRange(site, ref)
+		}
+	}
+	return nil
+}
+
+// LoadSiteRangesFile 从 JSON 文件读取检验机构参考范围
+func (r *ReferenceRangeRegistry) LoadSiteRangesFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("读取检验机构参考范围失败: %w", err)
+	}
+	defer file.Close()
+	return r.LoadSiteRanges(file)
+}
+
+// parseSiteLine 从输入中提取检验机构行，返回机构名及剩余的化验数据
+// 检验机构行替换为空行，保证化验数据的行号与原始输入一致；有多行时以最后一行为准
+func parseSiteLine(input string) (string, string) {
+	var site string
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		m := siteLineRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		site = m[1]
+		lines[i] = ""
+	}
+	return site, strings.Join(lines, "\n")
+}
+
+// Lookup 按检验机构和患者信息查找参考范围，机构登记优先于默认范围
+func (r *ReferenceRangeRegistry) Lookup(analyte string, patient PatientContext, site string) (ReferenceRange, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if site != "" {
+		if ref, ok := matchReferenceRange(r.sites[site], analyte, patient); ok {
+			return ref, true
+		}
+	}
+	return matchReferenceRange(r.defaults, analyte, patient)
+}
+
+// matchReferenceRange 选择与患者最匹配的参考范围
+// 儿童范围仅用于儿童；区分性别的范围需已知性别（妊娠按女性）
+func matchReferenceRange(ranges []ReferenceRange, analyte string, patient PatientContext) (ReferenceRange, bool) {
+	sex := patient.Sex
+	if patient.IsPregnant() {
+		sex = sexFemale
+	}
+
+	var best ReferenceRange
+	bestScore := -1
+	for _, ref := range ranges {
+		if ref.Analyte != analyte {
+			continue
+		}
+		if ref.Pediatric && !patient.Pediatric {
+			continue
+		}
+		if ref.Sex != "" && ref.Sex != sex {
+			continue
+		}
+
+		score := 0
+		if ref.Pediatric {
+			score += 2
+		}
+		if ref.Sex != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = ref, score
+		}
+	}
+	if bestScore >= 0 || sex != "" {
+		return best, bestScore >= 0
+	}
+	return unionSexRanges(ranges, analyte)
+}
+
+// unionSexRanges 未提供性别时取男女参考范围的并集，仅标记两性均异常的数值
+func unionSexRanges(ranges []ReferenceRange, analyte string) (ReferenceRange, bool) {
+	var union ReferenceRange
+	found := false
+	for _, ref := range ranges {
+		if ref.Analyte != analyte || ref.Pediatric || ref.Sex == "" {
+			continue
+		}
+		if !found {
+			union = ref
+			union.Sex = ""
+			found = true
+			continue
+		}
+		if ref.Min < union.Min {
+			union.Min = ref.Min
+		}
+		if ref.Max == 0 || (union.Max != 0 && ref.Max > union.Max) {
+			union.Max = ref.Max
+		}
+	}
+	if found {
+		union.Source += "（未提供性别，取男女参考范围并集）"
+	}
+	return union, found
+}
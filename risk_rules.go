@@ -0,0 +1,631 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 风险等级
+const (
+	riskLow    = "低风险"
+	riskMedium = "中风险"
+	riskHigh   = "高风险"
+)
+
+// sexUnknown 规则中表示未提供性别
+const sexUnknown = "未知"
+
+// defaultRiskRulesJSON 内置的风险评估规则
+//
+//go:embed rules/gout_risk_rules.json
+var defaultRiskRulesJSON []byte
+
+var (
+	ruleIDRe          = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	placeholderRe     = regexp.MustCompile(`\{[^}]*\}`)
+	validRiskLevels   = []string{riskLow, riskMedium, riskHigh, riskUnassessable}
+	validStatuses     = []string{"正常", "偏高", "偏低"}
+	validCompareOps   = []string{">", ">=", "<", "<="}
+	validCategories   = []string{categoryUrate, categoryInflammation, categoryKidney, categoryUrine}
+	validPatientSexes = []string{sexMale, sexFemale, sexUnknown}
+)
+
+// RuleSet 风险评估规则集，描述基于标准化检测项目和患者信息的判断条件、风险等级及建议
+type RuleSet struct {
+	Version         string                     `json:"version"`               // 规则版本
+	Description     string                     `json:"description,omitempty"` // 规则说明
+	Thresholds      map[string][]ThresholdRule `json:"thresholds,omitempty"`  // 按患者信息选取的命名阈值
+	Recommendations map[string]string          `json:"recommendations"`       // 建议标识 -> 建议内容
+	Rules           []RiskRule                 `json:"rules"`                 // 按顺序评估的规则
+}
+
+// ThresholdRule 命名阈值的一个取值，按顺序选取第一个与患者匹配的取值
+type ThresholdRule struct {
+	Patient *PatientMatch `json:"patient,omitempty"` // 适用人群，为空时适用于所有患者
+	Value   float64       `json:"value"`             // 阈值（标准单位）
+	Label   string        `json:"label,omitempty"`   // 阈值来源说明
+}
+
+// PatientMatch 患者信息条件
+type PatientMatch struct {
+	Sex       string `json:"sex,omitempty"`       // 男/女/未知
+	Pregnant  *bool  `json:"pregnant,omitempty"`  // 是否妊娠
+	Pediatric *bool  `json:"pediatric,omitempty"` // 是否儿童
+}
+
+// RiskRule 单条评估规则
+// 同一 group 内的规则互斥，仅第一条满足条件的规则生效；设置 risk_level 的规则决定最终风险等级
+type RiskRule struct {
+	ID              string         `json:"id"`                        // 规则标识，可被后续规则以 flag 引用
+	Description     string         `json:"description"`               // 规则说明
+	Group           string         `json:"group,omitempty"`           // 互斥分组
+	When            *RuleCondition `json:"when,omitempty"`            // 触发条件，为空时总是触发
+	RiskLevel       string         `json:"risk_level,omitempty"`      // 触发后的风险等级
+	FollowUp        bool           `json:"follow_up,omitempty"`       // 触发后是否需要随访
+	Recommendations []string       `json:"recommendations,omitempty"` // 触发后给出的建议标识
+	Contribution    string         `json:"contribution,omitempty"`    // 对风险等级的贡献说明
+}
+
+// RuleCondition 规则条件，可为组合条件（all/any/not）、已触发规则（flag）、
+// 检测项目条件（analyte/category）或患者条件（patient）之一
+type RuleCondition struct {
+	All []RuleCondition `json:"all,omitempty"` // 全部满足
+	Any []RuleCondition `json:"any,omitempty"` // 任一满足
+	Not *RuleCondition  `json:"not,omitempty"` // 不满足
+
+	Flag string `json:"flag,omitempty"` // 引用之前已触发的规则
+
+	Analyte        string   `json:"analyte,omitempty"`         // 检测项目标识
+	Category       string   `json:"category,omitempty"`        // 检测项目类别
+	Exclude        []string `json:"exclude,omitempty"`         // 按类别匹配时排除的项目
+	Op             string   `json:"op,omitempty"`              // 比较方式: > >= < <= present
+	Value          *float64 `json:"value,omitempty"`           // 比较数值（标准单位）
+	Threshold      string   `json:"threshold,omitempty"`       // 比较所用的命名阈值
+	FallbackStatus string   `json:"fallback_status,omitempty"` // 命名阈值无法按患者信息确定时改按结果状态判断
+	Status         string   `json:"status,omitempty"`          // 结果状态: 正常/偏高/偏低
+	Label          string   `json:"label,omitempty"`           // 比较数值的来源说明
+
+	Patient *PatientMatch `json:"patient,omitempty"` // 患者条件
+}
+
+// RiskEvaluation 规则评估结果
+type RiskEvaluation struct {
+	RiskLevel       string
+	FollowUpNeeded  bool
+	Recommendations []string
+	Trace           []RuleTrace
+}
+
+// RuleSetError 规则文件校验错误，列出全部问题
+type RuleSetError struct {
+	Problems []string
+}
+
+func (e *RuleSetError) Error() string {
+	return fmt.Sprintf("规则文件校验失败: %s", strings.Join(e.Problems, "; "))
+}
+
+// ParseRuleSet 解析并校验规则文件内容，不允许出现未定义的字段
+func ParseRuleSet(data []byte) (*RuleSet, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var rs RuleSet
+	if err := decoder.Decode(&rs); err != nil {
+		return nil, fmt.Errorf("解析规则文件失败: %w", err)
+	}
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// LoadRuleSet 从文件加载规则
+func LoadRuleSet(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取规则文件失败: %w", err)
+	}
+	return ParseRuleSet(data)
+}
+
+// Validate 校验规则集的结构和引用关系
+func (rs *RuleSet) Validate() error {
+	v := &ruleValidator{rs: rs, defined: make(map[string]bool)}
+
+	if strings.TrimSpace(rs.Version) == "" {
+		v.addf("version 不能为空")
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(rs.Thresholds)) {
+		entries := rs.Thresholds[name]
+		if len(entries) == 0 {
+			v.addf("thresholds.%s 至少需要一个取值", name)
+		}
+		for i, entry := range entries {
+			path := fmt.Sprintf("thresholds.%s[%d]", name, i)
+			if entry.Value <= 0 {
+				v.addf("%s.value 必须大于 0", path)
+			}
+			if entry.Patient != nil {
+				v.checkPatient(path+".patient", *entry.Patient)
+			}
+		}
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(rs.Recommendations)) {
+		text := rs.Recommendations[id]
+		if strings.TrimSpace(text) == "" {
+			v.addf("recommendations.%s 内容为空", id)
+		}
+		for _, placeholder := range placeholderRe.FindAllString(text, -1) {
+			if placeholder != "{threshold}" {
+				v.addf("recommendations.%s 含未知占位符 %s", id, placeholder)
+			}
+		}
+	}
+
+	if len(rs.Rules) == 0 {
+		v.addf("rules 不能为空")
+	}
+
+	riskGroup := ""
+	var lastRiskRule *RiskRule
+	for i := range rs.Rules {
+		rule := &rs.Rules[i]
+		path := fmt.Sprintf("rules[%d]", i)
+		if rule.ID != "" {
+			path = fmt.Sprintf("rules[%d](%s)", i, rule.ID)
+		}
+
+		switch {
+		case !ruleIDRe.MatchString(rule.ID):
+			v.addf("%s.id 须为小写字母、数字和下划线", path)
+		case v.defined[rule.ID]:
+			v.addf("%s.id 重复", path)
+		}
+		if strings.TrimSpace(rule.Description) == "" {
+			v.addf("%s.description 不能为空", path)
+		}
+		if rule.When != nil {
+			v.checkCondition(path+".when", *rule.When)
+		}
+		for _, id := range rule.Recommendations {
+			if _, ok := rs.Recommendations[id]; !ok {
+				v.addf("%s.recommendations 引用了未定义的建议 %s", path, id)
+			}
+		}
+
+		if rule.RiskLevel != "" {
+			if !slices.Contains(validRiskLevels, rule.RiskLevel) {
+				v.addf("%s.risk_level 须为 %s 之一", path, strings.Join(validRiskLevels, "/"))
+			}
+			if rule.Group == "" {
+				v.addf("%s 设置了 risk_level，须放入互斥分组", path)
+			} else if riskGroup == "" {
+				riskGroup = rule.Group
+			} else if rule.Group != riskGroup {
+				v.addf("%s 的风险等级规则须与其他风险等级规则位于同一分组 %s", path, riskGroup)
+			}
+		} else if rule.FollowUp {
+			v.addf("%s.follow_up 仅可用于设置了 risk_level 的规则", path)
+		}
+		if riskGroup != "" && rule.Group == riskGroup {
+			if rule.RiskLevel == "" {
+				v.addf("%s 位于风险等级分组 %s，须设置 risk_level", path, riskGroup)
+			}
+			lastRiskRule = rule
+		}
+
+		v.defined[rule.ID] = true
+	}
+
+	switch {
+	case len(rs.Rules) > 0 && riskGroup == "":
+		v.addf("至少需要一条设置 risk_level 的规则")
+	case lastRiskRule != nil && lastRiskRule.When != nil:
+		v.addf("风险等级分组 %s 的最后一条规则 %s 不能设置条件，以保证总能得出风险等级", riskGroup, lastRiskRule.ID)
+	}
+
+	if len(v.problems) > 0 {
+		return &RuleSetError{Problems: v.problems}
+	}
+	return nil
+}
+
+// Lint 返回不影响评估的问题，如未被引用的建议和阈值
+func (rs *RuleSet) Lint() []string {
+	usedRecommendations := make(map[string]bool)
+	usedThresholds := make(map[string]bool)
+	for _, rule := range rs.Rules {
+		for _, id := range rule.Recommendations {
+			usedRecommendations[id] = true
+		}
+		if rule.When != nil {
+			rule.When.walk(func(c RuleCondition) {
+				if c.Threshold != "" {
+					usedThresholds[c.Threshold] = true
+				}
+			})
+		}
+	}
+
+	var warnings []string
+	for _, id := range slices.Sorted(maps.Keys(rs.Recommendations)) {
+		if !usedRecommendations[id] {
+			warnings = append(warnings, fmt.Sprintf("建议 %s 未被任何规则引用", id))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(rs.Thresholds)) {
+		if !usedThresholds[name] {
+			warnings = append(warnings, fmt.Sprintf("阈值 %s 未被任何规则引用", name))
+		}
+	}
+	return warnings
+}
+
+// ruleValidator 收集校验问题
+type ruleValidator struct {
+	rs       *RuleSet
+	defined  map[string]bool // 已定义（位于当前规则之前）的规则标识
+	problems []string
+}
+
+func (v *ruleValidator) addf(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *ruleValidator) checkPatient(path string, p PatientMatch) {
+	if p.Sex == "" && p.Pregnant == nil && p.Pediatric == nil {
+		v.addf("%s 至少需要一个条件", path)
+	}
+	if p.Sex != "" && !slices.Contains(validPatientSexes, p.Sex) {
+		v.addf("%s.sex 须为 %s 之一", path, strings.Join(validPatientSexes, "/"))
+	}
+}
+
+func (v *ruleValidator) checkCondition(path string, c RuleCondition) {
+	kinds := 0
+	for _, present := range []bool{
+		len(c.All) > 0, len(c.Any) > 0, c.Not != nil, c.Flag != "",
+		c.Analyte != "" || c.Category != "", c.Patient != nil,
+	} {
+		if present {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		v.addf("%s 须且仅须为 all/any/not/flag/analyte(category)/patient 之一", path)
+		return
+	}
+
+	switch {
+	case len(c.All) > 0:
+		for i, child := range c.All {
+			v.checkCondition(fmt.Sprintf("%s.all[%d]", path, i), child)
+		}
+	case len(c.Any) > 0:
+		for i, child := range c.Any {
+			v.checkCondition(fmt.Sprintf("%s.any[%d]", path, i), child)
+		}
+	case c.Not != nil:
+		v.checkCondition(path+".not", *c.Not)
+	case c.Flag != "":
+		if !v.defined[c.Flag] {
+			v.addf("%s.flag 引用的规则 %s 未在当前规则之前定义", path, c.Flag)
+		}
+	case c.Patient != nil:
+		v.checkPatient(path+".patient", *c.Patient)
+	default:
+		v.checkLabCondition(path, c)
+	}
+}
+
+func (v *ruleValidator) checkLabCondition(path string, c RuleCondition) {
+	if c.Analyte != "" && c.Category != "" {
+		v.addf("%s 不能同时设置 analyte 和 category", path)
+	}
+	if c.Analyte != "" {
+		if _, ok := lookupAnalyte(c.Analyte); !ok {
+			v.addf("%s.analyte 未知的检测项目 %s", path, c.Analyte)
+		}
+	}
+	if c.Category != "" && !slices.Contains(validCategories, c.Category) {
+		v.addf("%s.category 须为 %s 之一", path, strings.Join(validCategories, "/"))
+	}
+	if len(c.Exclude) > 0 && c.Category == "" {
+		v.addf("%s.exclude 仅可与 category 一起使用", path)
+	}
+	for _, id := range c.Exclude {
+		if _, ok := lookupAnalyte(id); !ok {
+			v.addf("%s.exclude 未知的检测项目 %s", path, id)
+		}
+	}
+
+	switch {
+	case c.Op == "" && c.Status == "":
+		v.addf("%s 须设置 op 或 status", path)
+	case c.Op != "" && c.Status != "":
+		v.addf("%s 不能同时设置 op 和 status", path)
+	case c.Status != "":
+		if !slices.Contains(validStatuses, c.Status) {
+			v.addf("%s.status 须为 %s 之一", path, strings.Join(validStatuses, "/"))
+		}
+	case c.Op == "present":
+		if c.Value != nil || c.Threshold != "" {
+			v.addf("%s op 为 present 时不能设置 value 或 threshold", path)
+		}
+	case slices.Contains(validCompareOps, c.Op):
+		if (c.Value == nil) == (c.Threshold == "") {
+			v.addf("%s 比较条件须且仅须设置 value 或 threshold 之一", path)
+		}
+		if _, ok := v.rs.Thresholds[c.Threshold]; c.Threshold != "" && !ok {
+			v.addf("%s.threshold 引用了未定义的阈值 %s", path, c.Threshold)
+		}
+	default:
+		v.addf("%s.op 须为 %s 或 present", path, strings.Join(validCompareOps, " "))
+	}
+
+	if c.FallbackStatus != "" {
+		if c.Threshold == "" {
+			v.addf("%s.fallback_status 仅可与 threshold 一起使用", path)
+		}
+		if !slices.Contains(validStatuses, c.FallbackStatus) {
+			v.addf("%s.fallback_status 须为 %s 之一", path, strings.Join(validStatuses, "/"))
+		}
+	}
+}
+
+// walk 遍历条件树
+func (c RuleCondition) walk(fn func(RuleCondition)) {
+	fn(c)
+	for _, child := range c.All {
+		child.walk(fn)
+	}
+	for _, child := range c.Any {
+		child.walk(fn)
+	}
+	if c.Not != nil {
+		c.Not.walk(fn)
+	}
+}
+
+// ruleContext 规则评估上下文
+type ruleContext struct {
+	rs      *RuleSet
+	results []LabResult
+	patient PatientContext
+	flags   map[string]conditionMatch // 已触发规则的命中依据
+}
+
+// conditionMatch 条件命中的依据
+type conditionMatch struct {
+	inputs    []LabResult // 命中的化验结果
+	criteria  []string    // 比较所用的阈值说明
+	threshold float64     // 比较所用的数值，用于建议中的 {threshold}
+}
+
+func (m *conditionMatch) merge(other conditionMatch) {
+	m.inputs = append(m.inputs, other.inputs...)
+	m.criteria = append(m.criteria, other.criteria...)
+	if other.threshold != 0 {
+		m.threshold = other.threshold
+	}
+}
+
+// Evaluate 按顺序评估规则，得出风险等级、建议及已触发规则的记录
+func (rs *RuleSet) Evaluate(results []LabResult, patient PatientContext) RiskEvaluation {
+	ctx := &ruleContext{rs: rs, results: results, patient: patient, flags: make(map[string]conditionMatch)}
+	evaluation := RiskEvaluation{Recommendations: []string{}, Trace: []RuleTrace{}}
+	firedGroups := make(map[string]bool)
+
+	for _, rule := range rs.Rules {
+		if rule.Group != "" && firedGroups[rule.Group] {
+			continue
+		}
+		matched, match := true, conditionMatch{}
+		if rule.When != nil {
+			matched, match = rule.When.eval(ctx)
+		}
+		if !matched {
+			continue
+		}
+
+		ctx.flags[rule.ID] = match
+		if rule.Group != "" {
+			firedGroups[rule.Group] = true
+		}
+		if rule.RiskLevel != "" {
+			evaluation.RiskLevel = rule.RiskLevel
+			evaluation.FollowUpNeeded = rule.FollowUp
+		}
+		for _, id := range rule.Recommendations {
+			text := rs.Recommendations[id]
+			text = strings.ReplaceAll(text, "{threshold}", strconv.FormatFloat(match.threshold, 'f', -1, 64))
+			evaluation.Recommendations = append(evaluation.Recommendations, text)
+		}
+		evaluation.Trace = append(evaluation.Trace, traceRule(rule, match))
+	}
+	return evaluation
+}
+
+// eval 评估条件，返回是否满足及命中依据
+func (c RuleCondition) eval(ctx *ruleContext) (bool, conditionMatch) {
+	var match conditionMatch
+	switch {
+	case len(c.All) > 0:
+		for _, child := range c.All {
+			ok, m := child.eval(ctx)
+			if !ok {
+				return false, conditionMatch{}
+			}
+			match.merge(m)
+		}
+		return true, match
+	case len(c.Any) > 0:
+		matched := false
+		for _, child := range c.Any {
+			if ok, m := child.eval(ctx); ok {
+				matched = true
+				match.merge(m)
+			}
+		}
+		return matched, match
+	case c.Not != nil:
+		ok, _ := c.Not.eval(ctx)
+		return !ok, match
+	case c.Flag != "":
+		// 沿用被引用规则所用的化验结果和阈值说明，使依据规则的记录也能说明风险等级的来源；
+		// 建议中的 {threshold} 只取本规则自身的比较数值
+		flagged, ok := ctx.flags[c.Flag]
+		if !ok {
+			return false, match
+		}
+		match.inputs = slices.Clone(flagged.inputs)
+		match.criteria = slices.Clone(flagged.criteria)
+		return true, match
+	case c.Patient != nil:
+		return c.Patient.matches(ctx.patient), match
+	}
+	return c.evalLab(ctx)
+}
+
+// evalLab 评估检测项目条件
+func (c RuleCondition) evalLab(ctx *ruleContext) (bool, conditionMatch) {
+	var candidates []LabResult
+	for _, result := range ctx.results {
+		if c.Analyte != "" && result.AnalyteID != c.Analyte {
+			continue
+		}
+		if c.Category != "" {
+			analyte, _ := lookupAnalyte(result.AnalyteID)
+			if analyte.Category != c.Category || slices.Contains(c.Exclude, result.AnalyteID) {
+				continue
+			}
+		}
+		candidates = append(candidates, result)
+	}
+
+	var match conditionMatch
+	switch {
+	case c.Op == "present":
+		match.inputs = candidates
+	case c.Status != "":
+		match.inputs = filterByStatus(candidates, c.Status)
+		match.criteria = []string{describeStatus(c.Status)}
+	default:
+		value, label, ok := c.resolveThreshold(ctx)
+		if !ok {
+			if c.FallbackStatus == "" {
+				return false, conditionMatch{}
+			}
+			match.inputs = filterByStatus(candidates, c.FallbackStatus)
+			match.criteria = []string{describeStatus(c.FallbackStatus)}
+			break
+		}
+		for _, result := range candidates {
+			if compareValue(result.Value, c.Op, value) {
+				match.inputs = append(match.inputs, result)
+			}
+		}
+		match.threshold = value
+		match.criteria = []string{c.describeComparison(value, label)}
+	}
+
+	if len(match.inputs) == 0 {
+		return false, conditionMatch{}
+	}
+	return true, match
+}
+
+// resolveThreshold 返回比较所用的数值及来源说明，命名阈值按患者信息选取
+func (c RuleCondition) resolveThreshold(ctx *ruleContext) (float64, string, bool) {
+	if c.Value != nil {
+		return *c.Value, c.Label, true
+	}
+	for _, entry := range ctx.rs.Thresholds[c.Threshold] {
+		if entry.Patient == nil || entry.Patient.matches(ctx.patient) {
+			return entry.Value, entry.Label, true
+		}
+	}
+	return 0, "", false
+}
+
+// describeComparison 描述比较条件，如 ">420 μmol/L（男性高尿酸血症诊断标准）"
+func (c RuleCondition) describeComparison(value float64, label string) string {
+	text := c.Op + strconv.FormatFloat(value, 'f', -1, 64)
+	if conv, ok := analyteUnitConversions[c.Analyte]; ok {
+		text += " " + conv.Canonical
+	}
+	if label != "" {
+		text += "（" + label + "）"
+	}
+	return text
+}
+
+// matches 判断患者是否符合条件
+func (p PatientMatch) matches(patient PatientContext) bool {
+	switch p.Sex {
+	case "":
+	case sexUnknown:
+		if patient.Sex != "" {
+			return false
+		}
+	default:
+		if patient.Sex != p.Sex {
+			return false
+		}
+	}
+	if p.Pregnant != nil && *p.Pregnant != patient.IsPregnant() {
+		return false
+	}
+	if p.Pediatric != nil && *p.Pediatric != patient.Pediatric {
+		return false
+	}
+	return true
+}
+
+// compareValue 按比较方式比较数值
+func compareValue(value float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// filterByStatus 筛选指定状态的化验结果
+func filterByStatus(results []LabResult, status string) []LabResult {
+	var filtered []LabResult
+	for _, result := range results {
+		if result.Status == status {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// describeStatus 描述按状态判断的条件
+func describeStatus(status string) string {
+	switch status {
+	case "偏高":
+		return "高于参考上限"
+	case "偏低":
+		return "低于参考下限"
+	}
+	return "在参考范围内"
+}
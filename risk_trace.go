@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RuleTrace 单条评估规则的触发记录，说明风险等级的依据
+type RuleTrace struct {
+	Rule            string      `json:"rule"`                      // 规则标识
+	Description     string      `json:"description"`               // 规则说明
+	Inputs          []LabResult `json:"inputs,omitempty"`          // 规则使用的化验结果
+	Threshold       string      `json:"threshold,omitempty"`       // 比较所用的阈值及来源
+	Observed        string      `json:"observed,omitempty"`        // 实际比较结果
+	Recommendations []string    `json:"recommendations,omitempty"` // 规则给出的建议标识
+	Contribution    string      `json:"contribution"`              // 对最终风险等级的贡献
+}
+
+// traceRule 生成已触发规则的记录
+func traceRule(rule RiskRule, match conditionMatch) RuleTrace {
+	inputs := uniqueResults(match.inputs)
+	trace := RuleTrace{
+		Rule:            rule.ID,
+		Description:     rule.Description,
+		Inputs:          inputs,
+		Threshold:       strings.Join(uniqueStrings(match.criteria), "；"),
+		Observed:        describeResults(inputs),
+		Recommendations: rule.Recommendations,
+		Contribution:    rule.Contribution,
+	}
+
+	if trace.Contribution == "" {
+		switch {
+		case rule.RiskLevel != "":
+			trace.Contribution = "风险等级为" + rule.RiskLevel
+		case len(rule.Recommendations) > 0:
+			trace.Contribution = "仅影响建议，不改变风险等级"
+		}
+	}
+	return trace
+}
+
+// describeResults 将化验结果格式化为 "尿酸 520 μmol/L" 形式
+func describeResults(results []LabResult) string {
+	parts := make([]string, 0, len(results))
+	for _, r := range results {
+		parts = append(parts, fmt.Sprintf("%s %g %s", r.Parameter, r.Value, r.Unit))
+	}
+	return strings.Join(parts, "、")
+}
+
+// uniqueResults 去除多个条件命中的同一化验结果
+func uniqueResults(results []LabResult) []LabResult {
+	seen := make(map[string]bool)
+	var unique []LabResult
+	for _, r := range results {
+		key := r.AnalyteID + "|" + r.Parameter
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, r)
+	}
+	return unique
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, v := range values {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		unique = append(unique, v)
+	}
+	return unique
+}
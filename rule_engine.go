@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// rulesFileEnv 指定风险评估规则文件的环境变量，未设置时使用内置规则
+const rulesFileEnv = "GOUT_RULES_FILE"
+
+// rulesReloadInterval 规则文件变更检查间隔
+const rulesReloadInterval = 2 * time.Second
+
+var (
+	defaultRuleEngineOnce sync.Once
+	defaultEngine         *RuleEngine
+)
+
+// RuleEngine 持有当前生效的风险评估规则，规则文件修改后可热加载
+// 新规则校验失败时保留原有规则
+type RuleEngine struct {
+	mu      sync.RWMutex
+	rules   *RuleSet
+	path    string    // 规则文件路径，为空表示内置规则
+	modTime time.Time // 已加载规则文件的修改时间
+}
+
+// NewRuleEngine 从规则文件创建规则引擎，path 为空时使用内置规则
+func NewRuleEngine(path string) (*RuleEngine, error) {
+	if path == "" {
+		rules, err := ParseRuleSet(defaultRiskRulesJSON)
+		if err != nil {
+			return nil, fmt.Errorf("内置规则无效: %w", err)
+		}
+		return &RuleEngine{rules: rules}, nil
+	}
+
+	engine := &RuleEngine{path: path}
+	if _, err := engine.Reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// loadRuleEngine 按环境变量 GOUT_RULES_FILE 加载风险评估规则，未设置时使用内置规则
+// 各运行模式都通过它加载规则，交互、serve、mcp 等常驻模式另行监听文件变更
+func loadRuleEngine() (*RuleEngine, error) {
+	rules, err := NewRuleEngine(os.Getenv(rulesFileEnv))
+	if err != nil {
+		return nil, fmt.Errorf("加载风险评估规则失败: %w", err)
+	}
+	return rules, nil
+}
+
+// newStaticRuleEngine 使用给定规则创建不热加载的规则引擎
+func newStaticRuleEngine(rules *RuleSet) *RuleEngine {
+	return &RuleEngine{rules: rules}
+}
+
+// defaultRuleEngine 返回使用内置规则的共享引擎
+func defaultRuleEngine() *RuleEngine {
+	defaultRuleEngineOnce.Do(func() {
+		engine, err := NewRuleEngine("")
+		if err != nil {
+			panic(err)
+		}
+		defaultEngine = engine
+	})
+	return defaultEngine
+}
+
+// RuleSet 返回当前生效的规则
+func (e *RuleEngine) RuleSet() *RuleSet {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.rules
+}
+
+// Path 返回规则文件路径，内置规则返回空
+func (e *RuleEngine) Path() string {
+	return e.path
+}
+
+// Reload 规则文件修改时间变化后重新加载，返回是否加载了新规则
+func (e *RuleEngine) Reload() (bool, error) {
+	if e.path == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return false, fmt.Errorf("读取规则文件失败: %w", err)
+	}
+
+	e.mu.RLock()
+	unchanged := e.rules != nil && info.ModTime().Equal(e.modTime)
+	e.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	rules, err := LoadRuleSet(e.path)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// 无论新规则是否有效都记录修改时间，避免对同一个无效文件反复报错
+	e.modTime = info.ModTime()
+	if err != nil {
+		return false, err
+	}
+	e.rules = rules
+	return true, nil
+}
+
+// Watch 定期检查规则文件，变更后热加载，直到 ctx 取消
+// onReload 在加载新规则或加载失败时调用，可为 nil
+func (e *RuleEngine) Watch(ctx context.Context, interval time.Duration, onReload func(*RuleSet, error)) {
+	if e.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := e.Reload()
+			if onReload != nil && (reloaded || err != nil) {
+				onReload(e.RuleSet(), err)
+			}
+		}
+	}
+}
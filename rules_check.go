@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// defaultRuleFixturesJSON 内置的规则样例
+//
+//go:embed rules/fixtures.json
+var defaultRuleFixturesJSON []byte
+
+// RuleFixture 规则样例：一份化验单及其预期评估结果
+type RuleFixture struct {
+	Name   string            `json:"name"`
+	Input  string            `json:"input"`
+	Expect RuleFixtureExpect `json:"expect"`
+}
+
+// RuleFixtureExpect 样例的预期结果，未设置的字段不检查
+type RuleFixtureExpect struct {
+	RiskLevel       string   `json:"risk_level,omitempty"`      // 风险等级
+	FollowUp        *bool    `json:"follow_up,omitempty"`       // 是否需要随访
+	Fired           []string `json:"fired,omitempty"`           // 应触发的规则
+	NotFired        []string `json:"not_fired,omitempty"`       // 不应触发的规则
+	Recommendations []string `json:"recommendations,omitempty"` // 应给出的建议标识
+}
+
+// runRulesCommand 处理 rules 子命令
+func runRulesCommand(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return fmt.Errorf("用法: rules check [-fixtures 样例文件] [规则文件]")
+	}
+
+	flags := flag.NewFlagSet("rules check", flag.ContinueOnError)
+	fixturesPath := flags.String("fixtures", "", "规则样例文件 (默认使用内置样例)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	rulesPath := flags.Arg(0)
+	if rulesPath == "" {
+		rulesPath = os.Getenv(rulesFileEnv)
+	}
+	return checkRules(rulesPath, *fixturesPath)
+}
+
+// checkRules 校验规则文件并用样例逐一验证，任一样例不符时返回错误
+func checkRules(rulesPath, fixturesPath string) error {
+	source := rulesPath
+	if source == "" {
+		source = "内置规则"
+	}
+	fmt.Printf("🔎 检查规则: %s\n", source)
+
+	data := defaultRiskRulesJSON
+	if rulesPath != "" {
+		var err error
+		if data, err = os.ReadFile(rulesPath); err != nil {
+			return fmt.Errorf("读取规则文件失败: %w", err)
+		}
+	}
+	rules, err := ParseRuleSet(data)
+	if err != nil {
+		if ruleErr, ok := err.(*RuleSetError); ok {
+			for _, problem := range ruleErr.Problems {
+				fmt.Printf("❌ %s\n", problem)
+			}
+		}
+		return err
+	}
+	fmt.Printf("✅ 规则版本 %s，共 %d 条规则、%d 条建议\n", rules.Version, len(rules.Rules), len(rules.Recommendations))
+	for _, warning := range rules.Lint() {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
+
+	fixtures, err := loadRuleFixtures(fixturesPath)
+	if err != nil {
+		return err
+	}
+
+	analyzer := GoutLabAnalyzer{Rules: newStaticRuleEngine(rules)}
+	failed := 0
+	for _, fixture := range fixtures {
+		problems := runRuleFixture(analyzer, fixture)
+		if len(problems) == 0 {
+			fmt.Printf("✅ %s\n", fixture.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("❌ %s\n", fixture.Name)
+		for _, problem := range problems {
+			fmt.Printf("     %s\n", problem)
+		}
+	}
+
+	fmt.Printf("\n样例 %d 个，通过 %d 个，失败 %d 个\n", len(fixtures), len(fixtures)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d 个样例未通过", failed)
+	}
+	return nil
+}
+
+// loadRuleFixtures 加载规则样例，path 为空时使用内置样例
+func loadRuleFixtures(path string) ([]RuleFixture, error) {
+	data := defaultRuleFixturesJSON
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("读取规则样例失败: %w", err)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var fixtures []RuleFixture
+	if err := decoder.Decode(&fixtures); err != nil {
+		return nil, fmt.Errorf("解析规则样例失败: %w", err)
+	}
+	return fixtures, nil
+}
+
+// runRuleFixture 分析样例化验单，返回与预期不符之处
+func runRuleFixture(analyzer GoutLabAnalyzer, fixture RuleFixture) []string {
+	output, err := analyzer.Call(context.Background(), fixture.Input)
+	if err != nil {
+		return []string{fmt.Sprintf("分析失败: %v", err)}
+	}
+	var analysis GoutAnalysisResult
+	if err := json.Unmarshal([]byte(output), &analysis); err != nil {
+		return []string{fmt.Sprintf("分析结果无法解析: %v", err)}
+	}
+
+	var fired, recommendations []string
+	for _, trace := range analysis.RuleTrace {
+		fired = append(fired, trace.Rule)
+		recommendations = append(recommendations, trace.Recommendations...)
+	}
+
+	var problems []string
+	expect := fixture.Expect
+	if expect.RiskLevel != "" && analysis.RiskLevel != expect.RiskLevel {
+		problems = append(problems, fmt.Sprintf("风险等级为 %s，期望 %s", analysis.RiskLevel, expect.RiskLevel))
+	}
+	if expect.FollowUp != nil && analysis.FollowUpNeeded != *expect.FollowUp {
+		problems = append(problems, fmt.Sprintf("需要随访为 %v，期望 %v", analysis.FollowUpNeeded, *expect.FollowUp))
+	}
+	for _, rule := range expect.Fired {
+		if !slices.Contains(fired, rule) {
+			problems = append(problems, fmt.Sprintf("规则 %s 未触发", rule))
+		}
+	}
+	for _, rule := range expect.NotFired {
+		if slices.Contains(fired, rule) {
+			problems = append(problems, fmt.Sprintf("规则 %s 不应触发", rule))
+		}
+	}
+	for _, id := range expect.Recommendations {
+		if !slices.Contains(recommendations, id) {
+			problems = append(problems, fmt.Sprintf("未给出建议 %s", id))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// 服务模式的默认参数
+const (
+	defaultServeAddr      = ":8080"
+	defaultMaxBodyBytes   = 1 << 20 // 1 MiB
+	defaultRequestTimeout = 2 * time.Minute
+	defaultSessionTTL     = 30 * time.Minute
+	defaultMaxSessions    = 100
+)
+
+// openAPIDocument 服务接口的 OpenAPI 文档
+//
+//go:embed api/openapi.json
+var openAPIDocument []byte
+
+// apiConfig 服务的请求限制
+type apiConfig struct {
+	MaxBodyBytes   int64         // 请求体大小上限
+	RequestTimeout time.Duration // 单个请求的处理时限
+	SessionTTL     time.Duration // 对话会话闲置超过该时长后失效
+	MaxSessions    int           // 同时存在的对话会话上限
+}
+
+// apiServer 化验单分析、知识查询和智能体对话的 HTTP 接口
+type apiServer struct {
+	llm       llms.Model // 为 nil 时对话接口不可用
+	llmErr    error      // 模型不可用的原因
+	rules     *RuleEngine
+	patients  *PatientStore
+	knowledge *MedicalKnowledgeBase
+	guideline *GuidelineIndex // 为 nil 时会话不提供指南检索
+	config    apiConfig
+
+	mu       sync.Mutex
+	sessions map[string]*apiSession
+}
+
+// apiSession 服务端保存的对话会话，对话记忆保存在 session 中
+type apiSession struct {
+	busy      sync.Mutex // 同一会话的消息依次处理
+	session   *session
+	id        string
+	patientID string
+	createdAt time.Time
+
+	// 以下字段由 apiServer.mu 保护
+	lastUsed time.Time
+	messages []exchange
+}
+
+// AnalyzeRequest 化验单分析请求
+type AnalyzeRequest struct {
+	Report    string `json:"report"`               // 化验单文本，格式与交互模式相同
+	PatientID string `json:"patient_id,omitempty"` // 患者库中的患者编号，指定时结合其档案并保存化验记录
+	Site      string `json:"site,omitempty"`       // 检验机构，缺少参考范围的项目优先使用该机构登记的范围
+
+	RequireUricAcid bool `json:"require_uric_acid,omitempty"` // 严格模式：未识别到血尿酸时返回错误，不保存化验记录
+}
+
+// SessionRequest 创建对话会话的请求
+type SessionRequest struct {
+	PatientID string `json:"patient_id,omitempty"` // 会话使用的患者档案
+}
+
+// MessageRequest 对话消息
+type MessageRequest struct {
+	Message string `json:"message"`
+}
+
+// MessageResponse 智能体的答复
+type MessageResponse struct {
+	SessionID string `json:"session_id"`
+	Answer    string `json:"answer"`
+}
+
+// SessionInfo 对话会话信息
+type SessionInfo struct {
+	ID        string     `json:"id"`
+	PatientID string     `json:"patient_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"` // 闲置到该时间后失效
+	Messages  []exchange `json:"messages"`
+}
+
+// apiError 错误响应
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// runServeCommand 处理 serve 子命令
+func runServeCommand(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	llmArgs := registerLLMFlags(flags)
+	addr := flags.String("addr", defaultServeAddr, "监听地址")
+	config := apiConfig{}
+	flags.Int64Var(&config.MaxBodyBytes, "max-body", defaultMaxBodyBytes, "请求体大小上限（字节）")
+	flags.DurationVar(&config.RequestTimeout, "request-timeout", defaultRequestTimeout, "单个请求的处理时限")
+	flags.DurationVar(&config.SessionTTL, "session-ttl", defaultSessionTTL, "对话会话闲置多久后失效")
+	flags.IntVar(&config.MaxSessions, "max-sessions", defaultMaxSessions, "同时存在的对话会话上限")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("无法识别的参数: %s", strings.Join(flags.Args(), " "))
+	}
+	llmArgs.markSet(flags)
+
+	// 缺少 API 密钥时仍提供化验单分析和知识查询
+	llm, cfg, llmErr := setupLLMFromFlags(llmArgs)
+	if llmErr != nil && !errors.Is(llmErr, errMissingAPIKey) {
+		return llmErr
+	}
+	if llmErr != nil {
+		fmt.Printf("⚠️  %v，对话接口不可用\n", llmErr)
+	} else {
+		fmt.Printf("🤖 模型: %s\n", cfg)
+	}
+
+	rules, err := loadRuleEngine()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go rules.Watch(ctx, rulesReloadInterval, func(rs *RuleSet, err error) {
+		if err != nil {
+			fmt.Printf("⚠️  规则文件重新加载失败，继续使用原有规则: %v\n", err)
+			return
+		}
+		fmt.Printf("🔄 已重新加载风险评估规则 (版本 %s)\n", rs.Version)
+	})
+
+	knowledge, err := loadKnowledgeBase()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("📚 医学知识库: %d 个条目 (版本 %s)\n", len(knowledge.Entries()), knowledge.Version())
+
+	patients, err := OpenPatientStore(os.Getenv(patientDBEnv))
+	if err != nil {
+		return err
+	}
+	defer patients.Close()
+
+	guidelines, err := loadGuidelines(os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	api := newAPIServer(llm, llmErr, rules, knowledge, patients, config)
+	api.guideline = guidelines
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           api.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	fmt.Printf("🌐 服务已启动: http://%s (接口文档: /openapi.json)\n", *addr)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		fmt.Println("\n⏹  正在关闭服务...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// newAPIServer 创建 HTTP 接口，llm 为 nil 时对话接口返回 503，knowledge 为 nil 时使用内置知识
+func newAPIServer(llm llms.Model, llmErr error, rules *RuleEngine, knowledge *MedicalKnowledgeBase, patients *PatientStore, config apiConfig) *apiServer {
+	if knowledge == nil {
+		knowledge = NewMedicalKnowledgeBase()
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = defaultRequestTimeout
+	}
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = defaultSessionTTL
+	}
+	if config.MaxSessions <= 0 {
+		config.MaxSessions = defaultMaxSessions
+	}
+	return &apiServer{
+		llm:       llm,
+		llmErr:    llmErr,
+		rules:     rules,
+		patients:  patients,
+		knowledge: knowledge,
+		config:    config,
+		sessions:  make(map[string]*apiSession),
+	}
+}
+
+// handler 返回路由
+func (a *apiServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", a.health)
+	mux.HandleFunc("GET /openapi.json", a.openAPI)
+	mux.HandleFunc("POST /v1/analyze", a.analyze)
+	mux.HandleFunc("GET /v1/knowledge", a.lookupKnowledge)
+	mux.HandleFunc("POST /v1/sessions", a.createSession)
+	mux.HandleFunc("GET /v1/sessions/{id}", a.getSession)
+	mux.HandleFunc("DELETE /v1/sessions/{id}", a.deleteSession)
+	mux.HandleFunc("POST /v1/sessions/{id}/messages", a.postMessage)
+	return a.limit(mux)
+}
+
+// limit 为每个请求设置请求体大小上限和处理时限
+func (a *apiServer) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, a.config.MaxBodyBytes)
+		ctx, cancel := context.WithTimeout(r.Context(), a.config.RequestTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// health 健康检查
+func (a *apiServer) health(w http.ResponseWriter, r *http.Request) {
+	analyzer := GoutLabAnalyzer{Rules: a.rules}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":        "ok",
+		"chat":          a.llm != nil,
+		"rules_version": analyzer.ruleSet().Version,
+	})
+}
+
+// openAPI 返回接口文档
+func (a *apiServer) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+// analyze 分析化验单，不经过大模型，返回与 gout_lab_analyzer 相同的 JSON 结构
+// 请求体可以是 AnalyzeRequest，也可以是 text/plain 的化验单文本
+func (a *apiServer) analyze(w http.ResponseWriter, r *http.Request) {
+	var req AnalyzeRequest
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/plain" {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeBodyError(w, err)
+			return
+		}
+		req.Report = string(data)
+		req.PatientID = r.URL.Query().Get("patient_id")
+		req.Site = r.URL.Query().Get("site")
+		if value := r.URL.Query().Get("require_uric_acid"); value != "" {
+			if req.RequireUricAcid, err = strconv.ParseBool(value); err != nil {
+				writeError(w, http.StatusBadRequest, "require_uric_acid 应为 true 或 false")
+				return
+			}
+		}
+	} else if !decodeJSON(w, r, &req, false) {
+		return
+	}
+	if strings.TrimSpace(req.Report) == "" {
+		writeError(w, http.StatusBadRequest, "report 不能为空")
+		return
+	}
+
+	analyzer := GoutLabAnalyzer{Rules: a.rules, Knowledge: a.knowledge, Site: req.Site, RequireUricAcid: req.RequireUricAcid}
+	if req.PatientID != "" {
+		profile, ok := a.lookupPatient(w, req.PatientID)
+		if !ok {
+			return
+		}
+		analyzer.Patient = profile.Context()
+		analyzer.History = a.patients
+		analyzer.PatientID = profile.ID
+	}
+	result, err := analyzer.Analyze(req.Report)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// lookupKnowledge 按相关性查询医学知识库，k 指定返回的条目数，sections 指定只返回的小节（逗号分隔）
+func (a *apiServer) lookupKnowledge(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "缺少查询参数 q")
+		return
+	}
+	k := defaultKnowledgeTopK
+	if value := r.URL.Query().Get("k"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxKnowledgeTopK {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("k 应为 1-%d 的整数", maxKnowledgeTopK))
+			return
+		}
+		k = n
+	}
+	var sections []string
+	for _, value := range r.URL.Query()["sections"] {
+		sections = append(sections, strings.Split(value, ",")...)
+	}
+	knowledgeQuery, err := newKnowledgeQuery(query, sections)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	results := a.knowledge.Query(knowledgeQuery, k)
+	if results == nil {
+		results = []KnowledgeMatch{}
+	}
+	w.Header().Set("X-Knowledge-Version", a.knowledge.Version())
+	writeJSON(w, http.StatusOK, results)
+}
+
+// createSession 创建带服务端对话记忆的会话
+func (a *apiServer) createSession(w http.ResponseWriter, r *http.Request) {
+	if a.llm == nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("对话接口不可用: %v", a.llmErr))
+		return
+	}
+	var req SessionRequest
+	if !decodeJSON(w, r, &req, true) {
+		return
+	}
+	var profile *PatientProfile
+	if req.PatientID != "" {
+		var ok bool
+		if profile, ok = a.lookupPatient(w, req.PatientID); !ok {
+			return
+		}
+	}
+
+	// 会话只使用请求中指定的患者，不使用命令行设置的当前患者
+	s, err := newSession(a.llm, a.rules, a.knowledge, a.patients, io.Discard)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if profile != nil || s.patient != nil {
+		s.setPatient(profile)
+	}
+	if a.guideline != nil {
+		s.setGuidelines(a.guideline)
+	}
+	id, err := newSessionID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	now := time.Now()
+	as := &apiSession{session: s, id: id, patientID: req.PatientID, createdAt: now, lastUsed: now}
+
+	a.mu.Lock()
+	a.sweepLocked(now)
+	if len(a.sessions) >= a.config.MaxSessions {
+		a.mu.Unlock()
+		writeError(w, http.StatusTooManyRequests, fmt.Sprintf("会话数已达上限 %d，请稍后重试或删除不再使用的会话", a.config.MaxSessions))
+		return
+	}
+	a.sessions[id] = as
+	info := a.infoLocked(as)
+	a.mu.Unlock()
+
+	w.Header().Set("Location", "/v1/sessions/"+id)
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// getSession 返回会话信息和对话记录
+func (a *apiServer) getSession(w http.ResponseWriter, r *http.Request) {
+	as, ok := a.lookupSession(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	a.mu.Lock()
+	info := a.infoLocked(as)
+	a.mu.Unlock()
+	writeJSON(w, http.StatusOK, info)
+}
+
+// deleteSession 删除会话
+func (a *apiServer) deleteSession(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.lookupSession(w, r.PathValue("id")); !ok {
+		return
+	}
+	a.mu.Lock()
+	delete(a.sessions, r.PathValue("id"))
+	a.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// postMessage 向会话发送一条消息，返回智能体的答复
+func (a *apiServer) postMessage(w http.ResponseWriter, r *http.Request) {
+	as, ok := a.lookupSession(w, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	var req MessageRequest
+	if !decodeJSON(w, r, &req, false) {
+		return
+	}
+	message := strings.TrimSpace(req.Message)
+	if message == "" {
+		writeError(w, http.StatusBadRequest, "message 不能为空")
+		return
+	}
+	if !as.busy.TryLock() {
+		writeError(w, http.StatusConflict, "会话正在处理上一条消息")
+		return
+	}
+	defer as.busy.Unlock()
+
+	if acceptsEventStream(r) {
+		a.streamMessage(w, r, as, message)
+		return
+	}
+
+	ctx := r.Context()
+	answer, err := as.session.ask(ctx, message)
+	if err != nil {
+		status, text := a.askError(ctx, err)
+		if status != 0 {
+			writeError(w, status, text)
+		}
+		return
+	}
+	a.recordMessage(as, message, answer)
+	writeJSON(w, http.StatusOK, MessageResponse{SessionID: as.id, Answer: answer})
+}
+
+// streamMessage 以 Server-Sent Events 返回智能体处理过程
+// 依次发送 thought、tool_start、tool_end、token 事件，最后发送 answer 或 error 事件
+func (a *apiServer) streamMessage(w http.ResponseWriter, r *http.Request, as *apiSession, message string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "服务不支持流式响应")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	events := &sseWriter{w: w, flusher: flusher}
+	flusher.Flush()
+
+	// 模型或工具长时间没有输出时发送注释行，避免代理断开空闲连接
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(sseHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				events.comment("ping")
+			}
+		}
+	}()
+
+	ctx := r.Context()
+	answer, err := as.session.askStream(ctx, message, events.send)
+	if err != nil {
+		if status, text := a.askError(ctx, err); status != 0 {
+			events.send(AgentEvent{Type: agentEventError, Error: text})
+		}
+		return
+	}
+	a.recordMessage(as, message, answer)
+	events.send(AgentEvent{Type: agentEventAnswer, Text: answer})
+}
+
+// askError 将智能体返回的错误转换为状态码和错误信息，客户端已断开时状态码为 0
+func (a *apiServer) askError(ctx context.Context, err error) (int, string) {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, fmt.Sprintf("处理超时 (%s)", a.config.RequestTimeout)
+	case ctx.Err() != nil:
+		return 0, ""
+	default:
+		return http.StatusBadGateway, fmt.Sprintf("智能体处理失败: %v", err)
+	}
+}
+
+// recordMessage 记录一轮对话并刷新会话的闲置时间
+func (a *apiServer) recordMessage(as *apiSession, message, answer string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	as.lastUsed = time.Now()
+	as.messages = append(as.messages, exchange{Time: as.lastUsed, Question: message, Answer: answer})
+}
+
+// sseHeartbeatInterval 流式响应的心跳间隔
+const sseHeartbeatInterval = 15 * time.Second
+
+// sseWriter 写入 Server-Sent Events，事件和心跳来自不同的 goroutine
+type sseWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// send 写入一个事件，事件名为事件类型，数据为 JSON
+func (e *sseWriter) send(event AgentEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event.Type, data)
+	e.flusher.Flush()
+}
+
+// comment 写入注释行
+func (e *sseWriter) comment(text string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(e.w, ": %s\n\n", text)
+	e.flusher.Flush()
+}
+
+// acceptsEventStream 判断客户端是否请求 Server-Sent Events
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept)); mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupSession 查找未过期的会话，找不到时写入 404
+func (a *apiServer) lookupSession(w http.ResponseWriter, id string) (*apiSession, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sweepLocked(time.Now())
+	as, ok := a.sessions[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("会话 %s 不存在或已过期", id))
+		return nil, false
+	}
+	return as, true
+}
+
+// sweepLocked 删除闲置过期的会话，调用方需持有 a.mu
+func (a *apiServer) sweepLocked(now time.Time) {
+	for id, as := range a.sessions {
+		if now.Sub(as.lastUsed) > a.config.SessionTTL {
+			delete(a.sessions, id)
+		}
+	}
+}
+
+// infoLocked 返回会话信息，调用方需持有 a.mu
+func (a *apiServer) infoLocked(as *apiSession) SessionInfo {
+	return SessionInfo{
+		ID:        as.id,
+		PatientID: as.patientID,
+		CreatedAt: as.createdAt,
+		ExpiresAt: as.lastUsed.Add(a.config.SessionTTL),
+		Messages:  append([]exchange{}, as.messages...),
+	}
+}
+
+// lookupPatient 读取患者档案，找不到时写入 404
+func (a *apiServer) lookupPatient(w http.ResponseWriter, id string) (*PatientProfile, bool) {
+	if a.patients == nil {
+		writeError(w, http.StatusBadRequest, "未配置患者库")
+		return nil, false
+	}
+	profile, err := a.patients.GetPatient(id)
+	if errors.Is(err, errPatientNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return profile, true
+}
+
+// newSessionID 生成随机会话编号
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成会话编号失败: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// decodeJSON 解析 JSON 请求体，失败时写入错误响应并返回 false；allowEmpty 为 true 时允许空请求体
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any, allowEmpty bool) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if errors.Is(err, io.EOF) && allowEmpty {
+		return true
+	}
+	if err != nil {
+		writeBodyError(w, err)
+		return false
+	}
+	return true
+}
+
+// writeBodyError 写入读取请求体失败的错误响应
+func writeBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("请求体超过 %d 字节", tooLarge.Limit))
+		return
+	}
+	writeError(w, http.StatusBadRequest, fmt.Sprintf("请求格式错误: %v", err))
+}
+
+// writeJSON 写入 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// writeError 写入错误响应
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"testing"
 )
 
@@ -202,6 +203,10 @@ C反应蛋白 1.5 mg/L (参考范围: <3.0)
 
 // 如果直接运行此文件，则执行手动测试
 func init() {
+	// MCP 模式下标准输出只能写协议消息
+	if len(os.Args) > 1 && os.Args[1] == "mcp" {
+		return
+	}
 	// 检查是否在测试环境中
 	if len(fmt.Sprintf("")) == 0 { // 这是一个技巧来检测非测试环境
 		// 在非测试环境中运行手动测试
@@ -1,9 +1,31 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/peterh/liner"
+	"github.com/tmc/langchaingo/agents"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/fake"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/tools"
+	"github.com/tmc/langchaingo/vectorstores"
 )
 
 func runTestsMain() {
@@ -18,7 +40,64 @@ func runTests() {
 	// 1. 测试化验单分析工具
 	testGoutAnalyzer()
 	
-	// 2. 测试医学知识库
+	// 2. 测试默认参考范围
+	testReferenceRanges()
+
+	// 3. 测试单位解析
+	testUnitGrammar()
+
+	// 4. 测试检测项目识别
+	testAnalyteCatalog()
+
+	// 5. 测试痛风分类评分
+	testGoutClassification()
+
+	// 6. 测试风险评估规则
+	testRiskRules()
+
+	// 7. 测试血尿酸趋势
+	testUrateTrend()
+
+	// 8. 测试患者库
+	testPatientStore()
+
+	// 9. 测试交互模式输入
+	testInteractiveInput()
+
+	// 10. 测试模型配置
+	testLLMProviders()
+
+	// 11. 测试离线模式
+	testOfflineMode()
+
+	// 12. 测试会话录制与回放
+	testCassette()
+
+	// 13. 测试 HTTP 接口
+	testAPIServer()
+
+	// 14. 测试流式输出
+	testStreaming()
+
+	// 15. 测试 MCP 工具服务
+	testMCPServer()
+
+	// 16. 测试知识库数据文件
+	testKnowledgeData()
+
+	// 17. 测试知识检索排序
+	testKnowledgeSearch()
+
+	// 18. 测试英文和拼音查询
+	testKnowledgeAliases()
+
+	// 19. 测试按小节查询
+	testKnowledgeSections()
+
+	// 20. 测试临床指南检索
+	testGuidelines()
+
+	// 21. 测试医学知识库
 	testMedicalKnowledge()
 	
 	fmt.Println("\n🎉 所有测试完成！")
@@ -56,10 +135,38 @@ C反应蛋白 25.6 mg/L (参考范围: <3.0)
 				analysis.UricAcidLevel.Status)
 		}
 		fmt.Printf("   💡 建议数量: %d 条\n", len(analysis.Recommendations))
+
+		fired := []string{}
+		for _, rule := range analysis.RuleTrace {
+			fired = append(fired, rule.Rule)
+		}
+		want := "uric_acid_high,uric_acid_marked,inflammation_present,kidney_impaired,risk_high,lifestyle_advice,kidney_advice"
+		if got := strings.Join(fired, ","); got != want {
+			fmt.Printf("❌ 规则追踪: %s (期望 %s)\n", got, want)
+		} else {
+			fmt.Printf("✅ 规则追踪: %s\n", got)
+		}
+
+		// 依据其他规则的风险分级记录沿用被引用规则的化验结果和阈值
+		for _, rule := range analysis.RuleTrace {
+			if rule.Rule != "risk_high" {
+				continue
+			}
+			var analytes []string
+			for _, input := range rule.Inputs {
+				analytes = append(analytes, input.AnalyteID)
+			}
+			if len(rule.Inputs) < 3 || !slices.Contains(analytes, analyteUricAcid) || !slices.Contains(analytes, analyteCreatinine) ||
+				rule.Threshold == "" || rule.Observed == "" {
+				fmt.Printf("❌ risk_high 记录缺少依据: %+v\n", rule)
+			} else {
+				fmt.Printf("✅ risk_high 依据: %s（%s）\n", rule.Observed, rule.Threshold)
+			}
+		}
 	} else {
 		fmt.Printf("⚠️  解析结果格式异常: %v\n", err)
 	}
-	
+
 	// 正常值测试
 	fmt.Println("\n📋 正常值测试:")
 	normalData := `尿酸 320 umol/L (参考范围: 208-428)
@@ -78,10 +185,2282 @@ C反应蛋白 2.1 mg/L (参考范围: <3.0)
 		fmt.Printf("   🔍 风险等级: %s\n", normalAnalysis.RiskLevel)
 		fmt.Printf("   📊 需要随访: %v\n", normalAnalysis.FollowUpNeeded)
 	}
+
+	// 单位换算测试
+	fmt.Println("\n📋 mg/dL 单位换算测试:")
+	mgdlData := `尿酸 7.8 mg/dL (3.5-7.2)
+肌酐 1.2 mg/dL (0.6-1.2)`
+
+	mgdlResult, err := analyzer.Call(context.Background(), mgdlData)
+	if err != nil {
+		fmt.Printf("❌ 分析失败: %v\n", err)
+		return
+	}
+
+	var mgdlAnalysis GoutAnalysisResult
+	if err := json.Unmarshal([]byte(mgdlResult), &mgdlAnalysis); err == nil && mgdlAnalysis.UricAcidLevel != nil {
+		ua := mgdlAnalysis.UricAcidLevel
+		if ua.Unit == "μmol/L" && ua.Value > 460 && ua.Status == "偏高" {
+			fmt.Printf("✅ 换算正确: %.1f %s → %.1f %s (%s)\n", ua.OriginalValue, ua.OriginalUnit, ua.Value, ua.Unit, ua.Status)
+		} else {
+			fmt.Printf("❌ 换算异常: %.1f %s (%s)\n", ua.Value, ua.Unit, ua.Status)
+		}
+	} else {
+		fmt.Printf("❌ 未识别到尿酸结果\n")
+	}
+
+	// 无尿酸数据时不应给出风险结论
+	fmt.Println("\n📋 未识别到尿酸测试:")
+	emptyResult, err := analyzer.Call(context.Background(), "无效的化验单数据\n谷丙转氨酶 30 U/L")
+	if err != nil {
+		fmt.Printf("❌ 分析失败: %v\n", err)
+		return
+	}
+
+	var emptyAnalysis GoutAnalysisResult
+	if err := json.Unmarshal([]byte(emptyResult), &emptyAnalysis); err == nil &&
+		emptyAnalysis.RiskLevel == riskUnassessable && len(emptyAnalysis.ParseReport.SkippedLines) == 2 {
+		fmt.Printf("✅ 风险等级: %s，跳过 %d 行，覆盖率 %.0f%%\n", emptyAnalysis.RiskLevel,
+			len(emptyAnalysis.ParseReport.SkippedLines), emptyAnalysis.ParseReport.Coverage*100)
+	} else {
+		fmt.Printf("❌ 未正确处理无尿酸输入: %s\n", emptyResult)
+	}
+
+	strict := GoutLabAnalyzer{RequireUricAcid: true}
+	if _, err := strict.Call(context.Background(), "无效的化验单数据"); err != nil {
+		fmt.Printf("✅ 严格模式返回错误: %v\n", err)
+	} else {
+		fmt.Printf("❌ 严格模式未返回错误\n")
+	}
+
+	// 单位无法识别的结果不影响同一项目的有效结果
+	for _, input := range []string{"尿酸 520 xyz\n尿酸 520 umol/L", "尿酸 520 umol/L\n尿酸 520 xyz"} {
+		mixed, err := analyzer.Analyze(input)
+		if err != nil || mixed.UricAcidLevel == nil || mixed.UricAcidLevel.Value != 520 || mixed.RiskLevel == riskUnassessable ||
+			len(mixed.UnscoredResults) != 1 || len(mixed.ParseReport.SkippedLines) != 1 || mixed.ParseReport.SkippedLines[0].Reason != skipUnknownUnit {
+			fmt.Printf("❌ 单位无法识别的重复项目影响了有效结果 %q: %v %+v\n", input, err, mixed)
+		} else {
+			fmt.Printf("✅ %q: 按有效结果评估为%s，单位无法识别的行列入未评估项目\n", strings.ReplaceAll(input, "\n", "；"), mixed.RiskLevel)
+		}
+	}
+
+	// 严格模式在保存化验历史之前返回错误
+	strictHistory := NewMemoryLabHistory()
+	strict = GoutLabAnalyzer{RequireUricAcid: true, History: strictHistory, PatientID: "P001"}
+	_, err = strict.Analyze("日期: 2024-01-10\n肌酐 95 umol/L\n日期: 2024-02-10\n肌酐 98 umol/L")
+	_, undatedErr := strict.Analyze("肌酐 95 umol/L")
+	if saved, _ := strictHistory.Reports("P001"); !errors.Is(err, errNoUricAcid) || !errors.Is(undatedErr, errNoUricAcid) || len(saved) != 0 {
+		fmt.Printf("❌ 严格模式仍保存了化验历史: %v %v %d\n", err, undatedErr, len(saved))
+	} else {
+		fmt.Println("✅ 严格模式未识别到血尿酸时不保存化验历史")
+	}
+
+	// eGFR 估算与 KDIGO 分期: 60岁男性，血肌酐 150 μmol/L，CKD-EPI 2021 约 46
+	fmt.Println("\n📋 eGFR 估算测试:")
+	renalResult, err := analyzer.Call(context.Background(), "性别: 男\n年龄: 60岁\n尿酸 520 umol/L\n肌酐 150 umol/L")
+	if err != nil {
+		fmt.Printf("❌ 分析失败: %v\n", err)
+		return
+	}
+
+	var renalAnalysis GoutAnalysisResult
+	if err := json.Unmarshal([]byte(renalResult), &renalAnalysis); err == nil && renalAnalysis.RenalAssessment != nil &&
+		renalAnalysis.RenalAssessment.Stage == "G3a" && renalAnalysis.RiskLevel == "中风险" {
+		fmt.Printf("✅ eGFR %.1f (%s)，KDIGO %s，风险等级 %s\n", *renalAnalysis.RenalAssessment.EGFR,
+			renalAnalysis.RenalAssessment.EGFRSource, renalAnalysis.RenalAssessment.Stage, renalAnalysis.RiskLevel)
+	} else {
+		fmt.Printf("❌ eGFR 估算异常: %s\n", renalResult)
+	}
+
+	// 提供体重时另给出 MDRD 和 Cockcroft-Gault: 70kg 时分别约 41.4 和 45.8
+	weighted, err := analyzer.Analyze("性别: 男\n年龄: 60岁\n体重: 70kg\n尿酸 520 umol/L\n肌酐 150 umol/L")
+	if err != nil || weighted.RenalAssessment == nil || weighted.RenalAssessment.MDRD != 41.41 || weighted.RenalAssessment.CockcroftGault != 45.84 ||
+		renalAnalysis.RenalAssessment == nil || renalAnalysis.RenalAssessment.MDRD != 0 || renalAnalysis.RenalAssessment.CockcroftGault != 0 {
+		fmt.Printf("❌ 提供体重时 MDRD/Cockcroft-Gault 不符: %v %+v\n", err, weighted)
+	} else {
+		fmt.Printf("✅ 提供体重时给出 MDRD %.2f、Cockcroft-Gault %.2f mL/min，未提供体重时不给出\n",
+			weighted.RenalAssessment.MDRD, weighted.RenalAssessment.CockcroftGault)
+	}
+
+	// 缺少性别和年龄时不估算 eGFR，只给出说明，输出中没有 egfr 和分期
+	unestimated, err := analyzer.Call(context.Background(), "尿酸 520 umol/L\n肌酐 150 umol/L")
+	var unestimatedAnalysis GoutAnalysisResult
+	json.Unmarshal([]byte(unestimated), &unestimatedAnalysis)
+	if renal := unestimatedAnalysis.RenalAssessment; err != nil || renal == nil || renal.EGFR != nil || renal.Stage != "" || len(renal.Notes) != 1 ||
+		strings.Contains(unestimated, `"egfr"`) || strings.Contains(unestimated, `"stage"`) {
+		fmt.Printf("❌ 无法估算时仍输出 eGFR: %s\n", unestimated)
+	} else {
+		fmt.Printf("✅ 无法估算 eGFR 时只给出说明: %s\n", renal.Notes[0])
+	}
+
+	// 性别相关阈值测试: 380 μmol/L 对女性已超过 360 的诊断标准
+	fmt.Println("\n📋 女性患者阈值测试:")
+	femaleData := `性别: 女
+年龄: 52岁
+尿酸 380 umol/L`
+
+	femaleResult, err := analyzer.Call(context.Background(), femaleData)
+	if err != nil {
+		fmt.Printf("❌ 分析失败: %v\n", err)
+		return
+	}
+
+	var femaleAnalysis GoutAnalysisResult
+	if err := json.Unmarshal([]byte(femaleResult), &femaleAnalysis); err == nil && femaleAnalysis.UricAcidLevel != nil {
+		ua := femaleAnalysis.UricAcidLevel
+		if femaleAnalysis.FollowUpNeeded && ua.ReferenceMax == 357 {
+			fmt.Printf("✅ 按女性标准评估: %.0f %s，参考范围 %.0f-%.0f\n", ua.Value, ua.Unit, ua.ReferenceMin, ua.ReferenceMax)
+		} else {
+			fmt.Printf("❌ 未按女性标准评估: 参考范围 %.0f-%.0f，需要随访 %v\n", ua.ReferenceMin, ua.ReferenceMax, femaleAnalysis.FollowUpNeeded)
+		}
+	} else {
+		fmt.Printf("❌ 未识别到尿酸结果\n")
+	}
+}
+
+func testReferenceRanges() {
+	fmt.Println("\n2️⃣ 测试默认参考范围")
+	fmt.Println("─────────────────────────────────")
+
+	registry := NewReferenceRangeRegistry(NewMedicalKnowledgeBase())
+	registry.SetSiteRange("示例医院", ReferenceRange{Analyte: analyteUricAcid, Sex: sexMale, Min: 200, Max: 420, Unit: "μmol/L"})
+
+	cases := []struct {
+		name    string
+		site    string
+		input   string
+		wantMax float64
+	}{
+		{"未提供性别", "", "尿酸 520 umol/L", 428},
+		{"男性", "", "性别: 男\n尿酸 520 umol/L", 428},
+		{"女性", "", "性别: 女\n尿酸 520 umol/L", 357},
+		{"机构覆盖", "示例医院", "性别: 男\n尿酸 520 umol/L", 420},
+	}
+
+	for _, c := range cases {
+		analyzer := GoutLabAnalyzer{ReferenceRanges: registry, Site: c.site}
+		result, err := analyzer.Call(context.Background(), c.input)
+		if err != nil {
+			fmt.Printf("❌ %s: 分析失败: %v\n", c.name, err)
+			continue
+		}
+
+		var analysis GoutAnalysisResult
+		if err := json.Unmarshal([]byte(result), &analysis); err != nil || analysis.UricAcidLevel == nil {
+			fmt.Printf("❌ %s: 未识别到尿酸结果\n", c.name)
+			continue
+		}
+		ua := analysis.UricAcidLevel
+		if ua.DefaultReference && ua.ReferenceMax == c.wantMax && ua.Status == "偏高" {
+			fmt.Printf("✅ %s: 参考范围 %.0f-%.0f (%s)\n", c.name, ua.ReferenceMin, ua.ReferenceMax, ua.ReferenceSource)
+		} else {
+			fmt.Printf("❌ %s: 参考上限 %.0f，期望 %.0f，状态 %s\n", c.name, ua.ReferenceMax, c.wantMax, ua.Status)
+		}
+	}
+
+	// 化验单中的检验机构行选择机构登记的范围，未登记的机构使用默认范围
+	lineCases := []struct {
+		name    string
+		input   string
+		wantMax float64
+	}{
+		{"检验机构行", "检验机构: 示例医院\n性别: 男\n尿酸 520 umol/L", 420},
+		{"单行输入的检验机构", "检验机构：示例医院；性别: 男；尿酸 520 umol/L", 420},
+		{"未登记的检验机构", "检验机构: 其他医院\n性别: 男\n尿酸 520 umol/L", 428},
+	}
+	for _, c := range lineCases {
+		result, err := GoutLabAnalyzer{ReferenceRanges: registry}.Analyze(c.input)
+		if err != nil || result.UricAcidLevel == nil || result.UricAcidLevel.ReferenceMax != c.wantMax || result.ParseReport.TotalLines != 1 {
+			fmt.Printf("❌ %s: 参考范围不符: %v %+v\n", c.name, err, result)
+		} else {
+			fmt.Printf("✅ %s: 参考上限 %.0f\n", c.name, result.UricAcidLevel.ReferenceMax)
+		}
+	}
+
+	// 血尿酸趋势工具同样按检验机构行选择参考范围，保存的化验结果不含检验机构行
+	trendHistory := NewMemoryLabHistory()
+	trendAnalyzer := GoutLabAnalyzer{ReferenceRanges: registry, Patient: PatientContext{Sex: sexMale}, History: trendHistory, PatientID: "P009"}
+	UrateTrendTool{LabAnalyzer: trendAnalyzer}.Call(context.Background(), "检验机构: 示例医院\n日期: 2024-01-10\n尿酸 520 umol/L")
+	trendReports, _ := trendHistory.Reports("P009")
+	if len(trendReports) != 1 || len(trendReports[0].Results) != 1 || trendReports[0].Results[0].ReferenceMax != 420 {
+		fmt.Printf("❌ 血尿酸趋势工具未按检验机构选择参考范围: %+v\n", trendReports)
+	} else {
+		fmt.Printf("✅ 血尿酸趋势工具按检验机构行保存: 参考上限 %.0f\n", trendReports[0].Results[0].ReferenceMax)
+	}
+
+	// LoadSiteRanges 读取 JSON 登记机构参考范围，缺少 analyte 或格式错误时报错
+	loaded := NewReferenceRangeRegistry(NewMedicalKnowledgeBase())
+	err := loaded.LoadSiteRanges(strings.NewReader(`{"测试医院": [{"analyte": "uric_acid", "min": 150, "max": 400, "unit": "μmol/L"}]}`))
+	ref, ok := loaded.Lookup(analyteUricAcid, PatientContext{Sex: sexMale}, "测试医院")
+	missingAnalyte := NewReferenceRangeRegistry(NewMedicalKnowledgeBase()).LoadSiteRanges(strings.NewReader(`{"测试医院": [{"min": 150, "max": 400}]}`))
+	badJSON := NewReferenceRangeRegistry(NewMedicalKnowledgeBase()).LoadSiteRanges(strings.NewReader(`{"测试医院": {}}`))
+	if err != nil || !ok || ref.Max != 400 || ref.Source != "检验机构: 测试医院" || missingAnalyte == nil || badJSON == nil {
+		fmt.Printf("❌ LoadSiteRanges 不符: %v %+v %v %v\n", err, ref, missingAnalyte, badJSON)
+	} else {
+		fmt.Printf("✅ LoadSiteRanges 登记机构范围 %.0f-%.0f，无效数据报错\n", ref.Min, ref.Max)
+	}
+
+	// 各运行模式通过 loadKnowledgeBase 读取 GOUT_SITE_RANGES，REST 和 MCP 请求以 site 字段选择机构
+	dir, err := os.MkdirTemp("", "gout-sites")
+	if err != nil {
+		fmt.Printf("❌ 创建临时目录失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sites.json")
+	os.WriteFile(path, []byte(`{"测试医院": [{"analyte": "uric_acid", "min": 150, "max": 400, "unit": "μmol/L"}]}`), 0o644)
+	previous, hadPrevious := os.LookupEnv(siteRangesEnv)
+	os.Setenv(siteRangesEnv, path)
+	kb, err := loadKnowledgeBase()
+	os.Setenv(siteRangesEnv, filepath.Join(dir, "missing.json"))
+	_, missingErr := loadKnowledgeBase()
+	if hadPrevious {
+		os.Setenv(siteRangesEnv, previous)
+	} else {
+		os.Unsetenv(siteRangesEnv)
+	}
+	if err != nil || missingErr == nil {
+		fmt.Printf("❌ 未按 GOUT_SITE_RANGES 加载机构参考范围: %v %v\n", err, missingErr)
+		return
+	}
+	if ref, _ := defaultReferenceRegistry().Lookup(analyteUricAcid, PatientContext{}, "测试医院"); ref.Max == 400 {
+		fmt.Println("❌ 机构参考范围写入了内置知识库的共享登记表")
+	}
+
+	api := httptest.NewServer(newAPIServer(NewScriptedLLM(), nil, nil, kb, nil, apiConfig{}).handler())
+	defer api.Close()
+	var rest GoutAnalysisResult
+	code := apiRequest(api.URL+"/v1/analyze", "POST", "application/json", `{"report": "尿酸 520 umol/L", "site": "测试医院"}`, &rest)
+	var plain GoutAnalysisResult
+	plainCode := apiRequest(api.URL+"/v1/analyze?site="+url.QueryEscape("测试医院"), "POST", "text/plain", "尿酸 520 umol/L", &plain)
+
+	mcp, err := newMCPServer(nil, kb, nil)
+	if err != nil {
+		fmt.Printf("❌ 创建 MCP 服务失败: %v\n", err)
+		return
+	}
+	viaMCP, _ := mcp.analyze(AnalyzeRequest{Report: "尿酸 520 umol/L", Site: "测试医院"}).StructuredContent.(*GoutAnalysisResult)
+
+	if code != 200 || rest.UricAcidLevel == nil || rest.UricAcidLevel.ReferenceMax != 400 ||
+		plainCode != 200 || plain.UricAcidLevel == nil || plain.UricAcidLevel.ReferenceMax != 400 ||
+		viaMCP == nil || viaMCP.UricAcidLevel == nil || viaMCP.UricAcidLevel.ReferenceMax != 400 {
+		fmt.Printf("❌ site 字段未选择机构参考范围: %d %+v %d %+v %+v\n", code, rest.UricAcidLevel, plainCode, plain.UricAcidLevel, viaMCP)
+	} else {
+		fmt.Println("✅ 按 GOUT_SITE_RANGES 加载机构参考范围，REST 和 MCP 的 site 字段选择机构，文件不存在时报错")
+	}
+}
+
+// unitCorpus 单位解析语料，覆盖 medical_knowledge.go 中出现的全部单位及常见变体
+var unitCorpus = []struct {
+	input string
+	want  string
+}{
+	{"μmol/L", "μmol/L"},
+	{"µmol/L", "μmol/L"},
+	{"umol/L", "umol/L"},
+	{"μmol/L/48h", "μmol/L/48h"},
+	{"mg/dL", "mg/dL"},
+	{"mg/dl", "mg/dL"},
+	{"mg/L", "mg/L"},
+	{"mmol/L", "mmol/L"},
+	{"mm/h", "mm/h"},
+	{"%", "%"},
+	{"ml", "mL"},
+	{"ml/min", "mL/min"},
+	{"ml/min/1.73m²", "mL/min/1.73m²"},
+	{"mL/min/1.73m2", "mL/min/1.73m²"},
+	{"×10⁹/L", "×10⁹/L"},
+	{"x10^9/L", "×10⁹/L"},
+	{"10^9/L", "×10⁹/L"},
+	{"10*9/L", "×10⁹/L"},
+	{"×10E9/L", "×10⁹/L"},
+	{"mmol/24h", "mmol/24h"},
+}
+
+func testUnitGrammar() {
+	fmt.Println("\n3️⃣ 测试单位解析")
+	fmt.Println("─────────────────────────────────")
+
+	failed := 0
+	for _, c := range unitCorpus {
+		got, rest, ok := parseUnit(c.input + " (参考范围: 1-2)")
+		if !ok || got != c.want || !strings.HasPrefix(strings.TrimSpace(rest), "(") {
+			fmt.Printf("❌ %q → %q (期望 %q)\n", c.input, got, c.want)
+			failed++
+		}
+	}
+	if failed == 0 {
+		fmt.Printf("✅ %d 个单位全部解析正确\n", len(unitCorpus))
+	}
+
+	// 完整化验行: 白细胞与 eGFR 此前会被丢弃
+	analyzer := GoutLabAnalyzer{}
+	result, err := analyzer.Call(context.Background(), `白细胞 12.5 ×10⁹/L (参考范围: 4.0-10.0)
+eGFR 55 ml/min/1.73m² (>90)`)
+	if err != nil {
+		fmt.Printf("❌ 分析失败: %v\n", err)
+		return
+	}
+
+	var analysis GoutAnalysisResult
+	if err := json.Unmarshal([]byte(result), &analysis); err == nil &&
+		len(analysis.InflammatoryMarkers) == 1 && len(analysis.KidneyFunction) == 1 {
+		fmt.Printf("✅ 复合单位化验行解析成功: %s, %s\n",
+			analysis.InflammatoryMarkers[0].Unit, analysis.KidneyFunction[0].Unit)
+	} else {
+		fmt.Printf("❌ 复合单位化验行解析失败: %s\n", result)
+	}
+}
+
+func testAnalyteCatalog() {
+	fmt.Println("\n4️⃣ 测试检测项目识别")
+	fmt.Println("─────────────────────────────────")
+
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"尿酸", analyteUricAcid},
+		{"血尿酸(SUA)", analyteUricAcid},
+		{"Serum Uric Acid", analyteUricAcid},
+		{"尿尿酸", analyteUrineUricAcid},
+		{"尿酸碱度", analyteUrinePH},
+		{"尿素", analyteUrea},
+		{"血尿素氮", analyteBUN},
+		{"Scr", analyteCreatinine},
+		{"CRP", analyteCRP},
+		{"hs-CRP", analyteHsCRP},
+		{"ESR", analyteESR},
+		{"WBC", analyteWBC},
+		{"NEUT%", analyteNeutrophilPct},
+		{"24h尿尿酸", analyteUrineUricAcid24},
+		{"尿酸(24小时尿)", analyteUrineUricAcid24},
+		{"尿肌酐", analyteUrineCreatinine},
+		{"尿白细胞", ""},
+		{"谷丙转氨酶", ""},
+	}
+
+	failed := 0
+	for _, c := range cases {
+		if got := classifyAnalyte(c.name); got != c.want {
+			fmt.Printf("❌ %s → %q (期望 %q)\n", c.name, got, c.want)
+			failed++
+		}
+	}
+	if failed == 0 {
+		fmt.Printf("✅ %d 个项目名称全部识别正确\n", len(cases))
+	}
+
+	// 尿酸排泄分析
+	analyzer := GoutLabAnalyzer{}
+	result, err := analyzer.Call(context.Background(), `血尿酸 520 umol/L
+血肌酐 80 umol/L
+尿尿酸 2000 umol/L
+尿肌酐 8000 umol/L
+24h尿尿酸 450 mg/24h`)
+	if err != nil {
+		fmt.Printf("❌ 分析失败: %v\n", err)
+		return
+	}
+
+	var analysis GoutAnalysisResult
+	if err := json.Unmarshal([]byte(result), &analysis); err == nil && analysis.UrateExcretion != nil &&
+		analysis.UrateExcretion.Type == excretionUnderExcretion {
+		fmt.Printf("✅ 尿酸排泄分析: FEUA %.2f%%，24h尿尿酸 %.0f mg，%s\n", analysis.UrateExcretion.FEUA,
+			analysis.UrateExcretion.UrinaryUrate24hMg, analysis.UrateExcretion.Type)
+	} else {
+		fmt.Printf("❌ 尿酸排泄分析异常: %s\n", result)
+	}
+}
+
+func testGoutClassification() {
+	fmt.Println("\n5️⃣ 测试痛风分类评分")
+	fmt.Println("─────────────────────────────────")
+
+	classifier := GoutClassifier{}
+	cases := []struct {
+		name      string
+		input     string
+		wantScore int
+		wantGout  bool
+	}{
+		{"典型第一跖趾关节发作", `{"entry_criterion": true, "joint_pattern": "first_mtp", "erythema": true, "cannot_bear_touch": true, "typical_episodes": 2, "lab_report": "尿酸 520 umol/L"}`, 9, true},
+		{"mg/dL 化验单", `{"entry_criterion": true, "joint_pattern": "ankle_midfoot", "typical_episodes": 1, "lab_report": "尿酸 10.5 mg/dL"}`, 6, false},
+		{"血尿酸偏低且滑液阴性", `{"entry_criterion": true, "joint_pattern": "first_mtp", "erythema": true, "serum_urate": 200, "synovial_fluid": "msu_negative"}`, -3, false},
+		{"影像学尿酸盐沉积", `{"entry_criterion": true, "imaging_urate_deposition": true, "tophus": true}`, 8, true},
+		{"充分标准", `{"entry_criterion": true, "msu_in_symptomatic_joint": true}`, 0, true},
+		{"不满足准入标准", `{"entry_criterion": false, "tophus": true}`, 0, false},
+	}
+
+	for _, c := range cases {
+		output, err := classifier.Call(context.Background(), c.input)
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", c.name, err)
+			continue
+		}
+		var result ClassificationResult
+		if err := json.Unmarshal([]byte(output), &result); err != nil {
+			fmt.Printf("❌ %s: 无法解析输出: %v\n", c.name, err)
+			continue
+		}
+		if result.TotalScore != c.wantScore || result.ClassifiedAsGout != c.wantGout {
+			fmt.Printf("❌ %s: 得分 %d、分类 %v (期望 %d、%v)\n", c.name, result.TotalScore, result.ClassifiedAsGout, c.wantScore, c.wantGout)
+			continue
+		}
+		fmt.Printf("✅ %s: 得分 %d\n", c.name, result.TotalScore)
+	}
+
+	// 血尿酸区间按 mg/dL 界值划分：358 μmol/L 为 6.02 mg/dL，237 μmol/L 为 3.98 mg/dL，6 mg/dL 恰为界值
+	bands := []struct {
+		urate float64
+		want  int
+	}{
+		{358, 2}, {356, 0}, {237, -4}, {238, 0}, {6 * 59.48, 2}, {10 * 59.48, 4}, {594, 3},
+	}
+	bandOK := true
+	for _, b := range bands {
+		if finding, points := urateBand(b.urate); points != b.want {
+			fmt.Printf("❌ 血尿酸 %.2f μmol/L 得分 %d (期望 %d): %s\n", b.urate, points, b.want, finding)
+			bandOK = false
+		}
+	}
+	if bandOK {
+		finding, _ := urateBand(358)
+		fmt.Printf("✅ 血尿酸区间按 mg/dL 界值划分: %s\n", finding)
+	}
+
+	if output, _ := classifier.Call(context.Background(), "第一跖趾关节红肿"); !strings.Contains(output, "解析临床资料时出错") {
+		fmt.Printf("❌ 非 JSON 输入未提示格式错误: %s\n", output)
+	} else {
+		fmt.Println("✅ 非 JSON 输入提示格式错误")
+	}
+}
+
+func testRiskRules() {
+	fmt.Println("\n6️⃣ 测试风险评估规则")
+	fmt.Println("─────────────────────────────────")
+
+	// 内置规则样例
+	fixtures, err := loadRuleFixtures("")
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	analyzer := GoutLabAnalyzer{}
+	failed := 0
+	for _, fixture := range fixtures {
+		if problems := runRuleFixture(analyzer, fixture); len(problems) > 0 {
+			fmt.Printf("❌ %s: %s\n", fixture.Name, strings.Join(problems, "; "))
+			failed++
+		}
+	}
+	if failed == 0 {
+		fmt.Printf("✅ %d 个规则样例全部通过\n", len(fixtures))
+	}
+
+	// 规则校验
+	invalid := []struct {
+		name string
+		json string
+	}{
+		{"未知字段", `{"version": "1", "recommendations": {}, "rules": [], "extra": 1}`},
+		{"引用未定义的规则", `{"version": "1", "recommendations": {}, "rules": [
+			{"id": "a", "description": "a", "when": {"flag": "b"}},
+			{"id": "b", "description": "b", "group": "risk", "risk_level": "低风险"}]}`},
+		{"未知检测项目", `{"version": "1", "recommendations": {}, "rules": [
+			{"id": "a", "description": "a", "when": {"analyte": "ldl", "op": ">", "value": 3}},
+			{"id": "b", "description": "b", "group": "risk", "risk_level": "低风险"}]}`},
+		{"风险等级无兜底规则", `{"version": "1", "recommendations": {}, "rules": [
+			{"id": "a", "description": "a", "group": "risk", "risk_level": "高风险", "when": {"analyte": "uric_acid", "op": "present"}}]}`},
+	}
+	for _, c := range invalid {
+		if _, err := ParseRuleSet([]byte(c.json)); err != nil {
+			fmt.Printf("✅ %s: %v\n", c.name, err)
+		} else {
+			fmt.Printf("❌ %s: 未报告错误\n", c.name)
+		}
+	}
+
+	// 规则文件热加载
+	dir, err := os.MkdirTemp("", "gout-rules")
+	if err != nil {
+		fmt.Printf("❌ 创建临时目录失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.json")
+	if err := os.WriteFile(path, defaultRiskRulesJSON, 0o644); err != nil {
+		fmt.Printf("❌ 写入规则文件失败: %v\n", err)
+		return
+	}
+	engine, err := NewRuleEngine(path)
+	if err != nil {
+		fmt.Printf("❌ 加载规则文件失败: %v\n", err)
+		return
+	}
+
+	updated := strings.Replace(string(defaultRiskRulesJSON), `"version": "2019.1"`, `"version": "2019.2"`, 1)
+	os.WriteFile(path, []byte(updated), 0o644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if reloaded, err := engine.Reload(); err != nil || !reloaded || engine.RuleSet().Version != "2019.2" {
+		fmt.Printf("❌ 规则文件修改后未重新加载: %v\n", err)
+	} else {
+		fmt.Printf("✅ 规则文件修改后重新加载: 版本 %s\n", engine.RuleSet().Version)
+	}
+
+	os.WriteFile(path, []byte(`{"version": ""}`), 0o644)
+	later = later.Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if _, err := engine.Reload(); err == nil || engine.RuleSet().Version != "2019.2" {
+		fmt.Printf("❌ 无效规则文件未保留原有规则\n")
+	} else {
+		fmt.Printf("✅ 无效规则文件保留原有规则: %v\n", err)
+	}
+
+	// 各运行模式（含 example、demo 和 patient labs）都通过 loadRuleEngine 读取 GOUT_RULES_FILE
+	custom := filepath.Join(dir, "custom.json")
+	os.WriteFile(custom, []byte(strings.Replace(string(defaultRiskRulesJSON), `"version": "2019.1"`, `"version": "2019.5"`, 1)), 0o644)
+	previous, hadPrevious := os.LookupEnv(rulesFileEnv)
+	os.Setenv(rulesFileEnv, custom)
+	loaded, err := loadRuleEngine()
+	os.Setenv(rulesFileEnv, filepath.Join(dir, "missing.json"))
+	_, missingErr := loadRuleEngine()
+	if hadPrevious {
+		os.Setenv(rulesFileEnv, previous)
+	} else {
+		os.Unsetenv(rulesFileEnv)
+	}
+	if err != nil || loaded.RuleSet().Version != "2019.5" || missingErr == nil {
+		fmt.Printf("❌ 未按 GOUT_RULES_FILE 加载规则: %v %v\n", err, missingErr)
+	} else {
+		fmt.Println("✅ 按 GOUT_RULES_FILE 加载规则，文件不存在时报错")
+	}
+}
+
+func testUrateTrend() {
+	fmt.Println("\n7️⃣ 测试血尿酸趋势")
+	fmt.Println("─────────────────────────────────")
+
+	// 知识库中的治疗目标
+	targets := knowledgeUrateTargets(nil)
+	if targets.General != 360 || targets.Tophi != 300 {
+		fmt.Printf("❌ 治疗目标 %.0f/%.0f (期望 360/300)\n", targets.General, targets.Tophi)
+	} else {
+		fmt.Printf("✅ 治疗目标 <%.0f μmol/L，有痛风石 <%.0f μmol/L\n", targets.General, targets.Tophi)
+	}
+
+	// 日期行拆分，各次化验保留原始行号
+	history := splitLabHistory("患者编号: P001\n日期: 2024-04-12\n尿酸 380 umol/L\n2024年1月10日\n尿酸 520 umol/L")
+	if history.PatientID != "P001" || len(history.Sections) != 2 ||
+		!strings.HasPrefix(history.Sections[0].Text, "\n\n\n\n尿酸 520") || !strings.Contains(history.latest(), "尿酸 380") {
+		fmt.Printf("❌ 化验日期拆分结果不符: %+v\n", history)
+	} else {
+		fmt.Println("✅ 按日期拆分多次化验并识别患者编号")
+	}
+
+	cases := []struct {
+		name           string
+		input          string
+		wantTarget     float64
+		wantInTarget   float64
+		wantMeaningful bool
+	}{
+		{"降尿酸治疗后达标", "日期: 2024-01-01\n尿酸 480 umol/L\n日期: 2024-03-01\n尿酸 400 umol/L\n日期: 2024-05-01\n尿酸 280 umol/L", 360, 0.34, true},
+		{"有痛风石时目标更低", "痛风石: 有\n日期: 2024-01-01\n尿酸 340 umol/L\n日期: 2024-02-01\n尿酸 320 umol/L", 300, 0, false},
+		{"mg/dL 结果", "日期: 2024-01-01\n尿酸 5.5 mg/dL\n日期: 2024-02-01\n尿酸 5.0 mg/dL", 360, 1, false},
+	}
+	tool := UrateTrendTool{}
+	for _, c := range cases {
+		output, _ := tool.Call(context.Background(), c.input)
+		var trend UrateTrend
+		if err := json.Unmarshal([]byte(output), &trend); err != nil {
+			fmt.Printf("❌ %s: 无法解析输出: %s\n", c.name, output)
+			continue
+		}
+		if trend.Target != c.wantTarget || trend.TimeInTarget != c.wantInTarget || trend.MeaningfulChange != c.wantMeaningful {
+			fmt.Printf("❌ %s: 目标 %.0f、达标时间 %.2f、变化有意义 %v (期望 %.0f、%.2f、%v)\n", c.name,
+				trend.Target, trend.TimeInTarget, trend.MeaningfulChange, c.wantTarget, c.wantInTarget, c.wantMeaningful)
+			continue
+		}
+		fmt.Printf("✅ %s: 斜率 %.1f μmol/L/月，达标时间 %.0f%%\n", c.name, trend.SlopePerMonth, trend.TimeInTarget*100)
+	}
+
+	// 按患者编号累积历史，化验单分析使用最近一次结果并附带趋势
+	analyzer := GoutLabAnalyzer{History: NewMemoryLabHistory()}
+	analyzer.Call(context.Background(), "患者编号: P002\n日期: 2024-01-01\n尿酸 520 umol/L")
+	output, _ := analyzer.Call(context.Background(), "患者编号: P002\n日期: 2024-06-01\n尿酸 330 umol/L")
+	var analysis GoutAnalysisResult
+	json.Unmarshal([]byte(output), &analysis)
+	if analysis.UrateTrend == nil || len(analysis.UrateTrend.Points) != 2 || analysis.UricAcidLevel == nil || analysis.UricAcidLevel.Value != 330 {
+		fmt.Printf("❌ 化验历史未累积: %s\n", output)
+	} else {
+		fmt.Printf("✅ 化验历史按患者编号累积: %d 次结果，最近一次 %.0f μmol/L\n", len(analysis.UrateTrend.Points), analysis.UricAcidLevel.Value)
+	}
+
+	// 当前患者不含日期行的化验单记为 ReportDate 当天；未指定患者或没有化验结果时不保存
+	analyzer.PatientID = "P002"
+	analyzer.ReportDate = time.Date(2024, 9, 1, 20, 30, 0, 0, time.FixedZone("CST", 8*3600))
+	undated, err := analyzer.Analyze("尿酸 300 umol/L")
+	UrateTrendTool{LabAnalyzer: analyzer}.Call(context.Background(), "患者编号: P002")
+	analyzer.Analyze("性别: 男")
+	GoutLabAnalyzer{History: analyzer.History}.Analyze("尿酸 600 umol/L")
+	saved, _ := analyzer.History.Reports("P002")
+	unassigned, _ := analyzer.History.Reports("")
+	last := saved[len(saved)-1]
+	if err != nil || undated.UrateTrend == nil || len(undated.UrateTrend.Points) != 3 || len(saved) != 3 || len(unassigned) != 0 ||
+		last.Date.Format(reportDateLayout) != "2024-09-01" || len(last.Results) != 1 || last.Results[0].Value != 300 {
+		fmt.Printf("❌ 未注明日期的化验单保存不符: %v %+v %+v\n", err, saved, unassigned)
+	} else {
+		fmt.Printf("✅ 未注明日期的化验单记为 %s 保存到当前患者，共 %d 次结果\n", last.Date.Format(reportDateLayout), len(saved))
+	}
+
+	// 已绑定患者时拒绝化验单中其他患者的编号，既不保存也不读取该患者的历史
+	bound := GoutLabAnalyzer{History: NewMemoryLabHistory(), PatientID: "P001"}
+	bound.History.SaveReport("P002", DatedLabReport{Date: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)})
+	_, mismatchErr := bound.Analyze("患者编号: P002\n日期: 2024-01-10\n尿酸 520 umol/L")
+	trendOutput, _ := UrateTrendTool{LabAnalyzer: bound}.Call(context.Background(), "患者编号: P002")
+	_, sameErr := bound.Analyze("患者编号: P001\n日期: 2024-01-10\n尿酸 520 umol/L")
+	own, _ := bound.History.Reports("P001")
+	other, _ := bound.History.Reports("P002")
+	if mismatchErr == nil || !strings.Contains(trendOutput, "不一致") || sameErr != nil || len(own) != 1 || len(other) != 1 {
+		fmt.Printf("❌ 化验单中的患者编号覆盖了绑定的患者: %v %s %v %d %d\n", mismatchErr, trendOutput, sameErr, len(own), len(other))
+	} else {
+		fmt.Printf("✅ 拒绝其他患者的编号: %v\n", mismatchErr)
+	}
+
+	// 化验单中明确否认妊娠和痛风石时覆盖患者档案
+	profiled := GoutLabAnalyzer{Patient: PatientProfile{Age: 30, Pregnant: true, Tophi: true}.Context()}
+	kept, keptErr := profiled.Analyze("日期: 2024-01-10\n尿酸 380 umol/L")
+	denied, deniedErr := profiled.Analyze("妊娠: 否\n痛风石: 无\n日期: 2024-01-10\n尿酸 380 umol/L")
+	if keptErr != nil || deniedErr != nil || kept.UricAcidLevel.ReferenceMax != 357 || kept.UrateTrend.Target != 300 ||
+		denied.UricAcidLevel.ReferenceMax != 428 || denied.UrateTrend.Target != 360 || denied.Patient.IsPregnant() || denied.Patient.Tophi == nil {
+		fmt.Printf("❌ 化验单中的否定未覆盖患者档案: %v %v %+v %+v\n", keptErr, deniedErr, kept, denied)
+	} else {
+		fmt.Printf("✅ 化验单否认妊娠和痛风石时覆盖档案: 参考上限 %.0f→%.0f，目标 %.0f→%.0f\n",
+			kept.UricAcidLevel.ReferenceMax, denied.UricAcidLevel.ReferenceMax, kept.UrateTrend.Target, denied.UrateTrend.Target)
+	}
+}
+
+func testPatientStore() {
+	fmt.Println("\n8️⃣ 测试患者库")
+	fmt.Println("─────────────────────────────────")
+
+	dir, err := os.MkdirTemp("", "gout-patients")
+	if err != nil {
+		fmt.Printf("❌ 创建临时目录失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenPatientStore(filepath.Join(dir, "patients.db"))
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	defer store.Close()
+
+	// 新建、修改、读取档案
+	profile := PatientProfile{ID: "P001", Name: "张三", Sex: sexMale, Age: 45, Comorbidities: []string{"高血压"}}
+	if err := store.CreatePatient(profile); err != nil {
+		fmt.Printf("❌ 新建患者失败: %v\n", err)
+		return
+	}
+	if err := store.CreatePatient(profile); !errors.Is(err, errPatientExists) {
+		fmt.Printf("❌ 重复新建患者未报错: %v\n", err)
+	}
+	profile.Tophi = true
+	profile.Medications = []string{"别嘌醇300mg"}
+	store.UpdatePatient(profile)
+	store.AddFlare("P001", Flare{Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Joints: "右第一跖趾关节"})
+	if got, err := store.GetPatient("P001"); err != nil || !got.Tophi || len(got.Medications) != 1 || len(got.Flares) != 1 || got.Comorbidities[0] != "高血压" {
+		fmt.Printf("❌ 读取患者档案不符: %+v %v\n", got, err)
+	} else {
+		fmt.Println("✅ 患者档案新建、修改、读取正常")
+	}
+
+	// 化验单分析按当前患者保存化验结果，同一日期覆盖
+	if err := store.SetCurrentPatient("P001"); err != nil {
+		fmt.Printf("❌ 设置当前患者失败: %v\n", err)
+	}
+	analyzer := GoutLabAnalyzer{Patient: profile.Context(), History: store, PatientID: "P001"}
+	analyzer.Call(context.Background(), "日期: 2024-01-10\n尿酸 520 umol/L")
+	analyzer.Call(context.Background(), "日期: 2024-01-10\n尿酸 500 umol/L\n日期: 2024-04-12\n尿酸 280 umol/L")
+	if reports, _ := store.Reports("P001"); len(reports) != 2 || reports[0].Results[0].Value != 500 {
+		fmt.Printf("❌ 化验结果保存不符: %+v\n", reports)
+	} else {
+		fmt.Println("✅ 化验结果按日期保存，同一日期覆盖")
+	}
+
+	// 当前患者查询工具
+	output, _ := CurrentPatientTool{Store: store, PatientID: "P001"}.Call(context.Background(), "")
+	var summary PatientSummary
+	if err := json.Unmarshal([]byte(output), &summary); err != nil || summary.Patient.ID != "P001" ||
+		summary.UrateTrend == nil || summary.UrateTrend.Target != 300 || len(summary.ReportDates) != 2 {
+		fmt.Printf("❌ 当前患者查询结果不符: %s\n", output)
+	} else {
+		fmt.Printf("✅ 当前患者查询: %s，%d 次化验，治疗目标 <%.0f μmol/L\n", summary.Patient.ID, len(summary.ReportDates), summary.UrateTrend.Target)
+	}
+
+	// 删除患者同时删除化验记录并清除当前患者
+	store.DeletePatient("P001")
+	current, _ := store.CurrentPatient()
+	reports, _ := store.Reports("P001")
+	if _, err := store.GetPatient("P001"); !errors.Is(err, errPatientNotFound) || current != "" || len(reports) != 0 {
+		fmt.Printf("❌ 删除患者后仍有残留: 当前患者 %q，化验 %d 次\n", current, len(reports))
+	} else {
+		fmt.Println("✅ 删除患者同时删除化验记录")
+	}
+}
+
+// scriptedReader 按预设内容逐行返回输入，内容读完后返回 io.EOF
+type scriptedReader struct {
+	lines []string
+}
+
+func (r *scriptedReader) Prompt(string) (string, error) {
+	if len(r.lines) == 0 {
+		return "", io.EOF
+	}
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+	if line == "^C" {
+		return "", liner.ErrPromptAborted
+	}
+	return line, nil
+}
+
+// blockingLLM 一直等到请求被取消的模型，用于测试 Ctrl-C 取消分析
+type blockingLLM struct {
+	started chan struct{}
+}
+
+func (m blockingLLM) GenerateContent(ctx context.Context, _ []llms.MessageContent, _ ...llms.CallOption) (*llms.ContentResponse, error) {
+	close(m.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m blockingLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func testInteractiveInput() {
+	fmt.Println("\n9️⃣ 测试交互模式输入")
+	fmt.Println("─────────────────────────────────")
+
+	inputs := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"普通问题", []string{"痛风患者可以喝咖啡吗", "尿酸 520 umol/L"}, "痛风患者可以喝咖啡吗"},
+		{"粘贴化验单以空行结束", []string{"性别: 男", "尿酸 520 umol/L (参考范围: 208-428)", "肌酐 95 umol/L", "", "下一个问题"}, "性别: 男\n尿酸 520 umol/L (参考范围: 208-428)\n肌酐 95 umol/L"},
+		{"标题行后粘贴化验单", []string{"请分析以下化验单：", "尿酸 520 umol/L", ""}, "请分析以下化验单：\n尿酸 520 umol/L"},
+		{"分隔符输入块", []string{`"""`, "这是我的化验单", "", "尿酸 520 umol/L", `"""`}, "这是我的化验单\n\n尿酸 520 umol/L"},
+		{"粘贴到结尾", []string{"尿酸 520 umol/L", "肌酐 95 umol/L"}, "尿酸 520 umol/L\n肌酐 95 umol/L"},
+	}
+	for _, c := range inputs {
+		got, err := readInput(&scriptedReader{lines: c.lines})
+		if err != nil || got != c.want {
+			fmt.Printf("❌ %s: %q, %v (期望 %q)\n", c.name, got, err, c.want)
+			continue
+		}
+		fmt.Printf("✅ %s\n", c.name)
+	}
+	if _, err := readInput(&scriptedReader{lines: []string{"尿酸 520 umol/L", "^C"}}); !errors.Is(err, liner.ErrPromptAborted) {
+		fmt.Printf("❌ Ctrl-C 未放弃输入: %v\n", err)
+	} else {
+		fmt.Println("✅ 输入过程中 Ctrl-C 放弃本次输入")
+	}
+
+	// 斜杠命令
+	var out strings.Builder
+	s, err := newSession(fake.NewFakeLLM([]string{"AI: 血尿酸偏高，建议复查"}), nil, nil, nil, &out)
+	if err != nil {
+		fmt.Printf("❌ 创建会话失败: %v\n", err)
+		return
+	}
+	ctx := context.Background()
+	s.handle(ctx, "尿酸 520 umol/L")
+	dir, err := os.MkdirTemp("", "gout-session")
+	if err != nil {
+		fmt.Printf("❌ 创建临时目录失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	exportPath := filepath.Join(dir, "session.md")
+	s.handle(ctx, "/export "+exportPath)
+	if data, err := os.ReadFile(exportPath); err != nil || !strings.Contains(string(data), "血尿酸偏高，建议复查") {
+		fmt.Printf("❌ /export 未导出对话: %v\n%s\n", err, out.String())
+	} else {
+		fmt.Println("✅ /export 导出对话记录")
+	}
+	s.handle(ctx, "/reset")
+	if vars, _ := s.memory.LoadMemoryVariables(ctx, nil); vars["history"] != "" || len(s.history) != 0 {
+		fmt.Printf("❌ /reset 未清空对话记忆: %v\n", vars)
+	} else {
+		fmt.Println("✅ /reset 清空对话记忆")
+	}
+	out.Reset()
+	s.handle(ctx, "/unknown")
+	if !strings.Contains(out.String(), "未知命令") || !s.handle(ctx, "exit") {
+		fmt.Printf("❌ 未知命令或 exit 处理不符: %s\n", out.String())
+	} else {
+		fmt.Println("✅ 未知命令提示 /help，exit 退出")
+	}
+
+	// 分析过程中 Ctrl-C 只取消本次分析
+	started := make(chan struct{})
+	s, _ = newSession(blockingLLM{started: started}, nil, nil, nil, io.Discard)
+	go func() {
+		<-started
+		s.interrupt()
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.ask(ctx, "痛风是什么")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if errors.Is(err, errAnalysisCanceled) {
+			fmt.Println("✅ Ctrl-C 取消正在进行的分析")
+		} else {
+			fmt.Printf("❌ 取消分析返回 %v\n", err)
+		}
+	case <-time.After(5 * time.Second):
+		fmt.Println("❌ 取消分析超时")
+	}
+}
+
+// recordingLLM 记录调用参数和截止时间的模型
+type recordingLLM struct {
+	options     llms.CallOptions
+	hasDeadline bool
+}
+
+func (m *recordingLLM) GenerateContent(ctx context.Context, _ []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.options = llms.CallOptions{}
+	for _, opt := range options {
+		opt(&m.options)
+	}
+	_, m.hasDeadline = ctx.Deadline()
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "ok"}}}, nil
+}
+
+func (m *recordingLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func testLLMProviders() {
+	fmt.Println("\n🔟 测试模型配置")
+	fmt.Println("─────────────────────────────────")
+
+	// 清空相关环境变量，结束后恢复
+	envs := []string{llmConfigEnv, llmProviderEnv, llmModelEnv, llmBaseURLEnv, llmAPIKeyEnv,
+		llmTemperatureEnv, llmMaxTokensEnv, llmTimeoutEnv, "DASHSCOPE_API_KEY", "DEEPSEEK_API_KEY"}
+	for _, name := range envs {
+		if v, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, v)
+			os.Unsetenv(name)
+		}
+	}
+	defer func() {
+		for _, name := range envs {
+			os.Unsetenv(name)
+		}
+	}()
+
+	// 示例配置文件
+	settings, err := loadLLMSettings("llm.example.json")
+	if err != nil || settings.Provider != "dashscope" || len(settings.Providers) == 0 {
+		fmt.Printf("❌ 示例配置文件解析失败: %v\n", err)
+	} else {
+		fmt.Printf("✅ 示例配置文件包含 %d 个提供方\n", len(settings.Providers))
+	}
+
+	// 优先级: 命令行参数 > 环境变量 > 配置文件 > 内置配置
+	os.Setenv(llmConfigEnv, "llm.example.json")
+	_, cfg, err := resolveLLMConfig(nil)
+	if err != nil || cfg.Model != "qwen-max" || cfg.BaseURL != builtinProviders["dashscope"].BaseURL ||
+		cfg.Temperature == nil || *cfg.Temperature != 0.2 || time.Duration(cfg.Timeout) != 90*time.Second {
+		fmt.Printf("❌ 配置文件未覆盖内置配置: %+v %v\n", cfg, err)
+	} else {
+		fmt.Println("✅ 配置文件按字段覆盖内置配置")
+	}
+	os.Setenv(llmModelEnv, "qwen-turbo")
+	os.Setenv(llmTemperatureEnv, "0.5")
+	f, err := parseLLMFlags("test", []string{"-temperature", "0", "-max-tokens", "512"})
+	if err != nil {
+		fmt.Printf("❌ 解析命令行参数失败: %v\n", err)
+		return
+	}
+	name, cfg, err := resolveLLMConfig(f)
+	if err != nil || name != "dashscope" || cfg.Model != "qwen-turbo" || *cfg.Temperature != 0 || cfg.MaxTokens != 512 {
+		fmt.Printf("❌ 优先级不符: %s %+v %v\n", name, cfg, err)
+	} else {
+		fmt.Println("✅ 命令行参数 > 环境变量 > 配置文件 > 内置配置")
+	}
+	os.Unsetenv(llmModelEnv)
+	os.Unsetenv(llmTemperatureEnv)
+
+	// 配置文件中的自定义提供方
+	os.Setenv(llmProviderEnv, "deepseek")
+	if _, cfg, err := resolveLLMConfig(nil); err != nil || cfg.Type != backendOpenAI || cfg.Model != "deepseek-chat" {
+		fmt.Printf("❌ 自定义提供方解析不符: %+v %v\n", cfg, err)
+	} else if _, err := newLLM("deepseek", cfg); !errors.Is(err, errMissingAPIKey) || !strings.Contains(err.Error(), "DEEPSEEK_API_KEY") {
+		fmt.Printf("❌ 缺少密钥未提示环境变量: %v\n", err)
+	} else {
+		fmt.Println("✅ 自定义提供方缺少密钥时提示对应环境变量")
+	}
+	os.Setenv(llmProviderEnv, "vllm")
+	if _, cfg, err := resolveLLMConfig(nil); err != nil {
+		fmt.Printf("❌ 本地兼容接口配置错误: %v\n", err)
+	} else if _, err := newLLM("vllm", cfg); err != nil {
+		fmt.Printf("❌ 本地兼容接口不应要求密钥: %v\n", err)
+	} else {
+		fmt.Println("✅ 本地兼容接口无需密钥")
+	}
+	os.Unsetenv(llmProviderEnv)
+
+	// GOUT_LLM_API_KEY 只用于环境变量或配置文件选定的提供方，命令行改选的提供方不使用
+	os.Setenv(llmAPIKeyEnv, "sk-dashscope")
+	_, selected, _ := resolveLLMConfig(nil)
+	switched, _ := parseLLMFlags("test", []string{"-provider", "deepseek"})
+	_, other, _ := resolveLLMConfig(switched)
+	os.Setenv(llmProviderEnv, "deepseek")
+	_, paired, _ := resolveLLMConfig(switched)
+	os.Unsetenv(llmProviderEnv)
+	os.Unsetenv(llmAPIKeyEnv)
+	if selected.APIKey != "sk-dashscope" || other.APIKey != "" || paired.APIKey != "sk-dashscope" {
+		fmt.Printf("❌ GOUT_LLM_API_KEY 作用范围不符: %q %q %q\n", selected.APIKey, other.APIKey, paired.APIKey)
+	} else {
+		fmt.Println("✅ GOUT_LLM_API_KEY 只用于环境变量或配置文件选定的提供方")
+	}
+
+	// 错误配置
+	if _, _, err := setupLLM("test", []string{"-provider", "unknown"}); err == nil || !strings.Contains(err.Error(), "未知的模型提供方") {
+		fmt.Printf("❌ 未知提供方未报错: %v\n", err)
+	} else {
+		fmt.Println("✅ 未知提供方报错并列出可选项")
+	}
+	if _, _, err := setupLLM("test", []string{"-temperature", "3"}); err == nil || !strings.Contains(err.Error(), "temperature") {
+		fmt.Printf("❌ 采样温度越界未报错: %v\n", err)
+	} else {
+		fmt.Println("✅ 采样温度越界报错")
+	}
+
+	// 采样温度、最大 token 数和超时作用于每次调用，调用方参数优先
+	temperature := 0.3
+	stub := &recordingLLM{}
+	model := newConfiguredModel(stub, LLMConfig{Temperature: &temperature, MaxTokens: 256, Timeout: Duration(time.Minute)})
+	model.Call(context.Background(), "你好", llms.WithMaxTokens(64))
+	if stub.options.Temperature != 0.3 || stub.options.MaxTokens != 64 || !stub.hasDeadline {
+		fmt.Printf("❌ 调用参数不符: %+v 截止时间 %v\n", stub.options, stub.hasDeadline)
+	} else {
+		fmt.Println("✅ 配置的采样温度和超时作用于每次调用")
+	}
+}
+
+func testOfflineMode() {
+	fmt.Println("\n1️⃣1️⃣ 测试离线模式")
+	fmt.Println("─────────────────────────────────")
+
+	// 单行输入以分号分隔多项结果
+	output, _ := GoutLabAnalyzer{}.Call(context.Background(), "性别: 男；尿酸 520 umol/L (参考范围: 208-428)；肌酐 95 umol/L")
+	var single GoutAnalysisResult
+	if err := json.Unmarshal([]byte(output), &single); err != nil || single.UricAcidLevel == nil || len(single.KidneyFunction) == 0 || single.Patient == nil {
+		fmt.Printf("❌ 分号分隔的单行输入解析不符: %s\n", output)
+	} else {
+		fmt.Println("✅ 分号分隔的单行输入按多行解析")
+	}
+
+	llm, cfg, err := setupLLM("test", []string{"-offline"})
+	if err != nil || cfg.Type != backendOffline {
+		fmt.Printf("❌ 离线模式初始化失败: %v\n", err)
+		return
+	}
+	fmt.Println("✅ 离线模式无需 API 密钥")
+
+	// 完整运行执行器: 工具调用、对话记忆和最终答复
+	answer := func() (string, string, *session) {
+		s, err := newSession(llm, nil, nil, nil, io.Discard)
+		if err != nil {
+			fmt.Printf("❌ 创建会话失败: %v\n", err)
+			return "", "", nil
+		}
+		lab, err := s.ask(context.Background(), "请分析这份化验单：\n尿酸 520 umol/L (参考范围: 208-428)\nC反应蛋白 15.2 mg/L (参考范围: <3.0)\n肌酐 95 umol/L")
+		if err != nil {
+			fmt.Printf("❌ 化验单分析失败: %v\n", err)
+		}
+		knowledge, err := s.ask(context.Background(), "什么是痛风？")
+		if err != nil {
+			fmt.Printf("❌ 知识查询失败: %v\n", err)
+		}
+		return lab, knowledge, s
+	}
+	lab, knowledge, s := answer()
+	if s == nil {
+		return
+	}
+	if !strings.Contains(lab, offlinePrefix) || !strings.Contains(lab, "风险等级: 中风险") || !strings.Contains(lab, "C反应蛋白") {
+		fmt.Printf("❌ 离线化验单分析答复不符: %s\n", lab)
+	} else {
+		fmt.Println("✅ 化验单经 gout_lab_analyzer 分析后给出答复")
+	}
+	if !strings.Contains(knowledge, "痛风 (Gout)") {
+		fmt.Printf("❌ 离线知识查询答复不符: %s\n", knowledge)
+	} else {
+		fmt.Println("✅ 医学问题经 medical_knowledge_base 查询后给出答复")
+	}
+	if vars, _ := s.memory.LoadMemoryVariables(context.Background(), nil); !strings.Contains(fmt.Sprint(vars["history"]), "什么是痛风") {
+		fmt.Printf("❌ 对话记忆未保存: %v\n", vars)
+	} else {
+		fmt.Println("✅ 对话记忆保存离线问答")
+	}
+	if lab2, knowledge2, _ := answer(); lab2 != lab || knowledge2 != knowledge {
+		fmt.Println("❌ 离线模式输出不确定")
+	} else {
+		fmt.Println("✅ 相同输入得到相同输出")
+	}
+}
+
+func testCassette() {
+	fmt.Println("\n1️⃣2️⃣ 测试会话录制与回放")
+	fmt.Println("─────────────────────────────────")
+
+	dir, err := os.MkdirTemp("", "gout-cassette")
+	if err != nil {
+		fmt.Printf("❌ 创建临时目录失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.json")
+
+	// 用离线模型录制
+	ctx := context.Background()
+	s, err := newSession(NewScriptedLLM(), nil, nil, nil, io.Discard)
+	if err != nil {
+		fmt.Printf("❌ 创建会话失败: %v\n", err)
+		return
+	}
+	s.setRecorder(newCassetteRecording(path, "offline scripted"))
+	s.handle(ctx, "尿酸 520 umol/L\n肌酐 95 umol/L")
+	s.handle(ctx, "/reset")
+	s.handle(ctx, "什么是痛风？")
+	recorded, err := LoadCassette(path)
+	if err != nil || len(recorded.Interactions) != 3 || len(recorded.Interactions[0].Events) != 3 ||
+		recorded.Interactions[0].Events[1].Tool != "gout_lab_analyzer" || recorded.Interactions[0].Output == "" {
+		fmt.Printf("❌ 录音内容不符: %+v %v\n", recorded, err)
+		return
+	}
+	fmt.Println("✅ 录制提示词、模型输出、工具调用和 /reset 命令")
+
+	replay := func(c *Cassette) error {
+		s, err := newSession(nil, nil, nil, nil, io.Discard)
+		if err != nil {
+			return err
+		}
+		return replayCassette(ctx, s, c, io.Discard)
+	}
+	if err := replay(recorded); err != nil {
+		fmt.Printf("❌ 回放失败: %v\n", err)
+	} else {
+		fmt.Println("✅ 相同配置下回放一致")
+	}
+
+	// 提示词变化（如工具描述被修改）时回放失败
+	drifted, _ := LoadCassette(path)
+	drifted.Interactions[0].Events[0].Input = strings.Replace(drifted.Interactions[0].Events[0].Input, "痛风化验单分析工具", "化验单分析工具", 1)
+	if err := replay(drifted); !errors.Is(err, errCassetteDrift) || !strings.Contains(err.Error(), "输入不一致") {
+		fmt.Printf("❌ 提示词变化未被发现: %v\n", err)
+	} else {
+		fmt.Println("✅ 提示词变化时回放失败并指出差异行")
+	}
+
+	// 工具结果变化时回放失败
+	drifted, _ = LoadCassette(path)
+	drifted.Interactions[0].Events[1].Output = strings.Replace(drifted.Interactions[0].Events[1].Output, "偏高", "正常", 1)
+	if err := replay(drifted); !errors.Is(err, errCassetteDrift) || !strings.Contains(err.Error(), "结果不一致") {
+		fmt.Printf("❌ 工具结果变化未被发现: %v\n", err)
+	} else {
+		fmt.Println("✅ 工具结果变化时回放失败")
+	}
+
+	// 缺少 /reset 时后续提示中的对话历史不同
+	drifted, _ = LoadCassette(path)
+	drifted.Interactions = append(drifted.Interactions[:1], drifted.Interactions[2:]...)
+	if err := replay(drifted); !errors.Is(err, errCassetteDrift) {
+		fmt.Printf("❌ 对话历史变化未被发现: %v\n", err)
+	} else {
+		fmt.Println("✅ 对话历史变化时回放失败")
+	}
+
+	// 回放使用内存患者库：不修改患者库文件，录制后新增的化验不影响回放
+	dbPath := filepath.Join(dir, "patients.db")
+	store, err := OpenPatientStore(dbPath)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	defer store.Close()
+	store.CreatePatient(PatientProfile{ID: "P001", Sex: sexMale, Age: 50})
+	store.SaveReport("P001", DatedLabReport{Date: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), Results: []LabResult{{Parameter: "尿酸", AnalyteID: analyteUricAcid, Value: 520, Unit: "μmol/L"}}})
+	store.SetCurrentPatient("P001")
+	patientPath := filepath.Join(dir, "patient.json")
+	s, _ = newSession(NewScriptedLLM(), nil, nil, store, io.Discard)
+	recorder := newCassetteRecording(patientPath, "offline scripted")
+	recorder.cassette.Patient = "P001"
+	s.setRecorder(recorder)
+	s.handle(ctx, "日期: 2024-05-01\n尿酸 400 umol/L")
+	s.handle(ctx, "/patient P001")
+
+	// 录制后修正同一日期的结果、补录更晚的化验并切换当前患者
+	store.SaveReport("P001", DatedLabReport{Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Results: []LabResult{{Parameter: "尿酸", AnalyteID: analyteUricAcid, Value: 380, Unit: "μmol/L"}}})
+	store.SaveReport("P001", DatedLabReport{Date: time.Now().AddDate(0, 0, 7), Results: []LabResult{{Parameter: "尿酸", AnalyteID: analyteUricAcid, Value: 300, Unit: "μmol/L"}}})
+	store.CreatePatient(PatientProfile{ID: "P002"})
+	store.SetCurrentPatient("P002")
+
+	recorded, err = LoadCassette(patientPath)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	replayStore, err := replayPatientStore(dbPath, recorded)
+	if err != nil {
+		fmt.Printf("❌ 创建回放患者库失败: %v\n", err)
+		return
+	}
+	s, _ = newSession(nil, nil, nil, replayStore, io.Discard)
+	err = replayCassette(ctx, s, recorded, io.Discard)
+	replayStore.Close()
+	reports, _ := store.Reports("P001")
+	current, _ := store.CurrentPatient()
+	if err != nil || len(reports) != 3 || reports[1].Results[0].Value != 380 || current != "P002" {
+		fmt.Printf("❌ 回放修改了患者库或结果不一致: %v，化验 %d 次，当前患者 %s\n", err, len(reports), current)
+	} else {
+		fmt.Println("✅ 回放使用内存患者库，不修改患者库文件中的化验记录和当前患者")
+	}
+}
+
+// apiRequest 发送请求并解析 JSON 响应，返回状态码
+func apiRequest(url, method, contentType, body string, out any) int {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return 0
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func testAPIServer() {
+	fmt.Println("\n1️⃣3️⃣ 测试 HTTP 接口")
+	fmt.Println("─────────────────────────────────")
+
+	dir, err := os.MkdirTemp("", "gout-api")
+	if err != nil {
+		fmt.Printf("❌ 创建临时目录失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenPatientStore(filepath.Join(dir, "patients.db"))
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	defer store.Close()
+	store.CreatePatient(PatientProfile{ID: "P001", Sex: sexMale, Age: 50, Tophi: true})
+
+	api := newAPIServer(NewScriptedLLM(), nil, nil, nil, store, apiConfig{MaxBodyBytes: 4096})
+	server := httptest.NewServer(api.handler())
+	defer server.Close()
+
+	var doc struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if code := apiRequest(server.URL+"/openapi.json", "GET", "", "", &doc); code != 200 || doc.Paths["/v1/analyze"] == nil || doc.Paths["/v1/sessions/{id}/messages"] == nil {
+		fmt.Printf("❌ OpenAPI 文档不符: %d %v\n", code, doc)
+	} else {
+		fmt.Printf("✅ OpenAPI %s 文档列出 %d 个路径\n", doc.OpenAPI, len(doc.Paths))
+	}
+
+	// 化验单分析
+	var result GoutAnalysisResult
+	code := apiRequest(server.URL+"/v1/analyze", "POST", "application/json", `{"report": "尿酸 520 umol/L (参考范围: 208-428)\n肌酐 95 umol/L"}`, &result)
+	if code != 200 || result.UricAcidLevel == nil || result.RiskLevel == "" {
+		fmt.Printf("❌ JSON 化验单分析不符: %d %+v\n", code, result)
+	} else {
+		fmt.Printf("✅ JSON 化验单分析: %s\n", result.RiskLevel)
+	}
+	result = GoutAnalysisResult{}
+	code = apiRequest(server.URL+"/v1/analyze?patient_id=P001", "POST", "text/plain; charset=utf-8", "日期: 2024-01-10\n尿酸 420 umol/L", &result)
+	if code != 200 || result.UrateTrend == nil || result.UrateTrend.Target != 300 {
+		fmt.Printf("❌ 按患者分析化验单不符: %d %+v\n", code, result.UrateTrend)
+	} else {
+		fmt.Println("✅ text/plain 化验单结合患者档案分析并保存记录")
+	}
+	result = GoutAnalysisResult{}
+	code = apiRequest(server.URL+"/v1/analyze", "POST", "application/json", `{"report": "尿酸 380 umol/L", "patient_id": "P001"}`, &result)
+	reports, _ := store.Reports("P001")
+	if code != 200 || len(reports) != 2 || !reports[1].Date.Equal(reportDay(time.Now())) || result.UrateTrend == nil || len(result.UrateTrend.Points) != 2 {
+		fmt.Printf("❌ 未注明日期的化验单未按当天保存: %d %+v\n", code, reports)
+	} else {
+		fmt.Println("✅ 未注明日期的化验单按当天保存到患者化验历史")
+	}
+	var mismatch apiError
+	code = apiRequest(server.URL+"/v1/analyze?patient_id=P001", "POST", "text/plain", "患者编号: P003\n日期: 2024-01-10\n尿酸 520 umol/L", &mismatch)
+	if _, err := store.GetPatient("P003"); code != http.StatusUnprocessableEntity || !errors.Is(err, errPatientNotFound) {
+		fmt.Printf("❌ 化验单中的其他患者编号未被拒绝: %d %v\n", code, err)
+	} else {
+		fmt.Printf("✅ 化验单中的其他患者编号返回 422: %s\n", mismatch.Error)
+	}
+	var strictErr apiError
+	code = apiRequest(server.URL+"/v1/analyze", "POST", "application/json", `{"report": "日期: 2024-05-10\n肌酐 95 umol/L", "patient_id": "P001", "require_uric_acid": true}`, &strictErr)
+	plainCode := apiRequest(server.URL+"/v1/analyze?patient_id=P001&require_uric_acid=true", "POST", "text/plain", "日期: 2024-05-11\n肌酐 95 umol/L", nil)
+	badFlag := apiRequest(server.URL+"/v1/analyze?require_uric_acid=maybe", "POST", "text/plain", "尿酸 520 umol/L", nil)
+	mcp, _ := newMCPServer(nil, nil, store)
+	mcpResult := mcp.analyze(AnalyzeRequest{Report: "日期: 2024-05-12\n肌酐 95 umol/L", PatientID: "P001", RequireUricAcid: true})
+	if after, _ := store.Reports("P001"); code != http.StatusUnprocessableEntity || plainCode != http.StatusUnprocessableEntity ||
+		badFlag != http.StatusBadRequest || !mcpResult.IsError || len(after) != len(reports) {
+		fmt.Printf("❌ require_uric_acid 不符: %d %d %d %v %d\n", code, plainCode, badFlag, mcpResult.IsError, len(after))
+	} else {
+		fmt.Printf("✅ require_uric_acid 严格模式返回 422 (%s)，MCP 标记 isError，均不保存化验记录\n", strictErr.Error)
+	}
+	var apiErr apiError
+	if code := apiRequest(server.URL+"/v1/analyze", "POST", "text/plain", strings.Repeat("尿酸 520 umol/L\n", 500), &apiErr); code != http.StatusRequestEntityTooLarge {
+		fmt.Printf("❌ 超大请求体返回 %d: %s\n", code, apiErr.Error)
+	} else {
+		fmt.Println("✅ 超大请求体返回 413")
+	}
+	if code := apiRequest(server.URL+"/v1/analyze", "POST", "application/json", `{"report": "尿酸 520", "patient_id": "P404"}`, nil); code != http.StatusNotFound {
+		fmt.Printf("❌ 未知患者返回 %d\n", code)
+	} else {
+		fmt.Println("✅ 未知患者返回 404")
+	}
+
+	// 知识查询
+	var infos []MedicalInfo
+	if code := apiRequest(server.URL+"/v1/knowledge?q=痛风石", "GET", "", "", &infos); code != 200 || len(infos) == 0 {
+		fmt.Printf("❌ 知识查询不符: %d %v\n", code, infos)
+	} else {
+		fmt.Printf("✅ 知识查询返回 %d 条\n", len(infos))
+	}
+
+	// 对话会话
+	var info SessionInfo
+	if code := apiRequest(server.URL+"/v1/sessions", "POST", "application/json", `{"patient_id": "P001"}`, &info); code != http.StatusCreated || info.ID == "" {
+		fmt.Printf("❌ 创建会话失败: %d\n", code)
+		return
+	}
+	sessionURL := server.URL + "/v1/sessions/" + info.ID
+	var reply MessageResponse
+	code = apiRequest(sessionURL+"/messages", "POST", "application/json", `{"message": "什么是痛风？"}`, &reply)
+	apiRequest(sessionURL+"/messages", "POST", "application/json", `{"message": "痛风石怎么治疗？"}`, nil)
+	info = SessionInfo{}
+	apiRequest(sessionURL, "GET", "", "", &info)
+	if code != 200 || !strings.Contains(reply.Answer, "痛风 (Gout)") || len(info.Messages) != 2 || info.PatientID != "P001" {
+		fmt.Printf("❌ 会话对话不符: %d %+v %+v\n", code, reply, info)
+	} else {
+		fmt.Println("✅ 会话在服务端保存对话记录")
+	}
+	apiRequest(sessionURL, "DELETE", "", "", nil)
+	if code := apiRequest(sessionURL, "GET", "", "", nil); code != http.StatusNotFound {
+		fmt.Printf("❌ 删除后的会话返回 %d\n", code)
+	} else {
+		fmt.Println("✅ 删除会话")
+	}
+
+	// 会话的患者查询工具只返回创建会话时指定的患者，不使用命令行设置的当前患者，也不能查询其他患者
+	store.CreatePatient(PatientProfile{ID: "P002", Sex: sexFemale, Age: 62})
+	store.SetCurrentPatient("P001")
+	sessionPatient := func(body, input string) string {
+		var info SessionInfo
+		apiRequest(server.URL+"/v1/sessions", "POST", "application/json", body, &info)
+		api.mu.Lock()
+		as := api.sessions[info.ID]
+		api.mu.Unlock()
+		if as == nil {
+			return ""
+		}
+		for _, t := range as.session.executor.Agent.(*agents.ConversationalAgent).Tools {
+			if t.Name() == "current_patient" {
+				output, _ := t.Call(context.Background(), input)
+				return output
+			}
+		}
+		return ""
+	}
+	var own PatientSummary
+	json.Unmarshal([]byte(sessionPatient(`{"patient_id": "P002"}`, "")), &own)
+	other := sessionPatient(`{"patient_id": "P002"}`, "P001")
+	none := sessionPatient("", "")
+	noneOther := sessionPatient("", "P001")
+	if own.Patient.ID != "P002" || own.Patient.Sex != sexFemale || strings.Contains(other, `"P001"`) || !strings.Contains(other, "不能查询") ||
+		strings.Contains(none, "P001") || strings.Contains(noneOther, `"patient"`) {
+		fmt.Printf("❌ 会话的患者查询不符: %+v / %s / %s / %s\n", own.Patient, other, none, noneOther)
+	} else {
+		fmt.Println("✅ 不同患者的会话各自只能查询本会话的患者，未指定患者的会话不使用当前患者")
+	}
+
+	// 未配置模型时对话接口不可用，其他接口正常
+	offline := httptest.NewServer(newAPIServer(nil, errMissingAPIKey, nil, nil, nil, apiConfig{}).handler())
+	defer offline.Close()
+	if code := apiRequest(offline.URL+"/v1/sessions", "POST", "", "", nil); code != http.StatusServiceUnavailable {
+		fmt.Printf("❌ 未配置模型时创建会话返回 %d\n", code)
+	} else {
+		fmt.Println("✅ 未配置模型时对话接口返回 503")
+	}
+
+	// 处理超时
+	slow := httptest.NewServer(newAPIServer(blockingLLM{started: make(chan struct{})}, nil, nil, nil, nil, apiConfig{RequestTimeout: 100 * time.Millisecond}).handler())
+	defer slow.Close()
+	info = SessionInfo{}
+	apiRequest(slow.URL+"/v1/sessions", "POST", "", "", &info)
+	if code := apiRequest(slow.URL+"/v1/sessions/"+info.ID+"/messages", "POST", "application/json", `{"message": "痛风是什么"}`, nil); code != http.StatusGatewayTimeout {
+		fmt.Printf("❌ 处理超时返回 %d\n", code)
+	} else {
+		fmt.Println("✅ 处理超时返回 504")
+	}
+}
+
+// readEvents 读取 Server-Sent Events 响应中的事件
+func readEvents(body io.Reader) []AgentEvent {
+	var events []AgentEvent
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var e AgentEvent
+		if json.Unmarshal([]byte(data), &e) == nil {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func testStreaming() {
+	fmt.Println("\n1️⃣4️⃣ 测试流式输出")
+	fmt.Println("─────────────────────────────────")
+
+	// 最终答复标记被拆分到多个片段时，只转发标记之后的内容
+	var tokens []string
+	stream := agentEvents(withAgentEvents(context.Background(), func(e AgentEvent) { tokens = append(tokens, e.Text) }))
+	for _, chunk := range []string{" Do I need to use a tool? No\nA", "I: 血尿酸", "偏高"} {
+		stream.token(chunk)
+	}
+	if strings.Join(tokens, "|") != "血尿酸|偏高" {
+		fmt.Printf("❌ 答复片段不符: %q\n", tokens)
+	} else {
+		fmt.Println("✅ 只转发最终答复的片段")
+	}
+
+	// 命令行逐步显示工具调用和答复
+	var out strings.Builder
+	s, err := newSession(NewScriptedLLM(), nil, nil, nil, &out)
+	if err != nil {
+		fmt.Printf("❌ 创建会话失败: %v\n", err)
+		return
+	}
+	s.handle(context.Background(), "尿酸 520 umol/L")
+	text := out.String()
+	call, done, answer := strings.Index(text, "🔧 调用 gout_lab_analyzer"), strings.Index(text, "✔ gout_lab_analyzer 完成"), strings.Index(text, "📋 分析结果")
+	if call < 0 || done < call || answer < done || !strings.Contains(text[answer:], offlinePrefix) || strings.Count(text, offlinePrefix) != 1 {
+		fmt.Printf("❌ 命令行流式输出不符:\n%s\n", text)
+	} else {
+		fmt.Println("✅ 命令行依次显示工具调用和答复")
+	}
+
+	// HTTP 接口以 Server-Sent Events 返回
+	server := httptest.NewServer(newAPIServer(NewScriptedLLM(), nil, nil, nil, nil, apiConfig{}).handler())
+	defer server.Close()
+	var info SessionInfo
+	apiRequest(server.URL+"/v1/sessions", "POST", "", "", &info)
+	req, _ := http.NewRequest("POST", server.URL+"/v1/sessions/"+info.ID+"/messages", strings.NewReader(`{"message": "尿酸 520 umol/L；肌酐 95 umol/L"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("❌ 请求失败: %v\n", err)
+		return
+	}
+	events := readEvents(resp.Body)
+	resp.Body.Close()
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	last := AgentEvent{}
+	if len(events) > 0 {
+		last = events[len(events)-1]
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") ||
+		strings.Join(types, ",") != "thought,tool_start,tool_end,token,answer" ||
+		events[1].Tool != "gout_lab_analyzer" || !strings.Contains(events[2].Output, "risk_level") ||
+		!strings.Contains(last.Text, offlinePrefix) {
+		fmt.Printf("❌ 事件流不符: %s %v\n", resp.Header.Get("Content-Type"), types)
+	} else {
+		fmt.Printf("✅ 事件流: %s\n", strings.Join(types, " → "))
+	}
+	id := info.ID
+	info = SessionInfo{}
+	apiRequest(server.URL+"/v1/sessions/"+id, "GET", "", "", &info)
+	if len(info.Messages) != 1 || info.Messages[0].Answer != last.Text {
+		fmt.Printf("❌ 流式对话未保存: %+v\n", info.Messages)
+	} else {
+		fmt.Println("✅ 流式对话保存到会话记录")
+	}
+}
+
+func testMCPServer() {
+	fmt.Println("\n1️⃣5️⃣ 测试 MCP 工具服务")
+	fmt.Println("─────────────────────────────────")
+
+	dir, err := os.MkdirTemp("", "gout-mcp")
+	if err != nil {
+		fmt.Printf("❌ 创建临时目录失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenPatientStore(filepath.Join(dir, "patients.db"))
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	defer store.Close()
+	store.CreatePatient(PatientProfile{ID: "P001", Sex: sexMale, Age: 50, Tophi: true})
+
+	server, err := newMCPServer(nil, nil, store)
+	if err != nil {
+		fmt.Printf("❌ 创建 MCP 服务失败: %v\n", err)
+		return
+	}
+	requests := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"gout_lab_analyzer","arguments":{"report":"日期: 2024-01-10\n尿酸 520 umol/L","patient_id":"P001"}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"medical_knowledge_base","arguments":{"query":"痛风石"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"calculator","arguments":{"expression":"520 / 59.48"}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/call","params":{"name":"gout_lab_analyzer","arguments":{"report":"尿酸 520","patient_id":"P404"}}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"calculator","arguments":{"expression":"1 +"}}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"tools/call","params":{"name":"web_search","arguments":{}}}`,
+		`{"jsonrpc":"2.0","id":9,"method":"tools/call","params":{"name":"medical_knowledge_base","arguments":{"q":"痛风"}}}`,
+		`{"jsonrpc":"2.0","id":10,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":11,`,
+	}
+	var out bytes.Buffer
+	if err := server.serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		fmt.Printf("❌ MCP 服务运行失败: %v\n", err)
+		return
+	}
+
+	type toolResult struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		StructuredContent json.RawMessage `json:"structuredContent"`
+		IsError           bool            `json:"isError"`
+	}
+	type response struct {
+		ID     json.RawMessage `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *jsonrpcError   `json:"error"`
+	}
+	var responses []response
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var resp response
+		if err := decoder.Decode(&resp); err != nil {
+			fmt.Printf("❌ 响应不是有效的 JSON: %v\n", err)
+			return
+		}
+		responses = append(responses, resp)
+	}
+	// 通知没有响应
+	if len(responses) != len(requests)-1 {
+		fmt.Printf("❌ 响应数量不符: %d\n", len(responses))
+		return
+	}
+	fmt.Println("✅ 每个请求一条响应，通知不响应")
+
+	var initResult struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		Capabilities    struct {
+			Tools map[string]any `json:"tools"`
+		} `json:"capabilities"`
+		ServerInfo struct {
+			Name string `json:"name"`
+		} `json:"serverInfo"`
+	}
+	json.Unmarshal(responses[0].Result, &initResult)
+	if initResult.ProtocolVersion != "2025-03-26" || initResult.Capabilities.Tools == nil || initResult.ServerInfo.Name != mcpServerName {
+		fmt.Printf("❌ 初始化结果不符: %+v\n", initResult)
+	} else {
+		fmt.Printf("✅ 协商协议版本 %s\n", initResult.ProtocolVersion)
+	}
+
+	var list struct {
+		Tools []struct {
+			Name         string         `json:"name"`
+			InputSchema  map[string]any `json:"inputSchema"`
+			OutputSchema map[string]any `json:"outputSchema"`
+		} `json:"tools"`
+	}
+	json.Unmarshal(responses[1].Result, &list)
+	var names []string
+	for _, t := range list.Tools {
+		if t.InputSchema["type"] == "object" && t.OutputSchema["type"] == "object" {
+			names = append(names, t.Name)
+		}
+	}
+	if strings.Join(names, ",") != "gout_lab_analyzer,medical_knowledge_base,calculator" {
+		fmt.Printf("❌ 工具列表不符: %v\n", names)
+	} else {
+		fmt.Printf("✅ 工具列表含输入和输出 Schema: %s\n", strings.Join(names, ", "))
+	}
+
+	var analysis toolResult
+	var result GoutAnalysisResult
+	json.Unmarshal(responses[2].Result, &analysis)
+	json.Unmarshal(analysis.StructuredContent, &result)
+	history, _ := store.Reports("P001")
+	if analysis.IsError || result.UricAcidLevel == nil || result.UrateTrend == nil || result.UrateTrend.Target != 300 || len(history) != 1 ||
+		len(analysis.Content) != 1 || !json.Valid([]byte(analysis.Content[0].Text)) {
+		fmt.Printf("❌ 化验单分析结果不符: %s\n", responses[2].Result)
+	} else {
+		fmt.Printf("✅ gout_lab_analyzer 返回结构化结果并保存患者化验记录: %s\n", result.RiskLevel)
+	}
+
+	var knowledge toolResult
+	var found KnowledgeResult
+	json.Unmarshal(responses[3].Result, &knowledge)
+	json.Unmarshal(knowledge.StructuredContent, &found)
+	if knowledge.IsError || found.Query != "痛风石" || len(found.Results) == 0 {
+		fmt.Printf("❌ 知识查询结果不符: %s\n", responses[3].Result)
+	} else {
+		fmt.Printf("✅ medical_knowledge_base 返回 %d 条知识\n", len(found.Results))
+	}
+
+	var calc toolResult
+	var calculated CalculatorResult
+	json.Unmarshal(responses[4].Result, &calc)
+	json.Unmarshal(calc.StructuredContent, &calculated)
+	if calc.IsError || !strings.HasPrefix(calculated.Result, "8.74") {
+		fmt.Printf("❌ 计算结果不符: %s\n", responses[4].Result)
+	} else {
+		fmt.Printf("✅ calculator: 520 / 59.48 = %s\n", calculated.Result)
+	}
+
+	// 工具执行失败时在结果中标记 isError，协议错误返回 JSON-RPC 错误
+	var unknownPatient, badExpression toolResult
+	json.Unmarshal(responses[5].Result, &unknownPatient)
+	json.Unmarshal(responses[6].Result, &badExpression)
+	if !unknownPatient.IsError || !badExpression.IsError || unknownPatient.StructuredContent != nil {
+		fmt.Printf("❌ 工具执行失败未标记: %s %s\n", responses[5].Result, responses[6].Result)
+	} else {
+		fmt.Println("✅ 未知患者和无效表达式返回 isError 结果")
+	}
+	codes := []int{}
+	for _, resp := range responses[7:] {
+		if resp.Error != nil {
+			codes = append(codes, resp.Error.Code)
+		}
+	}
+	if fmt.Sprint(codes) != fmt.Sprint([]int{jsonrpcInvalidParams, jsonrpcInvalidParams, jsonrpcMethodNotFound, jsonrpcParseError}) {
+		fmt.Printf("❌ 协议错误码不符: %v\n", codes)
+	} else {
+		fmt.Println("✅ 未知工具、参数错误、未知方法和无效消息返回 JSON-RPC 错误")
+	}
+}
+
+// writeKnowledgeFiles 在临时目录中写入知识库数据文件
+func writeKnowledgeFiles(files map[string]string) (string, error) {
+	dir, err := os.MkdirTemp("", "gout-knowledge")
+	if err != nil {
+		return "", err
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func testKnowledgeData() {
+	fmt.Println("\n1️⃣6️⃣ 测试知识库数据文件")
+	fmt.Println("─────────────────────────────────")
+
+	// 内置知识
+	kb, err := LoadMedicalKnowledgeBase("")
+	if err != nil {
+		fmt.Printf("❌ 内置知识库无效: %v\n", err)
+		return
+	}
+	versioned := 0
+	for _, info := range kb.Entries() {
+		if info.Version != "" {
+			versioned++
+		}
+	}
+	if len(kb.Entries()) != 7 || versioned != 7 || len(kb.Version()) != 12 || NewMedicalKnowledgeBase().Version() != kb.Version() {
+		fmt.Printf("❌ 内置知识库不符: %d 个条目，%d 个有版本，版本 %q\n", len(kb.Entries()), versioned, kb.Version())
+	} else {
+		fmt.Printf("✅ 内置知识库 %d 个条目，版本 %s\n", len(kb.Entries()), kb.Version())
+	}
+
+	// 查询结果附带知识库版本和条目版本
+	var result KnowledgeResult
+	output, _ := kb.Call(context.Background(), "痛风石")
+	if err := json.Unmarshal([]byte(output), &result); err != nil || result.KnowledgeVersion != kb.Version() ||
+		len(result.Results) == 0 || result.Results[0].Version == "" || strings.Contains(output, "last_reviewed") {
+		fmt.Printf("❌ 查询结果未附带版本: %s\n", output)
+	} else {
+		fmt.Printf("✅ 查询结果附带知识库版本 %s 和条目版本 %s，未审核的条目不含审核日期\n", result.KnowledgeVersion, result.Results[0].Version)
+	}
+	if output, _ := kb.Call(context.Background(), "糖尿病"); !strings.Contains(output, kb.Version()) {
+		fmt.Printf("❌ 未找到时未附带版本: %s\n", output)
+	} else {
+		fmt.Println("✅ 未找到时同样附带知识库版本")
+	}
+	if output, _ := kb.Call(context.Background(), `{"topic": "痛风", "sections": ["dosage"]}`); !strings.Contains(output, "知识查询格式有误") || !strings.Contains(output, kb.Version()) {
+		fmt.Printf("❌ 查询格式有误时未附带版本: %s\n", output)
+	} else {
+		fmt.Println("✅ 查询格式有误时同样附带知识库版本")
+	}
+
+	// 从目录加载 JSON 和 YAML 文件
+	dir, err := writeKnowledgeFiles(map[string]string{
+		"gout.yaml": `key: 痛风
+topic: 痛风 (Gout)
+version: "2.1"
+last_reviewed: 2025-03-01
+definition: 单钠尿酸盐晶体沉积所致的炎症性关节病。
+treatment:
+  - 降尿酸目标 <360 μmol/L
+`,
+		"labs.json": `[
+  {"key": "尿酸", "topic": "尿酸 (Uric Acid)", "version": "1.2", "last_reviewed": "2025-02-10",
+   "definition": "嘌呤代谢的最终产物。", "references": ["男性：208-428 μmol/L"]},
+  {"key": "肌酐", "topic": "肌酐 (Creatinine)", "version": "1.0", "last_reviewed": "2025-02-10",
+   "definition": "肌肉代谢产物，反映肾小球滤过功能。", "references": ["男性：54-106 μmol/L"]}
+]`,
+		"README.md": "编辑说明不是数据文件",
+	})
+	if err != nil {
+		fmt.Printf("❌ 写入临时文件失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	custom, err := LoadMedicalKnowledgeBase(dir)
+	if err != nil {
+		fmt.Printf("❌ 加载知识库目录失败: %v\n", err)
+	} else if results := custom.Lookup("肌酐"); len(custom.Entries()) != 3 || len(results) != 1 ||
+		results[0].Version != "1.0" || custom.Lookup("痛风")[0].LastReviewed != "2025-03-01" || custom.Version() == kb.Version() {
+		fmt.Printf("❌ 知识库目录内容不符: %+v\n", custom.Entries())
+	} else {
+		fmt.Printf("✅ 从目录加载 JSON 和 YAML 条目，版本 %s\n", custom.Version())
+	}
+
+	// 化验单分析的默认参考范围和降尿酸目标取自加载的知识库，而不是内置知识
+	edited, err := writeKnowledgeFiles(map[string]string{
+		"gout.yaml": `key: 痛风
+topic: 痛风 (Gout)
+version: "2.2"
+last_reviewed: 2025-04-01
+definition: 单钠尿酸盐晶体沉积所致的炎症性关节病。
+treatment:
+  - 目标：血尿酸<340μmol/L
+  - 有痛风石者：血尿酸<280μmol/L
+`,
+		"uric_acid.yaml": `key: 尿酸
+topic: 尿酸 (Uric Acid)
+version: "1.3"
+last_reviewed: 2025-04-01
+definition: 嘌呤代谢的最终产物。
+references:
+  - 男性：208-400 μmol/L
+`,
+	})
+	if err != nil {
+		fmt.Printf("❌ 写入临时文件失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(edited)
+	editedKB, err := LoadMedicalKnowledgeBase(edited)
+	if err != nil {
+		fmt.Printf("❌ 加载知识库目录失败: %v\n", err)
+		return
+	}
+	male := PatientContext{Sex: sexMale, Age: 45}
+	analysis, err := GoutLabAnalyzer{Patient: male, Knowledge: editedKB}.Analyze("日期: 2024-01-01\n尿酸 360 umol/L\n日期: 2024-03-01\n尿酸 410 umol/L")
+	builtin, _ := GoutLabAnalyzer{Patient: male}.Analyze("尿酸 410 umol/L")
+	if err != nil || analysis.UricAcidLevel == nil || analysis.UricAcidLevel.ReferenceMax != 400 || analysis.UricAcidLevel.Status != "偏高" ||
+		analysis.UricAcidLevel.ReferenceSource != "知识库: 尿酸" || analysis.UrateTrend == nil || analysis.UrateTrend.Target != 340 ||
+		builtin.UricAcidLevel == nil || builtin.UricAcidLevel.ReferenceMax != 428 {
+		fmt.Printf("❌ 化验单分析未使用加载的知识库: %+v %+v %v\n", analysis.UricAcidLevel, analysis.UrateTrend, err)
+	} else {
+		fmt.Printf("✅ 化验单分析使用加载的知识库: 参考上限 %.0f μmol/L，治疗目标 <%.0f μmol/L\n", analysis.UricAcidLevel.ReferenceMax, analysis.UrateTrend.Target)
+	}
+
+	// 校验失败时列出全部问题
+	invalid, err := writeKnowledgeFiles(map[string]string{
+		"a.yaml": `key: 痛风
+topic: 痛风
+definition: 定义
+last_reviewed: 2025-13-01
+symptoms: ["关节痛", ""]
+dosage: 每日一次
+`,
+		"b.json": `{"key": "痛风", "topic": "痛风", "definition": "定义", "version": "1", "last_reviewed": "2025-01-01"}`,
+	})
+	if err != nil {
+		fmt.Printf("❌ 写入临时文件失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(invalid)
+	_, err = LoadMedicalKnowledgeBase(invalid)
+	var knowledgeErr *KnowledgeError
+	if !errors.As(err, &knowledgeErr) || len(knowledgeErr.Problems) != 2 ||
+		!strings.Contains(knowledgeErr.Problems[0], "a.yaml") || !strings.Contains(knowledgeErr.Problems[0], "dosage") ||
+		!strings.Contains(knowledgeErr.Problems[1], "没有任何内容小节") {
+		fmt.Printf("❌ 未定义字段或缺少内容未被发现: %v\n", err)
+	} else {
+		fmt.Println("✅ 拒绝未定义的字段和没有内容的条目")
+	}
+	os.WriteFile(filepath.Join(invalid, "a.yaml"), []byte(`key: 痛风
+topic: 痛风
+definition: 定义
+last_reviewed: 2025-13-01
+symptoms: ["关节痛", ""]
+`), 0o644)
+	_, err = LoadMedicalKnowledgeBase(invalid)
+	problems := ""
+	if errors.As(err, &knowledgeErr) {
+		problems = strings.Join(knowledgeErr.Problems, "\n")
+	}
+	for _, want := range []string{"缺少 version", "不是 YYYY-MM-DD 格式的日期", "symptoms 第 2 项为空", "与 a.yaml 重复"} {
+		if !strings.Contains(problems, want) {
+			fmt.Printf("❌ 未报告问题 %q: %v\n", want, err)
+			problems = ""
+		}
+	}
+	if problems != "" {
+		fmt.Printf("✅ 报告全部 %d 个问题: 缺少字段、日期格式、空项和重复关键词\n", len(knowledgeErr.Problems))
+	}
+	conflicting, _ := writeKnowledgeFiles(map[string]string{
+		"entries.yaml": `- key: 痛风
+  aliases: [gout, "--"]
+  topic: 痛风
+  definition: 定义
+  version: "1"
+  last_reviewed: 2025-01-01
+  treatment: [降尿酸治疗]
+- key: 痛风石
+  aliases: [Gout, tophi]
+  topic: 痛风石
+  definition: 定义
+  version: "1"
+  last_reviewed: 2025-01-01
+  treatment: [手术切除]
+`,
+	})
+	defer os.RemoveAll(conflicting)
+	_, err = LoadMedicalKnowledgeBase(conflicting)
+	if !errors.As(err, &knowledgeErr) || len(knowledgeErr.Problems) != 2 ||
+		!strings.Contains(knowledgeErr.Problems[0], "aliases 第 2 项为空") ||
+		!strings.Contains(knowledgeErr.Problems[1], `别名 "Gout" 与条目 痛风 的关键词或别名重复`) {
+		fmt.Printf("❌ 别名问题未被发现: %v\n", err)
+	} else {
+		fmt.Println("✅ 拒绝空别名和不同条目间重复的别名")
+	}
+	empty, _ := writeKnowledgeFiles(nil)
+	defer os.RemoveAll(empty)
+	if _, err := LoadMedicalKnowledgeBase(empty); err == nil {
+		fmt.Println("❌ 空目录未报错")
+	} else {
+		fmt.Println("✅ 没有数据文件时报错")
+	}
+
+	// 指定的知识库用于智能体、HTTP 接口和 MCP 工具
+	api := httptest.NewServer(newAPIServer(nil, errMissingAPIKey, nil, custom, nil, apiConfig{}).handler())
+	defer api.Close()
+	resp, err := http.Get(api.URL + "/v1/knowledge?q=肌酐")
+	if err != nil {
+		fmt.Printf("❌ 请求失败: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+	var mcpOut bytes.Buffer
+	server, _ := newMCPServer(nil, custom, nil)
+	server.serve(context.Background(), strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"medical_knowledge_base","arguments":{"query":"肌酐"}}}`), &mcpOut)
+	if resp.Header.Get("X-Knowledge-Version") != custom.Version() || !strings.Contains(mcpOut.String(), `"knowledge_version":"`+custom.Version()+`"`) {
+		fmt.Printf("❌ 接口未使用指定知识库: %s %s\n", resp.Header.Get("X-Knowledge-Version"), mcpOut.String())
+	} else {
+		fmt.Println("✅ HTTP 接口和 MCP 工具报告所用知识库版本")
+	}
+}
+
+// matchKeys 返回检索结果的主题关键词
+func matchKeys(matches []KnowledgeMatch) string {
+	keys := make([]string, len(matches))
+	for i, m := range matches {
+		keys[i] = m.Key
+	}
+	return strings.Join(keys, ",")
+}
+
+func testKnowledgeSearch() {
+	fmt.Println("\n1️⃣7️⃣ 测试知识检索排序")
+	fmt.Println("─────────────────────────────────")
+
+	if terms := strings.Join(queryTerms("C反应蛋白(CRP) 痛"), " "); terms != "c crp 反应 应蛋 痛 蛋白" {
+		fmt.Printf("❌ 查询切分不符: %s\n", terms)
+	} else {
+		fmt.Println("✅ 汉字按二字切分，字母按词切分并转为小写")
+	}
+
+	kb := NewMedicalKnowledgeBase()
+	cases := []struct {
+		query string
+		want  string // 按顺序返回的条目
+	}{
+		{"痛风急性期怎么用药", "痛风,炎症,关节炎"},
+		{"什么是痛风？", "痛风"},
+		{"痛风石", "痛风石,痛风"},
+		{"高尿酸血症", "高尿酸血症,痛风,尿酸"},
+		{"尿酸", "尿酸"},
+		{"CRP", "炎症"},
+		{"急性肾损伤", "肾功能"},
+	}
+	for _, c := range cases {
+		if got := matchKeys(kb.Lookup(c.query)); got != c.want {
+			fmt.Printf("❌ %s: 期望 %s，实际 %s\n", c.query, c.want, got)
+		} else {
+			fmt.Printf("✅ %s → %s\n", c.query, got)
+		}
+	}
+
+	// 得分、命中字段和稳定的顺序
+	matches := kb.Search("痛风急性期怎么用药", 0)
+	sorted := slices.IsSortedFunc(matches, func(a, b KnowledgeMatch) int {
+		if a.Score > b.Score {
+			return -1
+		}
+		if a.Score < b.Score {
+			return 1
+		}
+		return 0
+	})
+	stable := true
+	for range 20 {
+		if matchKeys(NewMedicalKnowledgeBase().Search("痛风急性期怎么用药", 0)) != matchKeys(matches) {
+			stable = false
+		}
+	}
+	if !sorted || !stable || matches[0].Score <= 0 || !slices.Contains(matches[0].MatchedFields, "treatment") || !slices.Contains(matches[0].MatchedFields, "key") {
+		fmt.Printf("❌ 得分或命中字段不符: %+v\n", matches[0].MatchedFields)
+	} else {
+		fmt.Printf("✅ 按得分排序且顺序稳定，首条得分 %.3f，命中字段 %s\n", matches[0].Score, strings.Join(matches[0].MatchedFields, "、"))
+	}
+	if fields := kb.Lookup("糖尿病"); len(fields) != 1 || strings.Join(fields[0].MatchedFields, ",") != "risk_factors" {
+		fmt.Printf("❌ 正文字段未被检索: %+v\n", fields)
+	} else {
+		fmt.Println("✅ 检索覆盖全部字段: 糖尿病 命中痛风条目的危险因素")
+	}
+
+	// 返回条数
+	all := kb.Search("酸", 0)
+	if len(kb.Search("酸", 2)) != 2 || len(kb.Lookup("酸")) != defaultKnowledgeTopK || len(all) <= defaultKnowledgeTopK {
+		fmt.Printf("❌ 返回条数限制不符: %d\n", len(all))
+	} else {
+		fmt.Printf("✅ 默认返回前 %d 条，共 %d 条匹配\n", defaultKnowledgeTopK, len(all))
+	}
+	if results := kb.Lookup("！？"); len(results) != 0 {
+		fmt.Printf("❌ 无有效词项时返回了结果: %s\n", matchKeys(results))
+	} else {
+		fmt.Println("✅ 无有效词项时不返回结果")
+	}
+
+	// HTTP 接口和 MCP 工具的返回条数参数
+	server := httptest.NewServer(newAPIServer(nil, errMissingAPIKey, nil, nil, nil, apiConfig{}).handler())
+	defer server.Close()
+	var results []KnowledgeMatch
+	code := apiRequest(server.URL+"/v1/knowledge?q=%E9%85%B8&k=5", "GET", "", "", &results)
+	if code != 200 || len(results) != 5 || results[0].Score == 0 || len(results[0].MatchedFields) == 0 {
+		fmt.Printf("❌ 知识查询 k 参数不符: %d %d\n", code, len(results))
+	} else if code := apiRequest(server.URL+"/v1/knowledge?q=%E9%85%B8&k=0", "GET", "", "", nil); code != http.StatusBadRequest {
+		fmt.Printf("❌ 无效的 k 返回 %d\n", code)
+	} else {
+		fmt.Println("✅ HTTP 接口按 k 返回条目，含得分和命中字段")
+	}
+	var out bytes.Buffer
+	mcp, _ := newMCPServer(nil, nil, nil)
+	mcp.serve(context.Background(), strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"medical_knowledge_base","arguments":{"query":"酸","top_k":1}}}
+{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"medical_knowledge_base","arguments":{"query":"酸","top_k":50}}}`), &out)
+	var first, second struct {
+		Result struct {
+			StructuredContent KnowledgeResult `json:"structuredContent"`
+		} `json:"result"`
+		Error *jsonrpcError `json:"error"`
+	}
+	decoder := json.NewDecoder(&out)
+	decoder.Decode(&first)
+	decoder.Decode(&second)
+	if len(first.Result.StructuredContent.Results) != 1 || second.Error == nil || second.Error.Code != jsonrpcInvalidParams {
+		fmt.Printf("❌ MCP top_k 参数不符: %+v %+v\n", first, second.Error)
+	} else {
+		fmt.Println("✅ MCP 工具按 top_k 返回条目")
+	}
+}
+
+func testKnowledgeAliases() {
+	fmt.Println("\n1️⃣8️⃣ 测试英文和拼音查询")
+	fmt.Println("─────────────────────────────────")
+
+	kb := NewMedicalKnowledgeBase()
+	cases := []struct {
+		query string
+		want  string // 首个结果的主题关键词
+	}{
+		{"gout", "痛风"},
+		{"What is gout?", "痛风"},
+		{"hyperuricemia", "高尿酸血症"},
+		{"Hyperuricaemia", "高尿酸血症"},
+		{"uric_acid", "尿酸"},
+		{"Uric-Acid", "尿酸"},
+		{"gouty_arthritis", "关节炎"},
+		{"kidney_function", "肾功能"},
+		{"inflammation", "炎症"},
+		{"tophi", "痛风石"},
+		{"tongfeng", "痛风"},
+		{"tòng fēng", "痛风"},
+		{"tong feng shi", "痛风石"},
+		{"HUA 怎么治疗", "高尿酸血症"},
+		{"eGFR 低", "肾功能"},
+		{"通风怎么治疗", "痛风"},
+		{"gaut", "痛风"},
+	}
+	for _, c := range cases {
+		results := kb.Lookup(c.query)
+		if len(results) == 0 || results[0].Key != c.want {
+			fmt.Printf("❌ %s: 期望 %s，实际 %s\n", c.query, c.want, matchKeys(results))
+		} else {
+			fmt.Printf("✅ %s → %s %v\n", c.query, results[0].Key, results[0].MatchedFields)
+		}
+	}
+
+	// 缩写只匹配完整的词
+	if results := kb.Lookup("usual"); len(results) != 0 {
+		fmt.Printf("❌ 缩写 UA 匹配到了单词的一部分: %s\n", matchKeys(results))
+	} else {
+		fmt.Println("✅ 缩写只匹配完整的词")
+	}
+
+	// 同一主题的中文、英文、拼音和混合查询得到相同的条目
+	chinese := kb.Lookup("痛风石")
+	same := true
+	for _, q := range []string{"tophi", "tophus", "tongfengshi", "痛风 tophi"} {
+		if results := kb.Lookup(q); len(results) == 0 || results[0].Key != chinese[0].Key || results[0].Version != chinese[0].Version {
+			same = false
+		}
+	}
+	if !same {
+		fmt.Println("❌ 中英文查询返回的条目不同")
+	} else {
+		fmt.Println("✅ 中文、英文、拼音和混合查询返回相同的条目")
+	}
+	if output, _ := kb.Call(context.Background(), "gout"); strings.Contains(output, "未找到") {
+		fmt.Println("❌ 英文查询未找到知识")
+	} else {
+		fmt.Println("✅ 工具描述中列出的英文主题均可查询")
+	}
+}
+
+func testKnowledgeSections() {
+	fmt.Println("\n1️⃣9️⃣ 测试按小节查询")
+	fmt.Println("─────────────────────────────────")
+
+	kb := NewMedicalKnowledgeBase()
+	ctx := context.Background()
+	full, _ := kb.Call(ctx, "痛风")
+	output, _ := kb.Call(ctx, `{"topic": "痛风", "sections": ["treatment"]}`)
+	var result KnowledgeResult
+	if err := json.Unmarshal([]byte(output), &result); err != nil || len(result.Results) == 0 {
+		fmt.Printf("❌ 结构化查询失败: %s\n", output)
+	} else if info := result.Results[0]; info.Key != "痛风" || len(info.Treatment) == 0 || info.Definition != "" ||
+		len(info.Symptoms) > 0 || len(info.Aliases) > 0 || info.Version == "" || strings.Join(result.Sections, ",") != "treatment" ||
+		strings.Contains(output, `"symptoms":`) || strings.Contains(output, `"definition":`) {
+		fmt.Printf("❌ 结构化查询返回了未请求的小节: %s\n", output)
+	} else {
+		fmt.Printf("✅ 只返回治疗小节，输出 %d 字节（完整条目 %d 字节）\n", len(output), len(full))
+	}
+
+	// 中文小节名称，按字段顺序去重
+	output, _ = kb.Call(ctx, ` {"topic": "gout", "sections": ["治疗", "诊断标准", "treatment"]}`)
+	result = KnowledgeResult{}
+	json.Unmarshal([]byte(output), &result)
+	if strings.Join(result.Sections, ",") != "diagnosis,treatment" || len(result.Results) == 0 || len(result.Results[0].Diagnosis) == 0 {
+		fmt.Printf("❌ 中文小节名称未识别: %s\n", output)
+	} else {
+		fmt.Println("✅ 小节可用中文名称，按字段顺序去重")
+	}
+
+	// 不含指定小节的条目不返回：痛风石条目没有诊断标准
+	if results := kb.Query(KnowledgeQuery{Topic: "痛风石", Sections: []string{"diagnosis"}}, defaultKnowledgeTopK); matchKeys(results) != "痛风" {
+		fmt.Printf("❌ 返回了不含指定小节的条目: %s\n", matchKeys(results))
+	} else {
+		fmt.Println("✅ 跳过不含指定小节的条目")
+	}
+	if results := kb.Query(KnowledgeQuery{Topic: "酸", Sections: []string{"definition"}}, 2); len(results) != 2 {
+		fmt.Printf("❌ 结构化查询条数不符: %d\n", len(results))
+	}
+
+	// 纯文本查询仍返回完整条目
+	if !strings.Contains(full, `"symptoms"`) || !strings.Contains(full, `"definition"`) || strings.Contains(full, `"sections"`) {
+		fmt.Println("❌ 纯文本查询未返回完整条目")
+	} else {
+		fmt.Println("✅ 纯文本查询返回完整条目")
+	}
+
+	// 格式错误时返回说明，供模型修正输入
+	for input, want := range map[string]string{
+		`{"topic": "痛风", "sections": ["dosage"]}`: "未知的小节 \"dosage\"",
+		`{"sections": ["treatment"]}`:              "缺少查询主题",
+		`{"topic": "痛风", "limit": 1}`:             "解析结构化查询失败",
+	} {
+		if output, err := kb.Call(ctx, input); err != nil || !strings.Contains(output, "知识查询格式有误") || !strings.Contains(output, want) {
+			fmt.Printf("❌ %s: %s\n", input, output)
+		}
+	}
+	fmt.Println("✅ 未知小节、缺少主题和未定义字段返回错误说明")
+
+	// HTTP 接口和 MCP 工具的小节参数
+	server := httptest.NewServer(newAPIServer(nil, errMissingAPIKey, nil, nil, nil, apiConfig{}).handler())
+	defer server.Close()
+	var matches []KnowledgeMatch
+	code := apiRequest(server.URL+"/v1/knowledge?q=gout&sections=treatment,references", "GET", "", "", &matches)
+	if code != 200 || len(matches) == 0 || len(matches[0].Treatment) == 0 || len(matches[0].Symptoms) > 0 {
+		fmt.Printf("❌ 知识查询 sections 参数不符: %d %+v\n", code, matches)
+	} else if code := apiRequest(server.URL+"/v1/knowledge?q=gout&sections=dosage", "GET", "", "", nil); code != http.StatusBadRequest {
+		fmt.Printf("❌ 未知小节返回 %d\n", code)
+	} else {
+		fmt.Println("✅ HTTP 接口按 sections 返回指定小节")
+	}
+	var out bytes.Buffer
+	mcp, _ := newMCPServer(nil, nil, nil)
+	mcp.serve(ctx, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"medical_knowledge_base","arguments":{"query":"痛风石","sections":["treatment"]}}}
+{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"medical_knowledge_base","arguments":{"query":"痛风石","sections":["dosage"]}}}`), &out)
+	var first, second struct {
+		Result struct {
+			StructuredContent KnowledgeResult `json:"structuredContent"`
+		} `json:"result"`
+		Error *jsonrpcError `json:"error"`
+	}
+	decoder := json.NewDecoder(&out)
+	decoder.Decode(&first)
+	decoder.Decode(&second)
+	if results := first.Result.StructuredContent.Results; len(results) == 0 || results[0].Key != "痛风石" || len(results[0].Treatment) == 0 || results[0].Definition != "" ||
+		second.Error == nil || second.Error.Code != jsonrpcInvalidParams {
+		fmt.Printf("❌ MCP sections 参数不符: %+v %+v\n", first, second.Error)
+	} else {
+		fmt.Println("✅ MCP 工具按 sections 返回指定小节")
+	}
+}
+
+// guidelineTestFiles 指南检索测试用的文档：Markdown、英文 Markdown 和带分页符的 PDF 导出文本
+var guidelineTestFiles = map[string]string{
+	"china_2019.md": `# 中国高尿酸血症与痛风诊疗指南（2019）
+
+## 降尿酸治疗
+
+### 起始时机
+痛风患者血尿酸≥480 μmol/L 时，建议开始降尿酸药物治疗；
+合并痛风石、慢性痛风性关节炎或痛风发作≥2次/年时，血尿酸≥420 μmol/L 即开始降尿酸治疗。
+
+### 控制目标
+建议痛风患者血尿酸控制在 <360 μmol/L，合并痛风石或频繁发作者控制在 <300 μmol/L，
+不建议长期低于 180 μmol/L。
+
+### 药物选择
+- 别嘌醇为一线降尿酸药物，起始剂量不超过 100 mg/d。
+- 非布司他可作为一线用药，合并心血管疾病者慎用。
+
+## 急性发作期治疗
+痛风急性发作期推荐尽早（24 小时内）使用秋水仙碱或非甾体抗炎药，
+对上述药物不耐受或有禁忌时可使用糖皮质激素。
+`,
+	"acr_2020.md": `# 2020 ACR Guideline for the Management of Gout
+
+## Treat-to-target
+We strongly recommend a treat-to-target management strategy with ULT dose titration
+guided by serial serum urate measurements to achieve a serum urate target of less than 6 mg/dl.
+
+## Choice of first-line ULT
+We strongly recommend allopurinol as the preferred first-line ULT agent for all patients.
+Starting dose of allopurinol should be no greater than 100 mg/day, and lower in patients with CKD.
+`,
+	"eular/eular_2016.txt": "EULAR 2016 recommendations for the management of gout\n\nFlares should be treated as early as possible.\n" +
+		"\fThe serum uric acid should be maintained below 360 umol/L.\nA lower target below 300 umol/L is recommended for patients with tophi.\n",
+	"notes.docx": "不是指南文档",
+}
+
+func testGuidelines() {
+	fmt.Println("\n2️⃣0️⃣ 测试临床指南检索")
+	fmt.Println("─────────────────────────────────")
+
+	// 按标题、分页和自然段切分
+	chunks := chunkGuideline(guidelineFile{path: "china_2019.md", text: guidelineTestFiles["china_2019.md"]})
+	sections := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		sections[i] = fmt.Sprintf("%s@%d", chunk.Metadata["section"], chunk.Metadata["line"])
+	}
+	if strings.Join(sections, ",") != "降尿酸治疗 > 起始时机@6,降尿酸治疗 > 控制目标@10,降尿酸治疗 > 药物选择@14,急性发作期治疗@18" ||
+		chunks[0].Metadata["title"] != "中国高尿酸血症与痛风诊疗指南（2019）" || !strings.Contains(chunks[2].PageContent, "100 mg/d。\n- 非布司他") ||
+		!strings.Contains(chunks[0].PageContent, "治疗；合并痛风石") {
+		fmt.Printf("❌ Markdown 切分不符: %s\n", strings.Join(sections, ","))
+	} else {
+		fmt.Printf("✅ Markdown 按标题切分为 %d 个段落，记录章节和起始行\n", len(chunks))
+	}
+	pages := chunkGuideline(guidelineFile{path: "eular.txt", text: guidelineTestFiles["eular/eular_2016.txt"]})
+	if len(pages) != 2 || pages[0].Metadata["page"] != 1 || pages[1].Metadata["page"] != 2 || pages[1].Metadata["line"] != 4 ||
+		!strings.Contains(pages[1].PageContent, "360 umol/L. A lower target") {
+		fmt.Printf("❌ 分页切分不符: %+v\n", pages)
+	} else {
+		fmt.Println("✅ PDF 导出文本按分页符标注页码，英文行之间补空格")
+	}
+	long := chunkGuideline(guidelineFile{path: "long.md", text: strings.Repeat("痛风患者应长期规律服用降尿酸药物并定期复查血尿酸。", 60)})
+	oversized := slices.ContainsFunc(long, func(doc schema.Document) bool { return utf8.RuneCountInString(doc.PageContent) > maxChunkRunes })
+	if len(long) < 3 || oversized || !strings.HasSuffix(long[0].PageContent, "。") {
+		fmt.Printf("❌ 超长自然段切分不符: %d 段\n", len(long))
+	} else {
+		fmt.Printf("✅ 超长自然段在句末切分为 %d 段，每段不超过 %d 字\n", len(long), maxChunkRunes)
+	}
+
+	// 建立索引并检索
+	dir, err := writeKnowledgeFiles(guidelineTestFiles)
+	if err != nil {
+		fmt.Printf("❌ 写入临时文件失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	index, rebuilt, err := openGuidelineIndex(dir, "")
+	if err != nil || !rebuilt || index.Files() != 3 {
+		fmt.Printf("❌ 建立指南索引失败: %v\n", err)
+		return
+	}
+	fmt.Printf("✅ 建立索引: %d 个文档，%d 个段落，语料版本 %s\n", index.Files(), index.Chunks(), index.Version())
+	ctx := context.Background()
+	cases := []struct {
+		query, citation string
+	}{
+		{"痛风石患者血尿酸控制目标", "《中国高尿酸血症与痛风诊疗指南（2019）》降尿酸治疗 > 控制目标（china_2019.md 第 10 行）"},
+		{"别嘌醇起始剂量", "《中国高尿酸血症与痛风诊疗指南（2019）》降尿酸治疗 > 药物选择（china_2019.md 第 14 行）"},
+		{"急性发作用什么药", "《中国高尿酸血症与痛风诊疗指南（2019）》急性发作期治疗（china_2019.md 第 18 行）"},
+		{"allopurinol starting dose", "《2020 ACR Guideline for the Management of Gout》Choice of first-line ULT（acr_2020.md 第 8 行）"},
+		{"target for patients with tophi", "《eular_2016》，第 2 页（eular/eular_2016.txt 第 4 行）"},
+	}
+	for _, c := range cases {
+		passages, err := index.Search(ctx, c.query, defaultGuidelineTopK)
+		if err != nil || len(passages) == 0 || passages[0].Citation != c.citation {
+			fmt.Printf("❌ %s: %v %+v\n", c.query, err, passages)
+		} else {
+			fmt.Printf("✅ %s → %s (相似度 %.3f)\n", c.query, passages[0].Citation, passages[0].Score)
+		}
+	}
+	if passages, _ := index.Search(ctx, "糖尿病饮食", defaultGuidelineTopK); len(passages) != 0 {
+		fmt.Printf("❌ 无关问题返回了段落: %+v\n", passages)
+	} else {
+		fmt.Println("✅ 无关问题不返回段落")
+	}
+
+	// 索引保存到磁盘，文档未变化时直接载入，变化时重建
+	before, _ := index.Search(ctx, "allopurinol starting dose", defaultGuidelineTopK)
+	indexPath := filepath.Join(dir, defaultGuidelineIndexName)
+	reopened, rebuilt, err := openGuidelineIndex(dir, "")
+	after, _ := reopened.Search(ctx, "allopurinol starting dose", defaultGuidelineTopK)
+	if _, statErr := os.Stat(indexPath); err != nil || rebuilt || statErr != nil || !reflect.DeepEqual(before, after) {
+		fmt.Printf("❌ 载入保存的索引不符: %v %v\n", err, rebuilt)
+	} else {
+		fmt.Println("✅ 文档未变化时载入保存的索引，检索结果一致")
+	}
+	if saved, _, err := openGuidelineIndex("", indexPath); err != nil || saved.Chunks() != index.Chunks() {
+		fmt.Printf("❌ 只指定索引文件时载入失败: %v\n", err)
+	}
+	os.WriteFile(filepath.Join(dir, "acr_2020.md"), []byte("# ACR\n\nColchicine is recommended for flare prophylaxis.\n"), 0o644)
+	changed, rebuilt, err := openGuidelineIndex(dir, "")
+	if err != nil || !rebuilt || changed.Version() == index.Version() {
+		fmt.Printf("❌ 文档变化后未重建索引: %v\n", err)
+	} else {
+		fmt.Printf("✅ 文档变化后重建索引，语料版本 %s → %s\n", index.Version(), changed.Version())
+	}
+	if none, _, err := openGuidelineIndex("", ""); err != nil || none != nil {
+		fmt.Println("❌ 未配置指南时应不启用指南检索")
+	}
+
+	// 向量库实现 langchaingo 的 VectorStore 接口
+	var store vectorstores.VectorStore = changed.store
+	docs, err := store.SimilaritySearch(ctx, "serum uric acid target", 5, vectorstores.WithFilters(map[string]any{"source": "eular/eular_2016.txt"}))
+	_, thresholdErr := store.SimilaritySearch(ctx, "血尿酸", 1, vectorstores.WithScoreThreshold(1.5))
+	ids, _ := store.AddDocuments(ctx, []schema.Document{{PageContent: "重复的段落"}, {PageContent: "Febuxostat is an alternative."}},
+		vectorstores.WithDeduplicater(func(_ context.Context, doc schema.Document) bool { return doc.PageContent == "重复的段落" }))
+	_, unfittedErr := NewTFIDFEmbedder(0).EmbedQuery(ctx, "痛风")
+	if err != nil || len(docs) == 0 || slices.ContainsFunc(docs, func(doc schema.Document) bool { return doc.Metadata["source"] != "eular/eular_2016.txt" }) ||
+		thresholdErr == nil || len(ids) != 1 || !errors.Is(unfittedErr, errEmbedderNotFitted) {
+		fmt.Printf("❌ 向量库选项不符: %v %d %v %v\n", err, len(docs), thresholdErr, ids)
+	} else {
+		fmt.Println("✅ 向量库支持元数据过滤、相似度阈值和去重")
+	}
+
+	// 智能体工具返回带出处的段落
+	tool := GuidelineSearchTool{Index: index}
+	output, _ := tool.Call(ctx, "别嘌醇起始剂量")
+	var result GuidelineResult
+	if err := json.Unmarshal([]byte(output), &result); err != nil || len(result.Passages) == 0 ||
+		!strings.Contains(result.Passages[0].Text, "起始剂量不超过 100 mg/d") || result.CorpusVersion != index.Version() {
+		fmt.Printf("❌ 指南检索工具结果不符: %s\n", output)
+	} else {
+		fmt.Printf("✅ 工具返回段落原文和出处: %s\n", result.Passages[0].Citation)
+	}
+	if output, _ := tool.Call(ctx, "糖尿病饮食"); !strings.Contains(output, "未在指南文档中找到") {
+		fmt.Printf("❌ 无结果时的说明不符: %s\n", output)
+	}
+	s, _ := newSession(NewScriptedLLM(), nil, nil, nil, io.Discard)
+	hasTool := func() bool {
+		return slices.ContainsFunc(s.executor.Agent.(*agents.ConversationalAgent).Tools, func(t tools.Tool) bool {
+			return t.Name() == "clinical_guideline_search"
+		})
+	}
+	without := hasTool()
+	s.setGuidelines(index)
+	if without || !hasTool() {
+		fmt.Println("❌ 会话工具列表不符")
+	} else {
+		fmt.Println("✅ 配置指南文档时智能体增加指南检索工具")
+	}
 }
 
 func testMedicalKnowledge() {
-	fmt.Println("\n2️⃣ 测试医学知识库")
+	fmt.Println("\n2️⃣1️⃣ 测试医学知识库")
 	fmt.Println("─────────────────────────────────")
 	
 	kb := NewMedicalKnowledgeBase()
@@ -98,8 +2477,9 @@ func testMedicalKnowledge() {
 		}
 		
 		// 验证返回结果
-		var medicalInfo []MedicalInfo
-		if err := json.Unmarshal([]byte(result), &medicalInfo); err == nil {
+		var knowledge KnowledgeResult
+		if err := json.Unmarshal([]byte(result), &knowledge); err == nil {
+			medicalInfo := knowledge.Results
 			if len(medicalInfo) > 0 {
 				fmt.Printf("✅ 找到相关知识: %s\n", medicalInfo[0].Topic)
 				if len(medicalInfo[0].Definition) > 50 {
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/embeddings"
+)
+
+// defaultEmbeddingDimensions TF-IDF 向量的维度，词项按哈希映射到各维
+const defaultEmbeddingDimensions = 4096
+
+// errEmbedderNotFitted 向量模型尚未拟合语料
+var errEmbedderNotFitted = errors.New("TF-IDF 向量模型尚未拟合语料")
+
+// TFIDFEmbedder 本地计算的 TF-IDF 向量模型，实现 langchaingo 的 embeddings.Embedder，不访问网络
+// 词项切分与知识库检索相同（汉字按相邻二字，字母数字按词），按哈希映射到固定维度，
+// 逆文档频率由 Fit 从语料统计，与向量库一同保存以保证查询和文档使用同一模型
+type TFIDFEmbedder struct {
+	Dimensions int       `json:"dimensions"` // 向量维度
+	Documents  int       `json:"documents"`  // 拟合语料的文档数
+	IDF        []float32 `json:"idf"`        // 各维的逆文档频率
+}
+
+var _ embeddings.Embedder = (*TFIDFEmbedder)(nil)
+
+// NewTFIDFEmbedder 创建指定维度的向量模型，dimensions 不大于 0 时使用默认维度
+func NewTFIDFEmbedder(dimensions int) *TFIDFEmbedder {
+	if dimensions <= 0 {
+		dimensions = defaultEmbeddingDimensions
+	}
+	return &TFIDFEmbedder{Dimensions: dimensions}
+}
+
+// Fit 按语料统计各维的逆文档频率，使用平滑的 idf = ln((1+N)/(1+df)) + 1
+func (e *TFIDFEmbedder) Fit(texts []string) {
+	docFreq := make([]int, e.Dimensions)
+	for _, text := range texts {
+		seen := make(map[int]bool)
+		for _, term := range vectorTerms(text) {
+			seen[e.bucket(term)] = true
+		}
+		for bucket := range seen {
+			docFreq[bucket]++
+		}
+	}
+	e.Documents = len(texts)
+	e.IDF = make([]float32, e.Dimensions)
+	for i, df := range docFreq {
+		e.IDF[i] = float32(math.Log(float64(1+e.Documents)/float64(1+df)) + 1)
+	}
+}
+
+// EmbedDocuments 计算每段文本的向量
+func (e *TFIDFEmbedder) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector, err := e.EmbedQuery(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// EmbedQuery 计算文本的向量：对数词频乘以逆文档频率，再归一化为单位长度，没有词项时为零向量
+func (e *TFIDFEmbedder) EmbedQuery(_ context.Context, text string) ([]float32, error) {
+	if len(e.IDF) != e.Dimensions || e.Dimensions == 0 {
+		return nil, errEmbedderNotFitted
+	}
+	counts := make(map[int]float64)
+	for _, term := range vectorTerms(text) {
+		counts[e.bucket(term)]++
+	}
+	vector := make([]float32, e.Dimensions)
+	norm := 0.0
+	for bucket, count := range counts {
+		weight := (1 + math.Log(count)) * float64(e.IDF[bucket])
+		vector[bucket] = float32(weight)
+		norm += weight * weight
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for bucket := range counts {
+			vector[bucket] = float32(float64(vector[bucket]) / norm)
+		}
+	}
+	return vector, nil
+}
+
+// bucket 返回词项映射到的维
+func (e *TFIDFEmbedder) bucket(term string) int {
+	h := fnv.New32a()
+	h.Write([]byte(term))
+	return int(h.Sum32() % uint32(e.Dimensions))
+}
+
+// vectorTerms 将文本切分为向量的词项：汉字按相邻二字，单独的汉字按单字，字母数字按词，保留重复
+func vectorTerms(text string) []string {
+	var terms []string
+	for _, run := range textRuns(text) {
+		if !run.han || utf8.RuneCountInString(run.text) == 1 {
+			terms = append(terms, run.text)
+			continue
+		}
+		chars := []rune(run.text)
+		for i := 0; i+1 < len(chars); i++ {
+			terms = append(terms, string(chars[i:i+2]))
+		}
+	}
+	return terms
+}
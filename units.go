@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// unitConversion 单项检测的单位换算规则
+type unitConversion struct {
+	Canonical string             // 标准单位
+	Factors   map[string]float64 // 归一化单位 -> 换算到标准单位的系数
+}
+
+// analyteUnitConversions 各检测项目的换算系数
+// 尿酸 1 mg/dL = 59.48 μmol/L；肌酐 1 mg/dL = 88.4 μmol/L；
+// 尿素氮 1 mg/dL = 0.357 mmol/L；尿素 1 mg/dL = 0.1665 mmol/L；CRP 1 mg/dL = 10 mg/L
+var analyteUnitConversions = map[string]unitConversion{
+	analyteUricAcid: {
+		Canonical: "μmol/L",
+		Factors: map[string]float64{
+			"μmol/l": 1,
+			"mmol/l": 1000,
+			"mg/dl":  59.48,
+			"mg/l":   5.948,
+		},
+	},
+	analyteCreatinine: {
+		Canonical: "μmol/L",
+		Factors: map[string]float64{
+			"μmol/l": 1,
+			"mmol/l": 1000,
+			"mg/dl":  88.4,
+		},
+	},
+	analyteBUN: {
+		Canonical: "mmol/L",
+		Factors: map[string]float64{
+			"mmol/l": 1,
+			"mg/dl":  0.357,
+		},
+	},
+	analyteUrea: {
+		Canonical: "mmol/L",
+		Factors: map[string]float64{
+			"mmol/l": 1,
+			"mg/dl":  0.1665,
+		},
+	},
+	analyteCRP: {
+		Canonical: "mg/L",
+		Factors: map[string]float64{
+			"mg/l":  1,
+			"mg/dl": 10,
+		},
+	},
+	analyteHsCRP: {
+		Canonical: "mg/L",
+		Factors: map[string]float64{
+			"mg/l":  1,
+			"mg/dl": 10,
+		},
+	},
+	analyteUrineUricAcid: {
+		Canonical: "μmol/L",
+		Factors: map[string]float64{
+			"μmol/l": 1,
+			"mmol/l": 1000,
+			"mg/dl":  59.48,
+		},
+	},
+	analyteUrineUricAcid24: {
+		Canonical: "mmol/24h",
+		Factors: map[string]float64{
+			"mmol/24h": 1,
+			"mmol/d":   1,
+			"μmol/24h": 0.001,
+			"μmol/d":   0.001,
+			"mg/24h":   0.005948,
+			"mg/d":     0.005948,
+		},
+	},
+	analyteUrineCreat24: {
+		Canonical: "mmol/24h",
+		Factors: map[string]float64{
+			"mmol/24h": 1,
+			"mmol/d":   1,
+			"μmol/24h": 0.001,
+			"μmol/d":   0.001,
+			"mg/24h":   0.00884,
+			"mg/d":     0.00884,
+			"g/24h":    8.84,
+			"g/d":      8.84,
+		},
+	},
+	analyteUrineCreatinine: {
+		Canonical: "μmol/L",
+		Factors: map[string]float64{
+			"μmol/l": 1,
+			"mmol/l": 1000,
+			"mg/dl":  88.4,
+		},
+	},
+	analyteNeutrophilPct: {
+		Canonical: "%",
+		Factors: map[string]float64{
+			"%": 1,
+		},
+	},
+	analyteESR: {
+		Canonical: "mm/h",
+		Factors: map[string]float64{
+			"mm/h": 1,
+		},
+	},
+	analyteWBC: {
+		Canonical: "×10⁹/L",
+		Factors: map[string]float64{
+			"×10⁹/l":  1,
+			"×10³/μl": 1,
+		},
+	},
+	analyteEGFR: {
+		Canonical: "mL/min/1.73m²",
+		Factors: map[string]float64{
+			"ml/min/1.73m²": 1,
+		},
+	},
+}
+
+// normalizeUnitKey 统一单位写法，用于查表（大小写、μ/µ/u、指数写法等）
+func normalizeUnitKey(unit string) string {
+	unit = strings.TrimSpace(unit)
+	if canonical, rest, ok := parseUnit(unit); ok && strings.TrimSpace(rest) == "" {
+		unit = canonical
+	}
+
+	key := strings.ToLower(unit)
+	key = strings.ReplaceAll(key, " ", "")
+	if strings.HasPrefix(key, "umol") || strings.HasPrefix(key, "ul") {
+		key = "μ" + strings.TrimPrefix(key, "u")
+	}
+	key = strings.ReplaceAll(key, "/umol", "/μmol")
+	key = strings.ReplaceAll(key, "/ul", "/μl")
+	return key
+}
+
+// canonicalFactor 返回将该项目换算到标准单位的系数及标准单位
+// 未登记换算规则的项目系数为 1 并保留原单位；已登记但单位未知时返回错误，不做猜测
+func canonicalFactor(analyte, unit string) (float64, string, error) {
+	conv, ok := analyteUnitConversions[analyte]
+	if !ok {
+		return 1, unit, nil
+	}
+
+	factor, ok := conv.Factors[normalizeUnitKey(unit)]
+	if !ok {
+		return 0, "", fmt.Errorf("无法识别的单位 %q", unit)
+	}
+	return factor, conv.Canonical, nil
+}
+
+// roundValue 换算结果保留两位小数，避免浮点误差出现在输出中
+func roundValue(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// 单位语法:
+//
+//	unit       = "%" | [multiplier] [component] { "/" component }
+//	multiplier = ["×" | "x" | "X" | "*"] "10" ("^" | "*" | "E" | "e" | 上标) exponent
+//	component  = [number] letters [exponent]    如 mg、dL、24h、1.73m²、m2
+//
+// 解析结果统一写作 "×10⁹/L"、"mL/min/1.73m²" 等形式。
+
+// superscriptDigits 上标数字与普通数字的对应关系
+var superscriptDigits = map[rune]rune{
+	'⁰': '0', '¹': '1', '²': '2', '³': '3', '⁴': '4',
+	'⁵': '5', '⁶': '6', '⁷': '7', '⁸': '8', '⁹': '9',
+}
+
+// toSuperscript 将数字串转为上标
+func toSuperscript(digits string) string {
+	var b strings.Builder
+	for _, r := range digits {
+		for sup, d := range superscriptDigits {
+			if d == r {
+				b.WriteRune(sup)
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+// unitScanner 单位解析器
+type unitScanner struct {
+	runes []rune
+	pos   int
+}
+
+func (s *unitScanner) peek() rune {
+	if s.pos >= len(s.runes) {
+		return 0
+	}
+	return s.runes[s.pos]
+}
+
+func (s *unitScanner) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(string(s.runes[s.pos:]), prefix)
+}
+
+func isUnitLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == 'μ' || r == 'µ'
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// digits 读取连续的普通数字
+func (s *unitScanner) digits() string {
+	start := s.pos
+	for isDigit(s.peek()) {
+		s.pos++
+	}
+	return string(s.runes[start:s.pos])
+}
+
+// exponent 读取指数，支持上标数字和 ^9、*9、E9 写法
+func (s *unitScanner) exponent() string {
+	start := s.pos
+	var b strings.Builder
+	for {
+		d, ok := superscriptDigits[s.peek()]
+		if !ok {
+			break
+		}
+		b.WriteRune(d)
+		s.pos++
+	}
+	if b.Len() > 0 {
+		return b.String()
+	}
+
+	switch s.peek() {
+	case '^', '*', 'E', 'e':
+		s.pos++
+		if d := s.digits(); d != "" {
+			return d
+		}
+	}
+	s.pos = start
+	return ""
+}
+
+// multiplier 读取 ×10⁹、10^9、x10E9 等数量级前缀
+func (s *unitScanner) multiplier() string {
+	start := s.pos
+	switch s.peek() {
+	case '×', 'x', 'X', '*':
+		s.pos++
+	}
+	if !s.hasPrefix("10") {
+		s.pos = start
+		return ""
+	}
+	s.pos += 2
+	exp := s.exponent()
+	if exp == "" {
+		s.pos = start
+		return ""
+	}
+	return "×10" + toSuperscript(exp)
+}
+
+// component 读取单个单位分量，如 mg、dL、24h、1.73m²
+func (s *unitScanner) component() string {
+	start := s.pos
+	var b strings.Builder
+
+	if isDigit(s.peek()) {
+		b.WriteString(s.digits())
+		if s.peek() == '.' {
+			s.pos++
+			frac := s.digits()
+			if frac == "" {
+				s.pos = start
+				return ""
+			}
+			b.WriteString("." + frac)
+		}
+	}
+
+	letterStart := s.pos
+	for isUnitLetter(s.peek()) {
+		r := s.peek()
+		if r == 'µ' {
+			r = 'μ'
+		}
+		b.WriteRune(r)
+		s.pos++
+	}
+	if s.pos == letterStart {
+		s.pos = start
+		return ""
+	}
+
+	// 面积等单位的指数，如 m²、m2
+	if exp := s.exponent(); exp != "" {
+		b.WriteString(toSuperscript(exp))
+	} else if isDigit(s.peek()) {
+		b.WriteString(toSuperscript(s.digits()))
+	}
+	return b.String()
+}
+
+// parseUnit 从文本开头解析单位，返回规范写法和剩余文本
+func parseUnit(text string) (string, string, bool) {
+	s := &unitScanner{runes: []rune(strings.TrimLeft(text, " \t"))}
+
+	if s.peek() == '%' {
+		s.pos++
+		return "%", string(s.runes[s.pos:]), true
+	}
+
+	var b strings.Builder
+	b.WriteString(s.multiplier())
+
+	first := s.component()
+	if first == "" && b.Len() == 0 {
+		return "", text, false
+	}
+	b.WriteString(first)
+
+	for s.peek() == '/' {
+		mark := s.pos
+		s.pos++
+		next := s.component()
+		if next == "" {
+			s.pos = mark
+			break
+		}
+		b.WriteString("/" + next)
+	}
+
+	unit := b.String()
+	// "×10⁹" 后必须跟分量，如 ×10⁹/L
+	if strings.HasPrefix(unit, "×10") && !strings.Contains(unit, "/") && first == "" {
+		return "", text, false
+	}
+	unit = canonicalUnitCase(unit)
+	return unit, string(s.runes[s.pos:]), true
+}
+
+// canonicalUnitCase 统一常见单位的大小写，如 ml→mL、dl→dL、l→L
+func canonicalUnitCase(unit string) string {
+	parts := strings.Split(unit, "/")
+	for i, part := range parts {
+		switch {
+		case part == "l":
+			parts[i] = "L"
+		case strings.HasSuffix(part, "ml") || strings.HasSuffix(part, "dl"):
+			parts[i] = part[:len(part)-1] + "L"
+		case strings.HasPrefix(part, "×10") && strings.HasSuffix(part, "l"):
+			parts[i] = part[:len(part)-1] + "L"
+		}
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tmc/langchaingo/callbacks"
+)
+
+// 降尿酸治疗目标 (μmol/L)，知识库痛风条目中未找到时使用
+const (
+	defaultUrateTarget      = 360.0
+	defaultUrateTargetTophi = 300.0
+)
+
+// 血尿酸参考变化值（RCV）参数：分析变异系数和个体内生物学变异系数 (%)
+// RCV = 1.96 × √2 × √(CVa² + CVi²)，两次结果变化超过 RCV 才认为有临床意义
+const (
+	urateAnalyticalCV    = 3.0
+	urateWithinSubjectCV = 9.0
+)
+
+// daysPerMonth 斜率按月（30天）折算
+const daysPerMonth = 30.0
+
+var (
+	urateReferenceChangePercent = 1.96 * math.Sqrt2 * math.Hypot(urateAnalyticalCV, urateWithinSubjectCV)
+
+	// 知识库中的治疗目标，如 "目标：血尿酸<360μmol/L"
+	urateTargetRe = regexp.MustCompile(`<\s*([0-9]+(?:\.[0-9]+)?)\s*μmol/L`)
+)
+
+// urateTargets 降尿酸治疗目标及其在知识库中的出处
+type urateTargets struct {
+	General       float64
+	GeneralSource string
+	Tophi         float64
+	TophiSource   string
+}
+
+// urateTargetsFromKnowledge 从知识库痛风条目的治疗部分读取降尿酸目标
+func urateTargetsFromKnowledge(kb *MedicalKnowledgeBase) urateTargets {
+	targets := urateTargets{
+		General: defaultUrateTarget, GeneralSource: "默认目标",
+		Tophi: defaultUrateTargetTophi, TophiSource: "默认目标",
+	}
+	for _, line := range kb.knowledge["痛风"].Treatment {
+		m := urateTargetRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.Contains(line, "痛风石"):
+			targets.Tophi, targets.TophiSource = value, "知识库痛风条目："+line
+		case strings.Contains(line, "目标"):
+			targets.General, targets.GeneralSource = value, "知识库痛风条目："+line
+		}
+	}
+	return targets
+}
+
+// knowledgeUrateTargets 返回知识库中的降尿酸目标，kb 为 nil 时使用内置知识库
+func knowledgeUrateTargets(kb *MedicalKnowledgeBase) urateTargets {
+	if kb == nil {
+		kb = defaultKnowledgeBase()
+	}
+	return kb.targets
+}
+
+// UratePoint 单次血尿酸结果
+type UratePoint struct {
+	Date     string  `json:"date"`      // 化验日期
+	Value    float64 `json:"value"`     // 血尿酸 (μmol/L)
+	InTarget bool    `json:"in_target"` // 是否达标
+}
+
+// UrateTrend 血尿酸变化趋势
+type UrateTrend struct {
+	Points                 []UratePoint `json:"points"`                   // 按日期排列的血尿酸
+	Target                 float64      `json:"target"`                   // 治疗目标 (μmol/L)，血尿酸低于该值为达标
+	TargetSource           string       `json:"target_source"`            // 治疗目标出处
+	TimeInTarget           float64      `json:"time_in_target"`           // 达标时间占比，相邻两次结果间按线性插值
+	MeasurementsInTarget   float64      `json:"measurements_in_target"`   // 达标检测次数占比
+	SlopePerMonth          float64      `json:"slope_per_month"`          // 最小二乘斜率 (μmol/L/月)
+	LatestChange           float64      `json:"latest_change"`            // 最近两次结果之差 (μmol/L)
+	LatestChangePercent    float64      `json:"latest_change_percent"`    // 最近两次结果变化百分比
+	ReferenceChangePercent float64      `json:"reference_change_percent"` // 参考变化值 (%)
+	MeaningfulChange       bool         `json:"meaningful_change"`        // 最近一次变化是否超过参考变化值
+	AtTarget               bool         `json:"at_target"`                // 最近一次结果是否达标
+	Notes                  []string     `json:"notes"`                    // 说明
+}
+
+// analyzeUrateTrend 分析历次血尿酸的变化趋势，没有带日期的血尿酸结果时返回 nil
+func analyzeUrateTrend(reports []DatedLabReport, patient PatientContext, targets urateTargets) *UrateTrend {
+	type sample struct {
+		day   float64
+		value float64
+	}
+	var samples []sample
+	trend := &UrateTrend{Points: []UratePoint{}, Notes: []string{}}
+
+	trend.Target, trend.TargetSource = targets.General, targets.GeneralSource
+	if patient.HasTophi() {
+		trend.Target, trend.TargetSource = targets.Tophi, targets.TophiSource
+	}
+
+	for _, report := range reports {
+		for _, result := range report.Results {
+			if result.AnalyteID != analyteUricAcid || result.Status == statusUnknownUnit {
+				continue
+			}
+			day := report.Date.Sub(reports[0].Date).Hours() / 24
+			samples = append(samples, sample{day: day, value: result.Value})
+			trend.Points = append(trend.Points, UratePoint{
+				Date:     report.Date.Format(reportDateLayout),
+				Value:    result.Value,
+				InTarget: result.Value < trend.Target,
+			})
+		}
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	inTarget := 0
+	for _, point := range trend.Points {
+		if point.InTarget {
+			inTarget++
+		}
+	}
+	trend.MeasurementsInTarget = roundValue(float64(inTarget) / float64(len(trend.Points)))
+	latest := samples[len(samples)-1]
+	trend.AtTarget = latest.value < trend.Target
+	trend.ReferenceChangePercent = roundValue(urateReferenceChangePercent)
+
+	if len(samples) < 2 {
+		if trend.AtTarget {
+			trend.TimeInTarget = 1
+		}
+		trend.Notes = append(trend.Notes, "仅有一次血尿酸结果，至少需要两次不同日期的结果才能分析趋势")
+		return trend
+	}
+
+	// 达标时间：相邻两次结果间按线性插值估计低于目标的天数
+	var totalDays, targetDays float64
+	for i := 1; i < len(samples); i++ {
+		prev, next := samples[i-1], samples[i]
+		days := next.day - prev.day
+		totalDays += days
+		switch {
+		case prev.value < trend.Target && next.value < trend.Target:
+			targetDays += days
+		case prev.value < trend.Target:
+			targetDays += days * (trend.Target - prev.value) / (next.value - prev.value)
+		case next.value < trend.Target:
+			targetDays += days * (trend.Target - next.value) / (prev.value - next.value)
+		}
+	}
+	if totalDays > 0 {
+		trend.TimeInTarget = roundValue(targetDays / totalDays)
+	}
+
+	// 最小二乘斜率
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(samples))
+	for _, s := range samples {
+		sumX += s.day
+		sumY += s.value
+		sumXY += s.day * s.value
+		sumXX += s.day * s.day
+	}
+	if denominator := n*sumXX - sumX*sumX; denominator != 0 {
+		trend.SlopePerMonth = roundValue((n*sumXY - sumX*sumY) / denominator * daysPerMonth)
+	}
+
+	previous := samples[len(samples)-2]
+	trend.LatestChange = roundValue(latest.value - previous.value)
+	if previous.value > 0 {
+		trend.LatestChangePercent = roundValue(trend.LatestChange / previous.value * 100)
+	}
+	trend.MeaningfulChange = math.Abs(trend.LatestChangePercent) > urateReferenceChangePercent
+
+	switch {
+	case trend.MeaningfulChange && trend.LatestChange < 0:
+		trend.Notes = append(trend.Notes, fmt.Sprintf("最近一次血尿酸下降 %.0f μmol/L（%.1f%%），超过参考变化值 %.1f%%，变化有临床意义",
+			-trend.LatestChange, -trend.LatestChangePercent, trend.ReferenceChangePercent))
+	case trend.MeaningfulChange:
+		trend.Notes = append(trend.Notes, fmt.Sprintf("最近一次血尿酸上升 %.0f μmol/L（%.1f%%），超过参考变化值 %.1f%%，变化有临床意义",
+			trend.LatestChange, trend.LatestChangePercent, trend.ReferenceChangePercent))
+	default:
+		trend.Notes = append(trend.Notes, fmt.Sprintf("最近一次血尿酸变化 %.1f%%，未超过参考变化值 %.1f%%，可能为检测误差或生理波动",
+			trend.LatestChangePercent, trend.ReferenceChangePercent))
+	}
+	if trend.AtTarget {
+		trend.Notes = append(trend.Notes, fmt.Sprintf("最近一次血尿酸已低于治疗目标 %.0f μmol/L，建议继续维持治疗并定期监测", trend.Target))
+	} else {
+		trend.Notes = append(trend.Notes, fmt.Sprintf("最近一次血尿酸未达到治疗目标 <%.0f μmol/L，建议在医生指导下评估并调整降尿酸治疗", trend.Target))
+	}
+	return trend
+}
+
+// UrateTrendTool 血尿酸趋势分析工具
+type UrateTrendTool struct {
+	CallbacksHandler callbacks.Handler
+	LabAnalyzer      GoutLabAnalyzer // 解析化验单及保存化验历史
+}
+
+// Name 返回工具名称
+func (t UrateTrendTool) Name() string {
+	return "urate_trend"
+}
+
+// Description 返回工具描述
+func (t UrateTrendTool) Description() string {
+	return `血尿酸趋势分析工具。用于痛风达标治疗随访，分析同一患者多次化验的血尿酸变化。
+输入为多份带日期的化验单，每份以日期行开头，例如：
+"患者编号: P001
+痛风石: 有
+日期: 2024-01-10
+尿酸 520 umol/L
+日期: 2024-04-12
+尿酸 380 umol/L"
+提供患者编号时会保存本次输入的化验结果，并结合该患者以往的记录分析。
+返回血尿酸变化轨迹、治疗目标（一般<360 μmol/L，有痛风石<300 μmol/L）、达标时间占比、
+每月变化斜率，以及最近一次变化是否超过参考变化值（有临床意义）。`
+}
+
+// Call 执行趋势分析
+func (t UrateTrendTool) Call(ctx context.Context, input string) (string, error) {
+	if t.CallbacksHandler != nil {
+		t.CallbacksHandler.HandleToolStart(ctx, input)
+	}
+
+	analyzer := t.LabAnalyzer
+	patient, history, err := analyzer.prepareInput(input)
+	if err != nil {
+		return err.Error(), nil
+	}
+
+	reports, err := analyzer.labHistory(history, patient)
+	if err != nil {
+		return fmt.Sprintf("读取化验历史时出错: %v", err), nil
+	}
+	trend := analyzeUrateTrend(reports, patient, analyzer.targets())
+	if trend == nil {
+		return "未识别到带日期的血尿酸结果，请按 \"日期: 2024-01-10\" 的格式在每份化验单前注明化验日期", nil
+	}
+
+	result, err := json.MarshalIndent(trend, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("格式化趋势分析结果时出错: %v", err), nil
+	}
+
+	if t.CallbacksHandler != nil {
+		t.CallbacksHandler.HandleToolEnd(ctx, string(result))
+	}
+
+	return string(result), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import "fmt"
+
+// 尿酸排泄分型界值（中国高尿酸血症与痛风诊疗指南 2019）
+const (
+	urateExcretionCutoffMg = 600.0 // 24小时尿尿酸排泄量 mg/d
+	feuaCutoffPercent      = 5.5   // 尿酸排泄分数 %
+	urateMgPerMmol         = 168.1 // 尿酸 1 mmol = 168.1 mg
+)
+
+// 尿酸排泄分型
+const (
+	excretionUnderExcretion = "肾脏排泄不良型"
+	excretionOverload       = "肾脏负荷过多型"
+	excretionMixed          = "混合型"
+	excretionOther          = "其他型"
+	excretionUnclassified   = "无法分型"
+)
+
+// UrateExcretionAnalysis 尿酸排泄分析
+type UrateExcretionAnalysis struct {
+	UrinaryUrate24h   float64  `json:"urinary_urate_24h,omitempty"`    // 24小时尿尿酸排泄量 (mmol/24h)
+	UrinaryUrate24hMg float64  `json:"urinary_urate_24h_mg,omitempty"` // 24小时尿尿酸排泄量 (mg/24h)
+	FEUA              float64  `json:"feua,omitempty"`                 // 尿酸排泄分数 (%)
+	Type              string   `json:"type"`                           // 排泄分型
+	Notes             []string `json:"notes"`                          // 计算依据及说明
+}
+
+// analyzeUrateExcretion 根据24小时尿尿酸及血、尿尿酸与肌酐计算尿酸排泄情况
+// FEUA = (尿尿酸 × 血肌酐) / (血尿酸 × 尿肌酐) × 100%，四项均为 μmol/L 时单位相消
+// 未提供任何尿液尿酸数据时返回 nil
+func analyzeUrateExcretion(results []LabResult) *UrateExcretionAnalysis {
+	values := make(map[string]float64)
+	for _, result := range results {
+		if result.Status == statusUnknownUnit {
+			continue
+		}
+		values[result.AnalyteID] = result.Value
+	}
+
+	urine24h, has24h := values[analyteUrineUricAcid24]
+	urineUA, hasUrineUA := values[analyteUrineUricAcid]
+	if !has24h && !hasUrineUA {
+		return nil
+	}
+
+	analysis := &UrateExcretionAnalysis{Notes: []string{}}
+	hasFEUA := false
+
+	if has24h {
+		analysis.UrinaryUrate24h = roundValue(urine24h)
+		analysis.UrinaryUrate24hMg = roundValue(urine24h * urateMgPerMmol)
+		analysis.Notes = append(analysis.Notes,
+			fmt.Sprintf("24小时尿尿酸 %.0f mg/d（界值 %.0f mg/d，未按体表面积校正）", analysis.UrinaryUrate24hMg, urateExcretionCutoffMg))
+	}
+
+	serumUA, hasSerumUA := values[analyteUricAcid]
+	serumCr, hasSerumCr := values[analyteCreatinine]
+	urineCr, hasUrineCr := values[analyteUrineCreatinine]
+	switch {
+	case !hasUrineUA:
+	case hasSerumUA && hasSerumCr && hasUrineCr && serumUA > 0 && urineCr > 0:
+		analysis.FEUA = roundValue(urineUA * serumCr / (serumUA * urineCr) * 100)
+		hasFEUA = true
+		analysis.Notes = append(analysis.Notes,
+			fmt.Sprintf("FEUA = (尿尿酸 %.0f × 血肌酐 %.0f) / (血尿酸 %.0f × 尿肌酐 %.0f) × 100%% = %.2f%%（界值 %.1f%%）",
+				urineUA, serumCr, serumUA, urineCr, analysis.FEUA, feuaCutoffPercent))
+	default:
+		analysis.Notes = append(analysis.Notes, "计算 FEUA 需同时提供血尿酸、血肌酐、尿尿酸和尿肌酐")
+	}
+
+	analysis.Type = classifyUrateExcretion(analysis.UrinaryUrate24hMg, has24h, analysis.FEUA, hasFEUA)
+	if analysis.Type == excretionUnclassified {
+		analysis.Notes = append(analysis.Notes, "排泄分型需同时具备24小时尿尿酸和 FEUA")
+	}
+	return analysis
+}
+
+// classifyUrateExcretion 按24小时尿尿酸排泄量和 FEUA 分型
+func classifyUrateExcretion(uueMg float64, hasUUE bool, feua float64, hasFEUA bool) string {
+	if !hasUUE || !hasFEUA {
+		return excretionUnclassified
+	}
+
+	highExcretion := uueMg > urateExcretionCutoffMg
+	lowFraction := feua < feuaCutoffPercent
+	switch {
+	case !highExcretion && lowFraction:
+		return excretionUnderExcretion
+	case highExcretion && !lowFraction:
+		return excretionOverload
+	case highExcretion && lowFraction:
+		return excretionMixed
+	}
+	return excretionOther
+}
+
+// urateExcretionAdvice 各排泄分型对应的用药提示
+func urateExcretionAdvice(excretionType string) string {
+	switch excretionType {
+	case excretionUnderExcretion:
+		return "尿酸排泄减少为主，可在医生指导下考虑促尿酸排泄药物（如苯溴马隆），用药前需评估肾功能及尿路结石风险"
+	case excretionOverload, excretionMixed:
+		return "尿酸生成过多为主，可在医生指导下优先考虑抑制尿酸生成药物（如别嘌醇、非布司他）"
+	case excretionOther:
+		return "尿酸排泄分型不典型，建议由专科医生结合临床情况选择降尿酸方案"
+	}
+	return ""
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/schema"
+	"github.com/tmc/langchaingo/vectorstores"
+)
+
+// errInvalidScoreThreshold 相似度阈值超出 0-1
+var errInvalidScoreThreshold = errors.New("相似度阈值应在 0 到 1 之间")
+
+// MemoryVectorStore 内存向量库，实现 langchaingo 的 vectorstores.VectorStore，可保存为文件后重新载入
+// 相似度为余弦相似度；Filters 为 map[string]any 时只返回元数据与之全部相等的文档
+type MemoryVectorStore struct {
+	embedder embeddings.Embedder
+
+	mu      sync.RWMutex
+	records []VectorRecord
+}
+
+var _ vectorstores.VectorStore = (*MemoryVectorStore)(nil)
+
+// VectorRecord 向量库中的一个文档及其向量
+type VectorRecord struct {
+	ID       string         `json:"id"`
+	Content  string         `json:"content"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+	Vector   []float32      `json:"-"`
+}
+
+// NewMemoryVectorStore 创建使用指定向量模型的内存向量库
+func NewMemoryVectorStore(embedder embeddings.Embedder) *MemoryVectorStore {
+	return &MemoryVectorStore{embedder: embedder}
+}
+
+// AddDocuments 计算文档向量并加入向量库，返回新文档的编号，Deduplicater 判定为重复的文档跳过
+func (s *MemoryVectorStore) AddDocuments(ctx context.Context, docs []schema.Document, options ...vectorstores.Option) ([]string, error) {
+	opts := s.options(options)
+	var texts []string
+	var added []schema.Document
+	for _, doc := range docs {
+		if opts.Deduplicater != nil && opts.Deduplicater(ctx, doc) {
+			continue
+		}
+		texts = append(texts, doc.PageContent)
+		added = append(added, doc)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	if opts.Embedder == nil {
+		return nil, fmt.Errorf("向量库未配置向量模型")
+	}
+	vectors, err := opts.Embedder.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("计算文档向量失败: %w", err)
+	}
+	if len(vectors) != len(added) {
+		return nil, fmt.Errorf("向量模型返回 %d 个向量，应为 %d 个", len(vectors), len(added))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(added))
+	for i, doc := range added {
+		ids[i] = strconv.Itoa(len(s.records) + 1)
+		s.records = append(s.records, VectorRecord{ID: ids[i], Content: doc.PageContent, Metadata: doc.Metadata, Vector: vectors[i]})
+	}
+	return ids, nil
+}
+
+// SimilaritySearch 返回与查询最相似的 numDocuments 个文档，Score 为余弦相似度，相同时按加入顺序
+func (s *MemoryVectorStore) SimilaritySearch(ctx context.Context, query string, numDocuments int, options ...vectorstores.Option) ([]schema.Document, error) {
+	opts := s.options(options)
+	if opts.ScoreThreshold < 0 || opts.ScoreThreshold > 1 {
+		return nil, errInvalidScoreThreshold
+	}
+	filters, ok := opts.Filters.(map[string]any)
+	if opts.Filters != nil && !ok {
+		return nil, fmt.Errorf("不支持的过滤条件 %T，应为 map[string]any", opts.Filters)
+	}
+	if opts.Embedder == nil {
+		return nil, fmt.Errorf("向量库未配置向量模型")
+	}
+	vector, err := opts.Embedder.EmbedQuery(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("计算查询向量失败: %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var docs []schema.Document
+	for _, record := range s.records {
+		if !matchesFilters(record.Metadata, filters) {
+			continue
+		}
+		score := cosineSimilarity(vector, record.Vector)
+		if score <= 0 || score < opts.ScoreThreshold {
+			continue
+		}
+		docs = append(docs, schema.Document{PageContent: record.Content, Metadata: record.Metadata, Score: score})
+	}
+	slices.SortStableFunc(docs, func(a, b schema.Document) int {
+		if a.Score > b.Score {
+			return -1
+		}
+		if a.Score < b.Score {
+			return 1
+		}
+		return 0
+	})
+	if numDocuments > 0 && len(docs) > numDocuments {
+		docs = docs[:numDocuments]
+	}
+	return docs, nil
+}
+
+// Records 返回向量库中的全部文档，用于保存
+func (s *MemoryVectorStore) Records() []VectorRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.records)
+}
+
+// Restore 载入已保存的文档和向量，不重新计算向量
+func (s *MemoryVectorStore) Restore(records []VectorRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+}
+
+// Len 返回文档数
+func (s *MemoryVectorStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.records)
+}
+
+// options 合并选项，未指定向量模型时使用向量库的模型
+func (s *MemoryVectorStore) options(options []vectorstores.Option) vectorstores.Options {
+	opts := vectorstores.Options{Embedder: s.embedder}
+	for _, option := range options {
+		option(&opts)
+	}
+	return opts
+}
+
+// matchesFilters 判断元数据是否与过滤条件全部相等
+func matchesFilters(metadata, filters map[string]any) bool {
+	for key, want := range filters {
+		if fmt.Sprint(metadata[key]) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// cosineSimilarity 计算两个向量的余弦相似度，维度不同或有零向量时为 0
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / math.Sqrt(normA*normB))
+}
+
+// sparseVector 向量的稀疏存储形式，TF-IDF 向量大多数维为 0
+type sparseVector struct {
+	Dimensions int       `json:"dimensions"`
+	Indices    []int     `json:"indices"`
+	Values     []float32 `json:"values"`
+}
+
+// MarshalJSON 保存文档时以稀疏形式保存向量
+func (r VectorRecord) MarshalJSON() ([]byte, error) {
+	type record VectorRecord
+	vector := sparseVector{Dimensions: len(r.Vector), Indices: []int{}, Values: []float32{}}
+	for i, value := range r.Vector {
+		if value != 0 {
+			vector.Indices = append(vector.Indices, i)
+			vector.Values = append(vector.Values, value)
+		}
+	}
+	return json.Marshal(struct {
+		record
+		Vector sparseVector `json:"vector"`
+	}{record(r), vector})
+}
+
+// UnmarshalJSON 载入文档时还原稀疏保存的向量
+func (r *VectorRecord) UnmarshalJSON(data []byte) error {
+	type record VectorRecord
+	var saved struct {
+		record
+		Vector sparseVector `json:"vector"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	if len(saved.Vector.Indices) != len(saved.Vector.Values) {
+		return fmt.Errorf("文档 %s 的向量下标与取值个数不同", saved.ID)
+	}
+	*r = VectorRecord(saved.record)
+	r.Vector = make([]float32, saved.Vector.Dimensions)
+	for i, index := range saved.Vector.Indices {
+		if index < 0 || index >= len(r.Vector) {
+			return fmt.Errorf("文档 %s 的向量下标 %d 超出维度 %d", saved.ID, index, len(r.Vector))
+		}
+		r.Vector[index] = saved.Vector.Values[i]
+	}
+	return nil
+}